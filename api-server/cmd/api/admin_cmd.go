@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/config"
+	"api-server/internal/database"
+	"api-server/internal/logging"
+	"api-server/internal/server"
+)
+
+const adminUsage = `Usage: %s <command>
+
+Commands:
+  users create [flags] EMAIL     create a user, reading the password from
+                                 standard input
+      -first-name NAME, -last-name NAME
+  users disable [flags] EMAIL    stop a user from logging in or using the
+                                 API and stop their active sessions
+      -keep-sessions             leave the user's sessions running
+  users list                     list every user
+  sessions list [flags]          list the active sessions of every user
+      -user EMAIL                only list the sessions of this user
+      -all                       include stopped sessions, with -user
+  sessions stop -user EMAIL [ID...]
+                                 stop the given sessions of a user, or all of
+                                 their active sessions
+  reap                           expire sessions, fail sessions stuck pending
+                                 and purge archived sessions and finished
+                                 webhook deliveries once
+  reconcile [flags]              stop sessions whose browser is gone and
+                                 delete browsers no session refers to
+      -dry-run                   only report what would change
+`
+
+// adminCommands are the admin commands and their subcommands
+var adminCommands = map[string][]string{
+	"users":     {"create", "disable", "list"},
+	"sessions":  {"list", "stop"},
+	"reap":      nil,
+	"reconcile": nil,
+}
+
+// runAdmin runs an admin command against the configured database and
+// browser servers and returns the exit code
+func runAdmin(stdin io.Reader, stdout, stderr io.Writer, configPath string, args []string) int {
+	if !validAdminCommand(args) {
+		fmt.Fprintf(stderr, adminUsage, os.Args[0])
+		return 2
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if err := logging.Setup(stderr, cfg.Logging.Level, cfg.Logging.Levels); err != nil {
+		fmt.Fprintf(stderr, "failed to set up logging: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	a, err := server.NewAdmin(db, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	if err := admin(ctx, stdin, stdout, a, args); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", strings.Join(args[:min(len(args), 2)], " "), err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, adminUsage, os.Args[0])
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// validAdminCommand reports whether args start with an admin command and,
+// for commands that have them, one of its subcommands
+func validAdminCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	subcommands, ok := adminCommands[args[0]]
+	if !ok {
+		return false
+	}
+	if len(subcommands) == 0 {
+		return true
+	}
+	return len(args) > 1 && slices.Contains(subcommands, args[1])
+}
+
+// admin runs one admin command
+func admin(ctx context.Context, stdin io.Reader, w io.Writer, a *server.Admin, args []string) error {
+	command, args := args[0], args[1:]
+	if len(adminCommands[command]) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	// parse parses the command's flags and checks its number of arguments
+	parse := func(minArgs, maxArgs int) error {
+		if err := flags.Parse(args); err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		if n := flags.NArg(); n < minArgs || (maxArgs >= 0 && n > maxArgs) {
+			return errUsage
+		}
+		return nil
+	}
+
+	switch command {
+	case "users create":
+		firstName := flags.String("first-name", "", "")
+		lastName := flags.String("last-name", "", "")
+		if err := parse(1, 1); err != nil {
+			return err
+		}
+		// Passwords aren't taken as flags, which would leave them in process
+		// listings and shell history
+		password, err := readPassword(stdin)
+		if err != nil {
+			return err
+		}
+		u, err := a.CreateUser(ctx, flags.Arg(0), *firstName, *lastName, password)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "created user %s (%s)\n", u.Email, u.ID)
+		return nil
+	case "users disable":
+		keepSessions := flags.Bool("keep-sessions", false, "")
+		if err := parse(1, 1); err != nil {
+			return err
+		}
+		u, stopped, err := a.DisableUser(ctx, flags.Arg(0), !*keepSessions)
+		if u != nil {
+			fmt.Fprintf(w, "disabled user %s (%s)\n", u.Email, u.ID)
+		}
+		for _, session := range stopped {
+			fmt.Fprintf(w, "stopped session %s\n", session.ID)
+		}
+		return err
+	case "users list":
+		if err := parse(0, 0); err != nil {
+			return err
+		}
+		users, err := a.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		return printUsers(w, users)
+	case "sessions list":
+		email := flags.String("user", "", "")
+		all := flags.Bool("all", false, "")
+		if err := parse(0, 0); err != nil {
+			return err
+		}
+		if *all && *email == "" {
+			return fmt.Errorf("%w: -all requires -user", errUsage)
+		}
+		sessions, err := a.ListSessions(ctx, *email, *all)
+		if err != nil {
+			return err
+		}
+		return printSessions(w, sessions)
+	case "sessions stop":
+		email := flags.String("user", "", "")
+		if err := parse(0, -1); err != nil {
+			return err
+		}
+		if *email == "" {
+			return fmt.Errorf("%w: -user is required", errUsage)
+		}
+		var ids []uuid.UUID
+		for _, arg := range flags.Args() {
+			id, err := uuid.Parse(arg)
+			if err != nil {
+				return fmt.Errorf("%w: invalid session ID %q", errUsage, arg)
+			}
+			ids = append(ids, id)
+		}
+		stopped, err := a.StopSessions(ctx, *email, ids)
+		for _, session := range stopped {
+			fmt.Fprintf(w, "stopped session %s\n", session.ID)
+		}
+		if err == nil && len(stopped) == 0 {
+			fmt.Fprintln(w, "no active sessions")
+		}
+		return err
+	case "reap":
+		if err := parse(0, 0); err != nil {
+			return err
+		}
+		result, err := a.Reap(ctx)
+		fmt.Fprintf(w, "expired %d sessions, failed %d pending sessions, purged %d archived sessions and %d webhook deliveries\n",
+			result.Expired, result.FailedPending, result.Purged, result.PurgedDeliveries)
+		return err
+	case "reconcile":
+		dryRun := flags.Bool("dry-run", false, "")
+		if err := parse(0, 0); err != nil {
+			return err
+		}
+		result, err := a.Reconcile(ctx, *dryRun)
+		if result != nil {
+			printReconcile(w, result, *dryRun)
+		}
+		return err
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, command)
+	}
+}
+
+// readPassword reads a password from the first line of r
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password given on standard input")
+	}
+	return password, nil
+}
+
+// printUsers prints a table of users
+func printUsers(w io.Writer, users []*database.User) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tNAME\tCREATED\tDISABLED")
+	for _, u := range users {
+		disabled := "-"
+		if u.DisabledAt.Valid {
+			disabled = formatTime(u.DisabledAt.Time)
+		}
+		name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.ID, u.Email, name, formatTime(u.CreatedAt), disabled)
+	}
+	return tw.Flush()
+}
+
+// printSessions prints a table of sessions
+func printSessions(w io.Writer, sessions []*database.Session) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tBROWSER\tSTATE\tNODE\tINSTANCE\tSTARTED\tSTOPPED")
+	for _, session := range sessions {
+		state, stopped := session.State, "-"
+		if session.StoppedAt.Valid {
+			state, stopped = "stopped", formatTime(session.StoppedAt.Time)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			session.ID, session.UserID, session.BrowserType, state,
+			orDash(session.BrowserNode), orDash(session.InstanceID),
+			formatTime(session.StartedAt), stopped)
+	}
+	return tw.Flush()
+}
+
+// printReconcile prints what a reconcile changed, or would change
+func printReconcile(w io.Writer, result *server.ReconcileResult, dryRun bool) {
+	stopped, deleted := "stopped", "deleted"
+	if dryRun {
+		stopped, deleted = "would stop", "would delete"
+	}
+	for _, node := range result.Unreachable {
+		fmt.Fprintf(w, "skipped unreachable browser server %s\n", node)
+	}
+	for _, session := range result.Stopped {
+		fmt.Fprintf(w, "%s session %s, browser %s is gone\n", stopped, session.ID, session.BrowserID)
+	}
+	for _, b := range result.Deleted {
+		fmt.Fprintf(w, "%s browser %s on %s, no session refers to it\n", deleted, b.ID, orDash(b.Node))
+	}
+	fmt.Fprintf(w, "%s %d sessions, %s %d browsers\n", stopped, len(result.Stopped), deleted, len(result.Deleted))
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
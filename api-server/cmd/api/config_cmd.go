@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"api-server/internal/config"
+)
+
+// printConfig writes the effective configuration as YAML to stdout, with
+// secrets redacted, and any validation errors to stderr. It returns the exit
+// code: 1 when the configuration is invalid.
+func printConfig(stdout, stderr io.Writer, path string) int {
+	cfg, err := config.Load(path)
+
+	out, marshalErr := yaml.Marshal(cfg.Redacted())
+	if marshalErr != nil {
+		fmt.Fprintf(stderr, "failed to print configuration: %v\n", marshalErr)
+		return 1
+	}
+	stdout.Write(out)
+
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
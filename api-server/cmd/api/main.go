@@ -2,15 +2,20 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"api-server/internal/config"
 	"api-server/internal/database"
+	"api-server/internal/logging"
 	"api-server/internal/server"
+	"api-server/internal/tracing"
 )
 
 // serverInterface defines the methods we use from http.Server
@@ -18,17 +23,23 @@ import (
 type serverInterface interface {
 	ListenAndServe() error
 	Shutdown(ctx context.Context) error
+	// StartDraining makes the readiness probe fail ahead of shutdown
+	StartDraining()
 }
 
 // ServerConfig holds configuration for the server
 type ServerConfig struct {
 	ShutdownTimeout time.Duration
+	// DrainDelay is how long the server keeps serving after reporting not
+	// ready, so load balancers stop routing to it before it shuts down
+	DrainDelay time.Duration
 }
 
-// DefaultServerConfig provides default configuration values
-func DefaultServerConfig() ServerConfig {
+// NewServerConfig returns the shutdown settings of cfg
+func NewServerConfig(cfg config.Server) ServerConfig {
 	return ServerConfig{
-		ShutdownTimeout: 5 * time.Second,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		DrainDelay:      cfg.DrainDelay,
 	}
 }
 
@@ -51,63 +62,168 @@ var waitForSignal = func() context.Context {
 	return ctx
 }
 
-// gracefulShutdown handles the server shutdown process
-func gracefulShutdown(apiServer serverInterface, done chan bool, config ServerConfig, ctx context.Context) {
+// gracefulShutdown handles the server shutdown process. It sends done the
+// deadline the whole shutdown, including what follows it in serve, must
+// finish by.
+func gracefulShutdown(apiServer serverInterface, done chan time.Time, serverConfig ServerConfig, ctx context.Context) {
 	// Listen for the interrupt signal.
 	<-ctx.Done()
 
-	log.Println("shutting down gracefully, press Ctrl+C again to force")
+	slog.Info("Shutting down gracefully, press Ctrl+C again to force", "drain_delay", serverConfig.DrainDelay.String())
+
+	// Fail readiness first and keep serving while load balancers notice
+	apiServer.StartDraining()
+	time.Sleep(serverConfig.DrainDelay)
 
 	// The context is used to inform the server it has configured time to finish
 	// the request it is currently handling
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	deadline := time.Now().Add(serverConfig.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
 	defer cancel()
 
 	if err := apiServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server forced to shutdown with error: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exiting")
+	slog.Info("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
-	done <- true
+	done <- deadline
 }
 
 // runServerFunc defines function type for running the server
-type runServerFunc func(srv serverInterface, config ServerConfig, signalCtx context.Context) error
+type runServerFunc func(srv serverInterface, serverConfig ServerConfig, signalCtx context.Context) (time.Time, error)
 
-// runServer is the default implementation for starting the server and handling shutdown
-var runServer = func(srv serverInterface, config ServerConfig, signalCtx context.Context) error {
+// runServer is the default implementation for starting the server and handling
+// shutdown. It returns the deadline for the rest of the shutdown.
+var runServer = func(srv serverInterface, serverConfig ServerConfig, signalCtx context.Context) (time.Time, error) {
 	// Create a done channel to signal when the shutdown is complete
-	done := make(chan bool, 1)
+	done := make(chan time.Time, 1)
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(srv, done, config, signalCtx)
+	go gracefulShutdown(srv, done, serverConfig, signalCtx)
 
 	// Start the server
 	err := srv.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
-		return fmt.Errorf("http server error: %s", err)
+		return time.Time{}, fmt.Errorf("http server error: %s", err)
 	}
 
 	// Wait for the graceful shutdown to complete
-	<-done
-	log.Println("Graceful shutdown complete.")
-	return nil
+	deadline := <-done
+	slog.Info("Graceful shutdown complete")
+	return deadline, nil
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func main() {
-	db, err := database.New()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file`, overridden by the environment")
+	flag.Usage = usage
+	flag.Parse()
+
+	switch command := flag.Arg(0); command {
+	case "", "serve":
+		serve(loadConfig(*configPath))
+	case "config":
+		os.Exit(printConfig(os.Stdout, os.Stderr, *configPath))
+	case "migrate":
+		os.Exit(runMigrate(os.Stdout, os.Stderr, *configPath, flag.Args()[1:]))
+	case "users", "sessions", "reap", "reconcile":
+		os.Exit(runAdmin(os.Stdin, os.Stdout, os.Stderr, *configPath, flag.Args()))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// usage prints the commands and flags
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] [command]
+
+Commands:
+  serve    run the API server (default)
+  config   print the configuration with secrets redacted and validate it
+  migrate  apply, revert or inspect database migrations: up, down, status
+           or force
+
+Admin commands, run against the configured database and browser servers:
+  users      create, disable or list users
+  sessions   list sessions, or stop a user's sessions
+  reap       expire, fail and purge sessions as the background jobs do
+  reconcile  reconcile sessions with the browsers actually running
+
+Run an admin command without arguments for its usage.
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// loadConfig loads the configuration, exiting with every problem found when
+// it is invalid
+func loadConfig(path string) *config.Config {
+	cfg, err := config.Load(path)
 	if err != nil {
-		log.Fatal(fmt.Errorf("failed to initialize database: %w", err))
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
-	srv, err := server.NewServer(db)
+	return cfg
+}
+
+// serve runs the API server until it is signalled to shut down
+func serve(cfg *config.Config) {
+	if err := logging.Setup(os.Stdout, cfg.Logging.Level, cfg.Logging.Levels); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Telemetry.TracesExporter, cfg.Telemetry.MetricsExporter)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		fatal("Failed to initialize database", err)
+	}
+	if cfg.Database.AutoMigrate {
+		// Instances starting together take turns under the migration lock
+		applied, err := database.NewMigrator(db.DB()).Up(context.Background(), 0)
+		if err != nil {
+			fatal("Failed to apply migrations", err)
+		}
+		slog.Info("Database schema is up to date", "version", database.LatestSchemaVersion, "applied", len(applied))
+	}
+	srv, err := server.NewServer(db, cfg)
 	if err != nil {
-		log.Fatal(fmt.Errorf("failed to create server: %w", err))
+		fatal("Failed to create server", err)
 	}
-	config := DefaultServerConfig()
+	srv.StartBackgroundJobs()
+	serverConfig := NewServerConfig(cfg.Server)
 	signalCtx := waitForSignal()
-	if err := runServer(srv, config, signalCtx); err != nil {
-		log.Fatal(err)
+	deadline, err := runServer(srv, serverConfig, signalCtx)
+	if err != nil {
+		fatal("Server failed", err)
+	}
+
+	// Stop background jobs, apply the session shutdown policy and close the
+	// database within what is left of the shutdown timeout
+	stopCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := srv.Stop(stopCtx); err != nil {
+		slog.Warn("Server did not stop cleanly", "error", err)
+	}
+
+	// Flush spans and metrics still buffered for export, including the
+	// shutdown's own spans
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush traces and metrics", "error", err)
 	}
 }
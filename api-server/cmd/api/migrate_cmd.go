@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"api-server/internal/config"
+	"api-server/internal/database"
+	"api-server/internal/logging"
+)
+
+const migrateUsage = `Usage: %s migrate <command>
+
+Commands:
+  up [N]         apply all pending migrations, or the next N
+  down [N]       revert the latest migration, or the latest N
+  status         print the schema version and every migration
+  force VERSION  record VERSION as the schema version without migrating,
+                 once a failed migration has been repaired by hand
+`
+
+// runMigrate runs a migrate command against the configured database and
+// returns the exit code
+func runMigrate(stdout, stderr io.Writer, configPath string, args []string) int {
+	if len(args) == 0 || !slices.Contains([]string{"up", "down", "status", "force"}, args[0]) {
+		fmt.Fprintf(stderr, migrateUsage, os.Args[0])
+		return 2
+	}
+
+	cfg, err := config.Read(configPath)
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if err := logging.Setup(stderr, cfg.Logging.Level, cfg.Logging.Levels); err != nil {
+		fmt.Fprintf(stderr, "failed to set up logging: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := migrate(ctx, stdout, database.NewMigrator(db.DB()), args); err != nil {
+		fmt.Fprintf(stderr, "migrate %s: %v\n", args[0], err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, migrateUsage, os.Args[0])
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// errUsage reports a malformed migrate command
+var errUsage = errors.New("invalid arguments")
+
+// migrate runs one migrate command
+func migrate(ctx context.Context, w io.Writer, m *database.Migrator, args []string) error {
+	command, args := args[0], args[1:]
+	// count parses the optional N of up and down
+	count := func(defaultVal int) (int, error) {
+		switch len(args) {
+		case 0:
+			return defaultVal, nil
+		case 1:
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%w: N must be a positive number, not %q", errUsage, args[0])
+			}
+			return n, nil
+		default:
+			return 0, errUsage
+		}
+	}
+
+	switch command {
+	case "up":
+		n, err := count(0)
+		if err != nil {
+			return err
+		}
+		applied, err := m.Up(ctx, n)
+		for _, migration := range applied {
+			fmt.Fprintf(w, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return err
+	case "down":
+		n, err := count(1)
+		if err != nil {
+			return err
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, migration := range reverted {
+			fmt.Fprintf(w, "reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return printMigrationStatus(ctx, w, m)
+	case "force":
+		if len(args) != 1 {
+			return errUsage
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			return fmt.Errorf("%w: VERSION must be a migration version or 0, not %q", errUsage, args[0])
+		}
+		if err := m.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "schema version set to %d\n", version)
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, command)
+	}
+}
+
+// printMigrationStatus prints the schema version and a table of migrations
+func printMigrationStatus(ctx context.Context, w io.Writer, m *database.Migrator) error {
+	version, dirty, statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	state := "clean"
+	if dirty {
+		state = "dirty"
+	}
+	fmt.Fprintf(w, "schema version %d (%s), latest %d\n\n", version, state, database.LatestSchemaVersion)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.Applied {
+			applied = "applied"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -1,47 +1,43 @@
 package auth
 
 import (
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	_ "github.com/joho/godotenv/autoload"
-)
 
-var (
-	secretKey = []byte(os.Getenv("JWT_SECRET"))
-	expiryDur = parseExpiry(os.Getenv("JWT_EXPIRY"))
+	"api-server/internal/config"
 )
 
-func parseExpiry(s string) time.Duration {
-	d, err := time.ParseDuration(s)
-	if err != nil {
-		return 24 * time.Hour
-	}
-	return d
+// Tokens issues and validates the JWTs users authenticate with
+type Tokens struct {
+	secretKey []byte
+	expiryDur time.Duration
 }
 
-// TokenGeneratorFunc is a function type for token generation
-type TokenGeneratorFunc func(userID string) (string, error) 
+// New returns Tokens signed with the configured secret and lasting the
+// configured expiry
+func New(cfg config.Auth) *Tokens {
+	return &Tokens{
+		secretKey: []byte(cfg.JWTSecret),
+		expiryDur: cfg.JWTExpiry,
+	}
+}
 
-// GenerateToken creates a JWT containing the user ID.
-var GenerateToken TokenGeneratorFunc = func(userID string) (string, error) {
+// Generate creates a JWT containing the user ID.
+func (t *Tokens) Generate(userID string) (string, error) {
 	claims := jwt.RegisteredClaims{
 		Subject:   userID,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiryDur)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(t.expiryDur)),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+	return token.SignedString(t.secretKey)
 }
 
-// TokenValidatorFunc is a function type for token validation
-type TokenValidatorFunc func(tkn string) (*jwt.RegisteredClaims, error)
-
-// ValidateToken parses and validates the token string.
-var ValidateToken TokenValidatorFunc = func(tkn string) (*jwt.RegisteredClaims, error) {
+// Validate parses and validates the token string.
+func (t *Tokens) Validate(tkn string) (*jwt.RegisteredClaims, error) {
 	parsed, err := jwt.ParseWithClaims(tkn, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
+		return t.secretKey, nil
 	})
 	if err != nil {
 		return nil, err
@@ -50,4 +46,4 @@ var ValidateToken TokenValidatorFunc = func(tkn string) (*jwt.RegisteredClaims,
 		return claims, nil
 	}
 	return nil, jwt.ErrTokenInvalidClaims
-}
\ No newline at end of file
+}
@@ -0,0 +1,95 @@
+package browser
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"api-server/internal/config"
+)
+
+func TestClientSignsRequests(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	var nonces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, nonce := r.Header.Get(headerTimestamp), r.Header.Get(headerNonce)
+		want := signature("secret", r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+		if r.Header.Get(headerSignature) != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Fail the first attempt so the retry must be signed afresh
+		nonces = append(nonces, nonce)
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"sessions": []}`))
+	}))
+	defer srv.Close()
+
+	client := newHTTPClient(srv.URL, testSettings(t))
+	client.settings.secret = "secret"
+	_, err := client.ListSessions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, nonces, 2)
+	require.NotEqual(t, nonces[0], nonces[1])
+
+	client.settings.secret = "wrong"
+	_, err = client.ListSessions(context.Background())
+	var serverErr *ServerError
+	require.ErrorAs(t, err, &serverErr)
+	require.Equal(t, http.StatusUnauthorized, serverErr.StatusCode)
+}
+
+func TestNewTransportTrustsCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	// The test server's certificate is only trusted through the CA file
+	transport, err := newTransport("", "", "")
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(srv.URL)
+	require.Error(t, err)
+
+	transport, err = newTransport(caFile, "", "")
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = newTransport(caFile, "client.pem", "")
+	require.Error(t, err)
+	_, err = newTransport(filepath.Join(t.TempDir(), "missing.pem"), "", "")
+	require.Error(t, err)
+}
+
+func TestNewRejectsBadTLSFiles(t *testing.T) {
+	emptyCA := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(emptyCA, []byte("not a certificate"), 0o600))
+
+	for _, cfg := range []config.Browser{
+		{TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{TLSCAFile: emptyCA},
+		{TLSCertFile: "client.pem", TLSKeyFile: filepath.Join(t.TempDir(), "missing.key")},
+	} {
+		_, err := New(cfg)
+		require.ErrorContains(t, err, "invalid browser server TLS settings")
+	}
+}
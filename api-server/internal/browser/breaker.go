@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by the error returned while a browser server's
+// circuit breaker is failing calls fast
+var ErrCircuitOpen = errors.New("browser server circuit open")
+
+// CircuitOpenError is returned instead of calling a browser server that has
+// recently failed repeatedly
+type CircuitOpenError struct {
+	URL string
+	// RetryAfter is how long until the breaker lets a trial call through
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("browser server %s unavailable: circuit open, retry in %s", e.URL, e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is match both ErrCircuitOpen and ErrUnavailable
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen || target == ErrUnavailable
+}
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker is a consecutive-failure circuit breaker. After threshold failures
+// in a row it opens and rejects calls for cooldown, then lets a single trial
+// call through; the trial's outcome closes or re-opens it.
+type breaker struct {
+	mu        sync.Mutex
+	url       string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newBreaker(url string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{url: url, threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// state returns the breaker state. Callers must hold mu.
+func (b *breaker) state() string {
+	switch {
+	case b.threshold <= 0 || b.failures < b.threshold:
+		return BreakerClosed
+	case b.now().Before(b.openedAt.Add(b.cooldown)):
+		return BreakerOpen
+	default:
+		return BreakerHalfOpen
+	}
+}
+
+// State returns the current breaker state
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// allow returns a *CircuitOpenError if the call must not be made
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case BreakerOpen:
+		return &CircuitOpenError{URL: b.url, RetryAfter: b.openedAt.Add(b.cooldown).Sub(b.now())}
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{URL: b.url}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// abandon reports that the caller of a call let through by allow gave up on
+// it, which says nothing about the browser server. It frees a trial call's
+// slot for the next caller without counting an outcome.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record reports the outcome of a call let through by allow
+func (b *breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
@@ -3,59 +3,178 @@ package browser
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
-	"os"
 	"strings"
+	"syscall"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"api-server/internal/config"
+	"api-server/internal/logging"
+	"api-server/internal/tracing"
 )
 
+// logger is the browser package's logger
+var logger = logging.For("browser")
+
 // Client for interacting with the browser server
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	breaker    *breaker
+	settings   clientSettings
 }
 
 // BrowserClient defines the interface for browser operations
 type BrowserClient interface {
 	CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error)
+	GetSession(ctx context.Context, sessionID string) (*SessionResponse, error)
+	ListSessions(ctx context.Context) ([]*SessionResponse, error)
 	DeleteSession(ctx context.Context, sessionID string) error
+	UpdateEmulation(ctx context.Context, sessionID string, emulation Emulation) (*SessionResponse, error)
+}
+
+// Browser backends selectable with BROWSER_BACKEND
+const (
+	BackendHTTP = "http"
+	BackendFake = "fake"
+)
+
+// Backend is the configured browser backend: either a pool of browser server
+// nodes or the in-memory fake. It hands out the clients sessions are
+// launched and managed with.
+type Backend struct {
+	name string
+	// pool is set for the http backend
+	pool *Pool
+	// fake is set for the fake backend; it is shared so sessions outlive the
+	// per-request clients handlers use
+	fake *FakeClient
 }
 
-// NewClientFunc is the function type for creating a new browser client
-type NewClientFunc func() BrowserClient
+// New returns the backend selected by cfg. It fails when the TLS files for
+// the browser servers can't be loaded.
+func New(cfg config.Browser) (*Backend, error) {
+	if cfg.Backend == BackendFake {
+		logger.Info("Using in-memory fake browser backend", "max_sessions", cfg.FakeMaxSessions)
+		return NewFakeBackend(NewFakeClient(cfg.FakeMaxSessions)), nil
+	}
 
-// defaultNewClient is the default implementation for creating a new browser client
-func defaultNewClient() BrowserClient {
-	// Get base URL from environment or use default
-	baseURL := os.Getenv("BROWSER_SERVER_URL")
-	if baseURL == "" {
-		baseURL = "http://browser:8000"
+	pool, err := NewPool(cfg)
+	if err != nil {
+		return nil, err
 	}
+	logger.Info("Connecting to browser servers", "nodes", pool.urls())
+	return &Backend{name: BackendHTTP, pool: pool}, nil
+}
 
-	// Log the URL we're using
-	log.Printf("Connecting to browser server at %s", baseURL)
+// NewFakeBackend returns a fake backend serving every session from fake
+func NewFakeBackend(fake *FakeClient) *Backend {
+	return &Backend{name: BackendFake, fake: fake}
+}
 
-	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// Name returns the backend's BROWSER_BACKEND value
+func (b *Backend) Name() string {
+	return b.name
+}
+
+// Pool returns the pool of browser server nodes, or nil for the fake backend
+func (b *Backend) Pool() *Pool {
+	return b.pool
+}
+
+// Client returns the client for new sessions. Over HTTP it is the node pool,
+// which places new sessions on the least-loaded healthy node.
+func (b *Backend) Client() BrowserClient {
+	if b.fake != nil {
+		return b.fake
 	}
+	return b.pool
 }
 
-// NewClient is the exported function variable for creating browser clients
-var NewClient NewClientFunc = defaultNewClient
+// NodeClient returns a client for the node recorded on a session, or the
+// default client when the node isn't known
+func (b *Backend) NodeClient(node string) BrowserClient {
+	if node == "" || b.fake != nil {
+		return b.Client()
+	}
+	return b.pool.Node(node)
+}
+
+// clientSettings are the browser server request settings every Client of a
+// pool shares
+type clientSettings struct {
+	transport *http.Transport
+	// secret signs requests when set
+	secret string
+	// createTimeout bounds a session launch, which can take several seconds
+	createTimeout time.Duration
+	// requestTimeout bounds every other browser server call
+	requestTimeout time.Duration
+	// maxRetries is how many times idempotent calls are retried
+	maxRetries int
+	// breakerThreshold is how many consecutive failures open the circuit
+	// breaker; zero or less disables it
+	breakerThreshold int
+	// breakerCooldown is how long an open breaker fails calls fast
+	breakerCooldown time.Duration
+}
+
+// newClientSettings returns the request settings of cfg. It fails when the
+// TLS files can't be loaded.
+func newClientSettings(cfg config.Browser) (clientSettings, error) {
+	transport, err := newTransport(cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return clientSettings{}, fmt.Errorf("invalid browser server TLS settings: %w", err)
+	}
+	return clientSettings{
+		transport:        transport,
+		secret:           cfg.Secret,
+		createTimeout:    cfg.CreateTimeout,
+		requestTimeout:   cfg.RequestTimeout,
+		maxRetries:       cfg.MaxRetries,
+		breakerThreshold: cfg.BreakerThreshold,
+		breakerCooldown:  cfg.BreakerCooldown,
+	}, nil
+}
+
+// newHTTPClient returns a Client for the browser server at baseURL. Requests
+// are bounded by per-operation timeouts rather than an http.Client timeout,
+// and signed with BROWSER_SERVER_SECRET when it is set.
+func newHTTPClient(baseURL string, settings clientSettings) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Transport: settings.transport},
+		breaker:    newBreaker(baseURL, settings.breakerThreshold, settings.breakerCooldown),
+		settings:   settings,
+	}
+}
 
 // CreateSessionRequest represents the parameters for creating a browser session
 type CreateSessionRequest struct {
-	BrowserType  string        `json:"browser_type"`
-	Headless     bool          `json:"headless"`
-	ViewportSize *ViewportSize `json:"viewport_size,omitempty"`
-	UserAgent    *string       `json:"user_agent,omitempty"`
-	Timeout      *int          `json:"timeout,omitempty"`
+	BrowserType  string         `json:"browser_type"`
+	Headless     bool           `json:"headless"`
+	ViewportSize *ViewportSize  `json:"viewport_size,omitempty"`
+	UserAgent    *string        `json:"user_agent,omitempty"`
+	Timeout      *int           `json:"timeout,omitempty"`
+	Proxy        *ProxySettings `json:"proxy,omitempty"`
+	Emulation    *Emulation     `json:"emulation,omitempty"`
+	// DeviceMetrics is set when the session was created from a device preset
+	DeviceMetrics *DeviceMetrics `json:"device_metrics,omitempty"`
 }
 
 // ViewportSize represents browser viewport dimensions
@@ -74,11 +193,10 @@ type SessionResponse struct {
 	CdpURL       string       `json:"cdp_url"`
 	ViewportSize ViewportSize `json:"viewport_size"`
 	UserAgent    *string      `json:"user_agent,omitempty"`
-}
-
-// ErrorResponse represents an error from the browser server
-type ErrorResponse struct {
-	Detail string `json:"detail"`
+	Emulation    *Emulation   `json:"emulation,omitempty"`
+	// Node is the base URL of the browser server hosting the session. It is
+	// set by the pool rather than reported by the browser server.
+	Node string `json:"-"`
 }
 
 // FlexibleTime is a custom time type that can handle multiple time formats
@@ -132,69 +250,321 @@ func (ft FlexibleTime) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%s\"", t.Format(time.RFC3339))), nil
 }
 
-// CreateSession creates a new browser session
-func (c *Client) CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error) {
-	// Marshal request to JSON
-	reqBytes, err := json.Marshal(req)
+// retryBaseDelay is the backoff before the first retry, doubling after
+var retryBaseDelay = 200 * time.Millisecond
+
+// BreakerState returns the state of the client's circuit breaker
+func (c *Client) BreakerState() string {
+	return c.breaker.State()
+}
+
+// retryable reports whether a failed attempt may succeed if repeated: the
+// request was lost in transport, or a proxy in front of the browser server
+// reported it unavailable
+func retryable(resp *response, err error) bool {
+	if err != nil {
+		return transportError(err)
+	}
+	return resp.status == http.StatusBadGateway || resp.status == http.StatusServiceUnavailable || resp.status == http.StatusGatewayTimeout
+}
+
+// transportError reports whether err is a failure to reach the browser server
+// or to hear back from it, such as a refused or reset connection or a timeout.
+// Requests that could never succeed, e.g. ones that fail TLS verification or
+// can't be signed, aren't.
+func transportError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &certErr), errors.As(err, &alertErr), errors.As(err, &recordErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return true
+	}
+	var opErr *net.OpError
+	var netErr net.Error
+	return errors.As(err, &opErr) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// retryDelay returns the jittered backoff before retry attempt n (from 1)
+func retryDelay(n int) time.Duration {
+	d := retryBaseDelay << (n - 1)
+	return d/2 + rand.N(d/2+1)
+}
+
+// response is a browser server response read in full
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+	// forSession is set for requests addressing a single session by ID
+	forSession bool
+}
+
+// do sends a request through the circuit breaker, with timeout applied to
+// each attempt. GET and DELETE requests are retried with backoff when
+// retryable. Requests that get no response fail with ErrUnavailable, unless
+// ctx ended first. The call is traced as a span named after op.
+func (c *Client) do(ctx context.Context, op, method, path string, timeout time.Duration, body any) (resp *response, err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "browser."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLFull(c.baseURL+path),
+	))
+	if id := logging.RequestID(ctx); id != "" {
+		span.SetAttributes(attribute.String("request.id", id))
+	}
+	started := time.Now()
+	defer func() {
+		callErr := err
+		if resp != nil {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(resp.status))
+			if resp.status >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(resp.status))
+				callErr = parseServerError(resp)
+			}
+		}
+		observeCall(op, c.baseURL, started, callErr)
+		tracing.End(span, err)
+	}()
+
+	var reqBytes []byte
+	if body != nil {
+		var err error
+		if reqBytes, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodDelete {
+		attempts += max(c.settings.maxRetries, 0)
+	}
+
+	for n := range attempts {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryDelay(n)):
+			}
+		}
+
+		if err := c.breaker.allow(); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", n+1)))
+		}
+		resp, err = c.attempt(ctx, method, path, timeout, reqBytes)
+		failed := retryable(resp, err)
+		if ctx.Err() == nil && (err == nil || failed) {
+			c.breaker.record(!failed)
+		} else {
+			// A caller giving up, or a request that could never succeed, says
+			// nothing about the browser server
+			c.breaker.abandon()
+		}
+		if !failed {
+			break
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal create session request: %w", err)
+		// The caller gave up, which says nothing about the browser server
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrUnavailable, err)
+	}
+	return resp, nil
+}
+
+// attempt makes a single request and reads the whole response body
+func (c *Client) attempt(ctx context.Context, method, path string, timeout time.Duration, reqBytes []byte) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if reqBytes != nil {
+		reqBody = bytes.NewReader(reqBytes)
 	}
 
 	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/sessions", bytes.NewBuffer(reqBytes))
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	if reqBody != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		httpReq.Header.Set("X-Request-ID", id)
+	}
+	// Continue the trace on the browser server
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	if c.settings.secret != "" {
+		if err := signRequest(httpReq, reqBytes, c.settings.secret, time.Now()); err != nil {
+			return nil, err
+		}
+	}
 
 	// Send request
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Handle error
-	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return nil, fmt.Errorf("received non-OK status %d and failed to decode error response", resp.StatusCode)
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &response{
+		status:     resp.StatusCode,
+		header:     resp.Header,
+		body:       respBytes,
+		forSession: strings.HasPrefix(path, "/sessions/"),
+	}, nil
+}
+
+// CreateSession creates a new browser session. It is never retried, since a
+// launch that timed out may still have started a browser.
+func (c *Client) CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error) {
+	resp, err := c.do(ctx, "CreateSession", http.MethodPost, "/sessions", c.settings.createTimeout, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK {
+		return nil, parseServerError(resp)
+	}
+
+	// Decode response
+	var session SessionResponse
+	if err := json.Unmarshal(resp.body, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session response: %w", err)
+	}
+
+	return &session, nil
+}
+
+// HealthResponse is the health and capacity report of a browser server
+type HealthResponse struct {
+	Status         string `json:"status"`
+	ActiveSessions int    `json:"active_sessions"`
+	MaxSessions    int    `json:"max_sessions"`
+}
+
+// Health reports the browser server's health and capacity. While the circuit
+// breaker is half-open the health check serves as its trial call.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	resp, err := c.attempt(ctx, http.MethodGet, "/health", c.settings.requestTimeout, nil)
+	if ctx.Err() == nil && (err == nil || transportError(err)) {
+		c.breaker.record(err == nil && resp.status < http.StatusInternalServerError)
+	} else {
+		c.breaker.abandon()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
 		}
-		return nil, fmt.Errorf("browser server error: %s (status code %d)", errResp.Detail, resp.StatusCode)
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrUnavailable, err)
+	}
+	if resp.status != http.StatusOK {
+		return nil, fmt.Errorf("browser server health check failed (status code %d)", resp.status)
+	}
+
+	// Decode response
+	var health HealthResponse
+	if err := json.Unmarshal(resp.body, &health); err != nil {
+		return nil, fmt.Errorf("failed to decode health response: %w", err)
+	}
+
+	return &health, nil
+}
+
+// SessionListResponse is the list of sessions returned by the browser server
+type SessionListResponse struct {
+	Sessions []*SessionResponse `json:"sessions"`
+}
+
+// GetSession retrieves a browser session. It returns ErrSessionNotFound if the
+// browser server doesn't know the session, e.g. because it expired.
+func (c *Client) GetSession(ctx context.Context, sessionID string) (*SessionResponse, error) {
+	resp, err := c.do(ctx, "GetSession", http.MethodGet, "/sessions/"+sessionID, c.settings.requestTimeout, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK {
+		return nil, parseServerError(resp)
 	}
 
 	// Decode response
 	var session SessionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+	if err := json.Unmarshal(resp.body, &session); err != nil {
 		return nil, fmt.Errorf("failed to decode session response: %w", err)
 	}
 
 	return &session, nil
 }
 
-// DeleteSession deletes a browser session
+// ListSessions lists the active browser sessions
+func (c *Client) ListSessions(ctx context.Context) ([]*SessionResponse, error) {
+	resp, err := c.do(ctx, "ListSessions", http.MethodGet, "/sessions", c.settings.requestTimeout, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status != http.StatusOK {
+		return nil, parseServerError(resp)
+	}
+
+	// Decode response
+	var list SessionListResponse
+	if err := json.Unmarshal(resp.body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode session list response: %w", err)
+	}
+
+	return list.Sessions, nil
+}
+
+// DeleteSession deletes a browser session. It returns ErrSessionNotFound if
+// the browser server doesn't know the session.
 func (c *Client) DeleteSession(ctx context.Context, sessionID string) error {
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("%s/sessions/%s", c.baseURL, sessionID), nil)
+	resp, err := c.do(ctx, "DeleteSession", http.MethodDelete, "/sessions/"+sessionID, c.settings.requestTimeout, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+		return err
+	}
+	if resp.status != http.StatusOK {
+		return parseServerError(resp)
 	}
 
-	// Send request
-	resp, err := c.httpClient.Do(httpReq)
+	return nil
+}
+
+// UpdateEmulation replaces the emulation overrides of a running browser session
+func (c *Client) UpdateEmulation(ctx context.Context, sessionID string, emulation Emulation) (*SessionResponse, error) {
+	resp, err := c.do(ctx, "UpdateEmulation", http.MethodPut, "/sessions/"+sessionID+"/emulation", c.settings.requestTimeout, emulation)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, err
+	}
+	if resp.status != http.StatusOK {
+		return nil, parseServerError(resp)
 	}
-	defer resp.Body.Close()
 
-	// Handle error
-	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return fmt.Errorf("received non-OK status %d and failed to decode error response", resp.StatusCode)
-		}
-		return fmt.Errorf("browser server error: %s (status code %d)", errResp.Detail, resp.StatusCode)
+	// Decode response
+	var session SessionResponse
+	if err := json.Unmarshal(resp.body, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session response: %w", err)
 	}
 
-	return nil
+	return &session, nil
 }
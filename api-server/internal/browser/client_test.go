@@ -0,0 +1,218 @@
+package browser
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"api-server/internal/config"
+	"api-server/internal/logging"
+)
+
+// testSettings returns the request settings of the default configuration
+func testSettings(t *testing.T) clientSettings {
+	settings, err := newClientSettings(config.Default().Browser)
+	require.NoError(t, err)
+	return settings
+}
+
+// newFlakyServer fails the first failures requests with 503
+func newFlakyServer(t *testing.T, failures int32) (*atomic.Int32, *httptest.Server) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"sessions": []}`))
+	}))
+	t.Cleanup(srv.Close)
+	return &calls, srv
+}
+
+func TestClientRetriesIdempotentCalls(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	calls, srv := newFlakyServer(t, 2)
+	_, err := newHTTPClient(srv.URL, testSettings(t)).ListSessions(context.Background())
+	require.NoError(t, err)
+	require.EqualValues(t, 3, calls.Load())
+
+	// Session launches are never retried
+	calls, srv = newFlakyServer(t, 1)
+	_, err = newHTTPClient(srv.URL, testSettings(t)).CreateSession(context.Background(), CreateSessionRequest{})
+	require.Error(t, err)
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestClientReportsAbandonedCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+
+	// A caller giving up isn't the browser server being unavailable
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := newHTTPClient(srv.URL, testSettings(t)).GetSession(ctx, "abc")
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotErrorIs(t, err, ErrUnavailable)
+}
+
+func TestOnlyTransportErrorsAreRetried(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Get", URL: "http://browser:8000", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, true},
+		{&url.Error{Op: "Get", URL: "http://browser:8000", Err: context.DeadlineExceeded}, true},
+		{fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF), true},
+		{&url.Error{Op: "Get", URL: "https://browser:8000", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, false},
+		{errors.New("failed to sign request"), false},
+		{context.Canceled, false},
+	} {
+		require.Equal(t, tc.want, retryable(nil, tc.err), tc.err.Error())
+	}
+
+	// A browser server whose certificate isn't trusted is tried once and
+	// doesn't trip the breaker
+	var handshakes atomic.Int32
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		handshakes.Add(1)
+		return nil, nil
+	}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	client := newHTTPClient(srv.URL, testSettings(t))
+	client.breaker.threshold = 1
+	_, err := client.ListSessions(context.Background())
+	require.Error(t, err)
+	require.EqualValues(t, 1, handshakes.Load())
+	require.Equal(t, BreakerClosed, client.BreakerState())
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	b := newBreaker("http://browser:8000", 2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	for range 2 {
+		require.NoError(t, b.allow())
+		b.record(false)
+	}
+	require.Equal(t, BreakerOpen, b.State())
+	err := b.allow()
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	var open *CircuitOpenError
+	require.ErrorAs(t, err, &open)
+	require.Equal(t, time.Minute, open.RetryAfter)
+
+	// After the cooldown a single trial call is let through
+	now = now.Add(time.Minute)
+	require.Equal(t, BreakerHalfOpen, b.State())
+	require.NoError(t, b.allow())
+	require.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	b.record(true)
+	require.Equal(t, BreakerClosed, b.State())
+	require.NoError(t, b.allow())
+}
+
+func TestClientFailsFastWhileBreakerOpen(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	calls, srv := newFlakyServer(t, 100)
+	settings := testSettings(t)
+	settings.maxRetries = 0
+	client := newHTTPClient(srv.URL, settings)
+	client.breaker.threshold = 2
+
+	for range 2 {
+		_, err := client.ListSessions(context.Background())
+		require.Error(t, err)
+	}
+	_, err := client.ListSessions(context.Background())
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.EqualValues(t, 2, calls.Load())
+	require.Equal(t, BreakerOpen, client.BreakerState())
+}
+
+func TestBreakerSurvivesAbandonedTrialCall(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := newHTTPClient(srv.URL, testSettings(t))
+	client.breaker.threshold = 1
+	client.breaker.record(false)
+	client.breaker.openedAt = time.Now().Add(-time.Hour)
+	require.Equal(t, BreakerHalfOpen, client.BreakerState())
+
+	// The trial call's caller gives up before the browser server answers
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Health(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotErrorIs(t, err, ErrCircuitOpen)
+	require.NotErrorIs(t, err, ErrUnavailable)
+	require.Equal(t, BreakerHalfOpen, client.BreakerState())
+
+	// The next caller gets the trial call, which closes the breaker
+	slow.Store(false)
+	_, err = client.Health(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, BreakerClosed, client.BreakerState())
+}
+
+func TestClientTracesCalls(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var traceparent, requestID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		requestID = r.Header.Get("X-Request-ID")
+		w.Write([]byte(`{"sessions": []}`))
+	}))
+	defer srv.Close()
+
+	_, err := newHTTPClient(srv.URL, testSettings(t)).ListSessions(logging.WithRequestID(context.Background(), "req-1"))
+	require.NoError(t, err)
+	require.Equal(t, "req-1", requestID)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "browser.ListSessions", spans[0].Name())
+	require.Contains(t, traceparent, spans[0].SpanContext().TraceID().String())
+	require.Contains(t, traceparent, spans[0].SpanContext().SpanID().String())
+}
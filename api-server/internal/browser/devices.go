@@ -0,0 +1,175 @@
+package browser
+
+import (
+	"sort"
+	"strings"
+)
+
+// Device categories
+const (
+	DeviceCategoryPhone   = "phone"
+	DeviceCategoryTablet  = "tablet"
+	DeviceCategoryDesktop = "desktop"
+)
+
+// Device describes a device preset that can be selected when creating a session
+type Device struct {
+	Name              string       `json:"name"`
+	Category          string       `json:"category"`
+	Viewport          ViewportSize `json:"viewport"`
+	DeviceScaleFactor float64      `json:"device_scale_factor"`
+	IsMobile          bool         `json:"is_mobile"`
+	HasTouch          bool         `json:"has_touch"`
+	UserAgent         string       `json:"user_agent"`
+}
+
+// DeviceMetrics carries the device metrics override the browser server
+// applies at launch (Emulation.setDeviceMetricsOverride on Chromium)
+type DeviceMetrics struct {
+	DeviceScaleFactor float64 `json:"device_scale_factor"`
+	IsMobile          bool    `json:"is_mobile"`
+	HasTouch          bool    `json:"has_touch"`
+}
+
+// Metrics returns the device metrics override for this device
+func (d Device) Metrics() *DeviceMetrics {
+	return &DeviceMetrics{
+		DeviceScaleFactor: d.DeviceScaleFactor,
+		IsMobile:          d.IsMobile,
+		HasTouch:          d.HasTouch,
+	}
+}
+
+// builtinDevices is the registry of device presets, keyed by lower-cased name
+var builtinDevices = indexDevices([]Device{
+	// Phones
+	{
+		Name:              "iPhone 14",
+		Category:          DeviceCategoryPhone,
+		Viewport:          ViewportSize{Width: 390, Height: 664},
+		DeviceScaleFactor: 3,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1",
+	},
+	{
+		Name:              "iPhone 15 Pro",
+		Category:          DeviceCategoryPhone,
+		Viewport:          ViewportSize{Width: 393, Height: 659},
+		DeviceScaleFactor: 3,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+	},
+	{
+		Name:              "Pixel 7",
+		Category:          DeviceCategoryPhone,
+		Viewport:          ViewportSize{Width: 412, Height: 839},
+		DeviceScaleFactor: 2.625,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (Linux; Android 14; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+	},
+	{
+		Name:              "Galaxy S23",
+		Category:          DeviceCategoryPhone,
+		Viewport:          ViewportSize{Width: 360, Height: 780},
+		DeviceScaleFactor: 3,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (Linux; Android 14; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+	},
+	// Tablets
+	{
+		Name:              "iPad Mini",
+		Category:          DeviceCategoryTablet,
+		Viewport:          ViewportSize{Width: 768, Height: 1024},
+		DeviceScaleFactor: 2,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (iPad; CPU OS 16_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Mobile/15E148 Safari/604.1",
+	},
+	{
+		Name:              "iPad Pro 11",
+		Category:          DeviceCategoryTablet,
+		Viewport:          ViewportSize{Width: 834, Height: 1194},
+		DeviceScaleFactor: 2,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+	},
+	{
+		Name:              "Galaxy Tab S8",
+		Category:          DeviceCategoryTablet,
+		Viewport:          ViewportSize{Width: 800, Height: 1280},
+		DeviceScaleFactor: 2,
+		IsMobile:          true,
+		HasTouch:          true,
+		UserAgent:         "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	},
+	// Desktops
+	{
+		Name:              "Desktop Chrome",
+		Category:          DeviceCategoryDesktop,
+		Viewport:          ViewportSize{Width: 1280, Height: 720},
+		DeviceScaleFactor: 1,
+		UserAgent:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	},
+	{
+		Name:              "Desktop Chrome HiDPI",
+		Category:          DeviceCategoryDesktop,
+		Viewport:          ViewportSize{Width: 1280, Height: 720},
+		DeviceScaleFactor: 2,
+		UserAgent:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	},
+	{
+		Name:              "Desktop Firefox",
+		Category:          DeviceCategoryDesktop,
+		Viewport:          ViewportSize{Width: 1280, Height: 720},
+		DeviceScaleFactor: 1,
+		UserAgent:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	},
+	{
+		Name:              "Desktop Safari",
+		Category:          DeviceCategoryDesktop,
+		Viewport:          ViewportSize{Width: 1280, Height: 720},
+		DeviceScaleFactor: 2,
+		UserAgent:         "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	},
+	{
+		Name:              "Desktop 1080p",
+		Category:          DeviceCategoryDesktop,
+		Viewport:          ViewportSize{Width: 1920, Height: 1080},
+		DeviceScaleFactor: 1,
+		UserAgent:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	},
+})
+
+func indexDevices(devices []Device) map[string]Device {
+	index := make(map[string]Device, len(devices))
+	for _, d := range devices {
+		index[strings.ToLower(d.Name)] = d
+	}
+	return index
+}
+
+// Devices returns every built-in device preset sorted by category and name
+func Devices() []Device {
+	devices := make([]Device, 0, len(builtinDevices))
+	for _, d := range builtinDevices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Category != devices[j].Category {
+			return devices[i].Category < devices[j].Category
+		}
+		return devices[i].Name < devices[j].Name
+	})
+	return devices
+}
+
+// LookupDevice finds a device preset by name, ignoring case
+func LookupDevice(name string) (Device, bool) {
+	d, ok := builtinDevices[strings.ToLower(strings.TrimSpace(name))]
+	return d, ok
+}
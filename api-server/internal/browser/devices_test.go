@@ -0,0 +1,30 @@
+package browser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupDevice(t *testing.T) {
+	d, ok := LookupDevice("pixel 7")
+	require.True(t, ok)
+	require.Equal(t, "Pixel 7", d.Name)
+	require.True(t, d.IsMobile)
+
+	_, ok = LookupDevice("Nokia 3310")
+	require.False(t, ok)
+}
+
+func TestDevicesAreComplete(t *testing.T) {
+	devices := Devices()
+	require.NotEmpty(t, devices)
+	for _, d := range devices {
+		require.NotEmpty(t, d.Name)
+		require.Contains(t, []string{DeviceCategoryPhone, DeviceCategoryTablet, DeviceCategoryDesktop}, d.Category, d.Name)
+		require.Positive(t, d.Viewport.Width, d.Name)
+		require.Positive(t, d.Viewport.Height, d.Name)
+		require.Positive(t, d.DeviceScaleFactor, d.Name)
+		require.NotEmpty(t, d.UserAgent, d.Name)
+	}
+}
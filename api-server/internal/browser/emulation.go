@@ -0,0 +1,73 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	// Embed the timezone database so timezone validation works in minimal images
+	_ "time/tzdata"
+)
+
+// localePattern loosely matches BCP 47 language tags such as "de", "de-DE" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// colorSchemes lists the accepted prefers-color-scheme values
+var colorSchemes = map[string]bool{
+	"light":         true,
+	"dark":          true,
+	"no-preference": true,
+}
+
+// Emulation describes locale, timezone, geolocation and color-scheme overrides
+// applied to a browser session. On Chromium they are set over CDP on the page
+// the browser server created, so pages a client opens itself don't get them.
+type Emulation struct {
+	Locale      string       `json:"locale,omitempty"`
+	Timezone    string       `json:"timezone,omitempty"`
+	Geolocation *Geolocation `json:"geolocation,omitempty"`
+	ColorScheme string       `json:"color_scheme,omitempty"`
+}
+
+// Geolocation represents an emulated position
+type Geolocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy,omitempty"`
+}
+
+// IsZero reports whether no override is set
+func (e *Emulation) IsZero() bool {
+	return e == nil || (e.Locale == "" && e.Timezone == "" && e.Geolocation == nil && e.ColorScheme == "")
+}
+
+// Validate checks every override that is set
+func (e *Emulation) Validate() error {
+	var errs []error
+
+	if e.Locale != "" && !localePattern.MatchString(e.Locale) {
+		errs = append(errs, fmt.Errorf("invalid locale %q", e.Locale))
+	}
+	if e.Timezone != "" {
+		if _, err := time.LoadLocation(e.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("invalid timezone %q", e.Timezone))
+		}
+	}
+	if g := e.Geolocation; g != nil {
+		if g.Latitude < -90 || g.Latitude > 90 {
+			errs = append(errs, errors.New("latitude must be between -90 and 90"))
+		}
+		if g.Longitude < -180 || g.Longitude > 180 {
+			errs = append(errs, errors.New("longitude must be between -180 and 180"))
+		}
+		if g.Accuracy < 0 {
+			errs = append(errs, errors.New("accuracy must not be negative"))
+		}
+	}
+	if e.ColorScheme != "" && !colorSchemes[e.ColorScheme] {
+		errs = append(errs, fmt.Errorf("invalid color scheme %q: must be light, dark or no-preference", e.ColorScheme))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSessionNotFound is returned when the browser backend doesn't know a
+	// session, e.g. because it has expired
+	ErrSessionNotFound = errors.New("browser session not found")
+	// ErrAtCapacity is returned when the browser backend can't start another session
+	ErrAtCapacity = errors.New("browser server at capacity")
+	// ErrInvalidBrowserType is returned when the browser type can't be launched
+	ErrInvalidBrowserType = errors.New("invalid browser type")
+	// ErrInvalidRequest is returned when the browser server rejects other
+	// session settings
+	ErrInvalidRequest = errors.New("invalid browser session request")
+	// ErrUnavailable is returned when no browser server can be reached
+	ErrUnavailable = errors.New("browser server unavailable")
+)
+
+// Error codes sent by the browser server alongside the HTTP status
+const (
+	codeSessionNotFound    = "session_not_found"
+	codeCapacityExhausted  = "capacity_exhausted"
+	codeInvalidBrowserType = "invalid_browser_type"
+	codeInvalidRequest     = "invalid_request"
+	codeUnavailable        = "unavailable"
+)
+
+// ErrorResponse represents an error from the browser server
+type ErrorResponse struct {
+	Detail string `json:"detail"`
+	Code   string `json:"code,omitempty"`
+}
+
+// ServerError is a non-OK response from the browser server. It unwraps to
+// the sentinel error matching its code, or its status for servers that don't
+// send codes.
+type ServerError struct {
+	StatusCode int
+	Code       string
+	Detail     string
+	// RetryAfter is taken from the Retry-After header, zero if absent
+	RetryAfter time.Duration
+	// ForSession is set when the request addressed a single session, so a
+	// 404 without a code means the session is unknown rather than e.g. a
+	// wrong URL
+	ForSession bool
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("browser server error: %s (status code %d)", e.Detail, e.StatusCode)
+}
+
+// Unwrap returns the sentinel error for the response, or nil
+func (e *ServerError) Unwrap() error {
+	switch e.Code {
+	case codeSessionNotFound:
+		return ErrSessionNotFound
+	case codeCapacityExhausted:
+		return ErrAtCapacity
+	case codeInvalidBrowserType:
+		return ErrInvalidBrowserType
+	case codeInvalidRequest:
+		return ErrInvalidRequest
+	case codeUnavailable:
+		return ErrUnavailable
+	}
+
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		if e.ForSession {
+			return ErrSessionNotFound
+		}
+	case http.StatusTooManyRequests:
+		return ErrAtCapacity
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return ErrInvalidRequest
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// parseServerError builds a ServerError from a non-OK response
+func parseServerError(resp *response) error {
+	var errResp ErrorResponse
+	if err := json.Unmarshal(resp.body, &errResp); err != nil || errResp.Detail == "" {
+		errResp.Detail = http.StatusText(resp.status)
+	}
+
+	serverErr := &ServerError{
+		StatusCode: resp.status,
+		Code:       errResp.Code,
+		Detail:     errResp.Detail,
+		ForSession: resp.forSession,
+	}
+	if secs, err := strconv.Atoi(resp.header.Get("Retry-After")); err == nil && secs > 0 {
+		serverErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return serverErr
+}
+
+// RetryAfter returns how long the caller should wait before retrying a
+// request that failed with err, if the browser backend said
+func RetryAfter(err error) (time.Duration, bool) {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && serverErr.RetryAfter > 0 {
+		return serverErr.RetryAfter, true
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) && openErr.RetryAfter > 0 {
+		return openErr.RetryAfter, true
+	}
+	return 0, false
+}
@@ -0,0 +1,92 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerError(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusNotFound, `{"detail": "Session x not found", "code": "session_not_found"}`, ErrSessionNotFound},
+		{http.StatusTooManyRequests, `{"detail": "Maximum number of sessions reached (10)", "code": "capacity_exhausted"}`, ErrAtCapacity},
+		{http.StatusBadRequest, `{"detail": "Unsupported browser type: opera", "code": "invalid_browser_type"}`, ErrInvalidBrowserType},
+		{http.StatusServiceUnavailable, `{"detail": "BrowserManager not initialized", "code": "unavailable"}`, ErrUnavailable},
+		// Servers without error codes are mapped by status
+		{http.StatusNotFound, `{"detail": "Not Found"}`, ErrSessionNotFound},
+		{http.StatusUnprocessableEntity, `not json`, ErrInvalidRequest},
+	}
+	for _, tc := range cases {
+		err := parseServerError(&response{status: tc.status, header: http.Header{}, body: []byte(tc.body), forSession: true})
+		require.ErrorIs(t, err, tc.want, tc.body)
+	}
+
+	err := parseServerError(&response{status: http.StatusInternalServerError, header: http.Header{}, body: []byte(`{"detail": "boom"}`)})
+	var serverErr *ServerError
+	require.ErrorAs(t, err, &serverErr)
+	require.Equal(t, "boom", serverErr.Detail)
+	require.Nil(t, serverErr.Unwrap())
+}
+
+func TestCodelessNotFoundOnlyMeansSessionNotFoundForSessionRequests(t *testing.T) {
+	// E.g. a browser server URL with the wrong path prefix
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	client := newHTTPClient(srv.URL, testSettings(t))
+
+	_, err := client.CreateSession(context.Background(), CreateSessionRequest{})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSessionNotFound)
+	_, err = client.ListSessions(context.Background())
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSessionNotFound)
+
+	_, err = client.GetSession(context.Background(), "abc")
+	require.ErrorIs(t, err, ErrSessionNotFound)
+	require.ErrorIs(t, client.DeleteSession(context.Background(), "abc"), ErrSessionNotFound)
+	_, err = client.UpdateEmulation(context.Background(), "abc", Emulation{})
+	require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestClientCapacityErrorCarriesRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"detail": "Maximum number of sessions reached (10)", "code": "capacity_exhausted"}`))
+	}))
+	defer srv.Close()
+
+	_, err := newHTTPClient(srv.URL, testSettings(t)).CreateSession(context.Background(), CreateSessionRequest{})
+	require.ErrorIs(t, err, ErrAtCapacity)
+	retryAfter, ok := RetryAfter(err)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, retryAfter)
+}
+
+func TestUnreachableServerIsUnavailable(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	err := newHTTPClient(srv.URL, testSettings(t)).DeleteSession(context.Background(), "gone")
+	require.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestErrorReason(t *testing.T) {
+	require.Equal(t, "not_found", errorReason(&ServerError{StatusCode: http.StatusNotFound, ForSession: true}))
+	require.Equal(t, "at_capacity", errorReason(&ServerError{StatusCode: http.StatusTooManyRequests, Code: codeCapacityExhausted}))
+	require.Equal(t, "circuit_open", errorReason(&CircuitOpenError{URL: "http://browser:8000"}))
+	require.Equal(t, "unavailable", errorReason(fmt.Errorf("%w: connection refused", ErrUnavailable)))
+	require.Equal(t, "other", errorReason(&ServerError{StatusCode: http.StatusInternalServerError}))
+}
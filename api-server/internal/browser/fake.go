@@ -0,0 +1,150 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeClient is an in-memory BrowserClient for local development and tests.
+// It simulates the browser server's session lifecycle, including expiry and
+// the session limit, without launching any browsers.
+type FakeClient struct {
+	mu          sync.Mutex
+	sessions    map[string]*SessionResponse
+	maxSessions int
+	now         func() time.Time
+}
+
+// NewFakeClient returns an empty FakeClient that allows up to maxSessions
+// concurrent sessions; zero or less means unlimited
+func NewFakeClient(maxSessions int) *FakeClient {
+	return &FakeClient{
+		sessions:    make(map[string]*SessionResponse),
+		maxSessions: maxSessions,
+		now:         time.Now,
+	}
+}
+
+// purgeExpired drops sessions whose timeout has passed. Callers must hold mu.
+func (f *FakeClient) purgeExpired() {
+	now := f.now()
+	for id, s := range f.sessions {
+		if !s.ExpiresAt.Time().After(now) {
+			delete(f.sessions, id)
+		}
+	}
+}
+
+// CreateSession starts a simulated session
+func (f *FakeClient) CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.purgeExpired()
+	if f.maxSessions > 0 && len(f.sessions) >= f.maxSessions {
+		return nil, fmt.Errorf("%w: maximum number of sessions reached (%d)", ErrAtCapacity, f.maxSessions)
+	}
+
+	timeout := 3600
+	if req.Timeout != nil && *req.Timeout > 0 {
+		timeout = *req.Timeout
+	}
+	viewport := ViewportSize{Width: 1280, Height: 720}
+	if req.ViewportSize != nil {
+		viewport = *req.ViewportSize
+	}
+	browserType := req.BrowserType
+	if browserType == "" {
+		browserType = "chromium"
+	}
+
+	id := uuid.New().String()
+	now := f.now()
+	session := &SessionResponse{
+		ID:           id,
+		BrowserType:  browserType,
+		Headless:     req.Headless,
+		CreatedAt:    FlexibleTime(now),
+		ExpiresAt:    FlexibleTime(now.Add(time.Duration(timeout) * time.Second)),
+		CdpURL:       "ws://fake-browser/devtools/browser/" + id,
+		ViewportSize: viewport,
+		UserAgent:    req.UserAgent,
+		Emulation:    req.Emulation,
+	}
+	f.sessions[id] = session
+
+	copied := *session
+	return &copied, nil
+}
+
+// GetSession returns a simulated session
+func (f *FakeClient) GetSession(ctx context.Context, sessionID string) (*SessionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.purgeExpired()
+	session, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// ListSessions returns the simulated sessions, oldest first
+func (f *FakeClient) ListSessions(ctx context.Context) ([]*SessionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.purgeExpired()
+	sessions := make([]*SessionResponse, 0, len(f.sessions))
+	for _, s := range f.sessions {
+		copied := *s
+		sessions = append(sessions, &copied)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Time().Before(sessions[j].CreatedAt.Time())
+	})
+	return sessions, nil
+}
+
+// DeleteSession ends a simulated session
+func (f *FakeClient) DeleteSession(ctx context.Context, sessionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.purgeExpired()
+	if _, ok := f.sessions[sessionID]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(f.sessions, sessionID)
+	return nil
+}
+
+// UpdateEmulation replaces the emulation overrides of a simulated session
+func (f *FakeClient) UpdateEmulation(ctx context.Context, sessionID string, emulation Emulation) (*SessionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.purgeExpired()
+	session, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if emulation.IsZero() {
+		session.Emulation = nil
+	} else {
+		session.Emulation = &emulation
+	}
+	copied := *session
+	return &copied, nil
+}
@@ -0,0 +1,68 @@
+package browser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClientLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient(0)
+
+	created, err := fake.CreateSession(ctx, CreateSessionRequest{BrowserType: "firefox", Headless: true})
+	require.NoError(t, err)
+	require.Equal(t, "firefox", created.BrowserType)
+	require.Equal(t, 1280, created.ViewportSize.Width)
+	require.NotEmpty(t, created.CdpURL)
+
+	got, err := fake.GetSession(ctx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, got.ID)
+
+	updated, err := fake.UpdateEmulation(ctx, created.ID, Emulation{Locale: "de-DE"})
+	require.NoError(t, err)
+	require.Equal(t, "de-DE", updated.Emulation.Locale)
+
+	list, err := fake.ListSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	require.NoError(t, fake.DeleteSession(ctx, created.ID))
+	require.ErrorIs(t, fake.DeleteSession(ctx, created.ID), ErrSessionNotFound)
+	_, err = fake.GetSession(ctx, created.ID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestFakeClientExpiry(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient(0)
+	now := time.Now()
+	fake.now = func() time.Time { return now }
+
+	timeout := 60
+	created, err := fake.CreateSession(ctx, CreateSessionRequest{Timeout: &timeout})
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), created.ExpiresAt.Time())
+
+	now = now.Add(2 * time.Minute)
+	_, err = fake.GetSession(ctx, created.ID)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestFakeClientCapacity(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient(1)
+
+	first, err := fake.CreateSession(ctx, CreateSessionRequest{})
+	require.NoError(t, err)
+	_, err = fake.CreateSession(ctx, CreateSessionRequest{})
+	require.ErrorIs(t, err, ErrAtCapacity)
+
+	// Capacity frees up once a session ends
+	require.NoError(t, fake.DeleteSession(ctx, first.ID))
+	_, err = fake.CreateSession(ctx, CreateSessionRequest{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,57 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Browser server call metrics, labelled by client operation and node
+var (
+	callDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "orchestrator",
+		Name:      "browser_client_call_duration_seconds",
+		Help:      "Duration of browser server calls, including retries.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation", "node"})
+	callErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "orchestrator",
+		Name:      "browser_client_call_errors_total",
+		Help:      "Browser server calls that failed, by reason.",
+	}, []string{"operation", "node", "reason"})
+)
+
+// Collectors returns the browser client metrics for registration
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{callDuration, callErrors}
+}
+
+// observeCall records the duration and outcome of a browser server call
+func observeCall(op, node string, started time.Time, err error) {
+	callDuration.WithLabelValues(op, node).Observe(time.Since(started).Seconds())
+	if err != nil {
+		callErrors.WithLabelValues(op, node, errorReason(err)).Inc()
+	}
+}
+
+// errorReason classifies a browser server call failure for metrics
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrSessionNotFound):
+		return "not_found"
+	case errors.Is(err, ErrAtCapacity):
+		return "at_capacity"
+	case errors.Is(err, ErrInvalidBrowserType), errors.Is(err, ErrInvalidRequest):
+		return "invalid_request"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrUnavailable):
+		return "unavailable"
+	default:
+		return "other"
+	}
+}
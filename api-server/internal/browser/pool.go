@@ -0,0 +1,320 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"api-server/internal/config"
+)
+
+// poolStaleAfter is how old the last health check may be before CreateSession
+// refreshes it itself
+const poolStaleAfter = 30 * time.Second
+
+// NodeStatus is the last known health and capacity of a browser server node
+type NodeStatus struct {
+	URL            string    `json:"url"`
+	Healthy        bool      `json:"healthy"`
+	ActiveSessions int       `json:"active_sessions"`
+	MaxSessions    int       `json:"max_sessions"`
+	CheckedAt      time.Time `json:"checked_at"`
+	Error          string    `json:"error,omitempty"`
+	// Breaker is the state of the node's circuit breaker
+	Breaker string `json:"breaker"`
+}
+
+// free returns how many more sessions the node can take
+func (n *NodeStatus) free() int {
+	return n.MaxSessions - n.ActiveSessions
+}
+
+// load returns the fraction of the node's capacity in use
+func (n *NodeStatus) load() float64 {
+	return float64(n.ActiveSessions) / float64(n.MaxSessions)
+}
+
+// Pool is a BrowserClient spread over several browser server nodes. New
+// sessions are placed on the least-loaded healthy node with free capacity;
+// calls for existing sessions should go through Node using the node recorded
+// on the session.
+type Pool struct {
+	// settings configure the client of every node, including those added
+	// by Node
+	settings clientSettings
+
+	mu      sync.Mutex
+	nodes   []*NodeStatus
+	clients map[string]*Client
+}
+
+// NewPool returns a pool of the browser servers configured in cfg: the
+// ServerURLs, or the single ServerURL. Nodes count as unhealthy until their
+// first health check. It fails when the TLS files can't be loaded.
+func NewPool(cfg config.Browser) (*Pool, error) {
+	settings, err := newClientSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	urls := cfg.ServerURLs
+	if len(urls) == 0 && cfg.ServerURL != "" {
+		urls = []string{cfg.ServerURL}
+	}
+	return newPool(urls, settings), nil
+}
+
+func newPool(urls []string, settings clientSettings) *Pool {
+	p := &Pool{settings: settings, clients: make(map[string]*Client)}
+	for _, u := range urls {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" || p.clients[u] != nil {
+			continue
+		}
+		p.nodes = append(p.nodes, &NodeStatus{URL: u})
+		p.clients[u] = newHTTPClient(u, settings)
+	}
+	return p
+}
+
+// urls returns the base URLs of the pool's nodes
+func (p *Pool) urls() []string {
+	urls := make([]string, len(p.nodes))
+	for i, n := range p.nodes {
+		urls[i] = n.URL
+	}
+	return urls
+}
+
+// Node returns a client for the node at url, which needn't be in the pool so
+// sessions on nodes removed from the configuration can still be reached
+func (p *Pool) Node(url string) BrowserClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.clients[url]
+	if !ok {
+		// Keep the client so its circuit breaker state carries over
+		c = newHTTPClient(url, p.settings)
+		p.clients[url] = c
+	}
+	return c
+}
+
+// client returns the client of a configured node. Node may add clients
+// concurrently, so the map is only read under mu.
+func (p *Pool) client(url string) *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clients[url]
+}
+
+// Nodes returns the last known status of every node
+func (p *Pool) Nodes() []NodeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nodes := make([]NodeStatus, len(p.nodes))
+	for i, n := range p.nodes {
+		nodes[i] = *n
+		nodes[i].Breaker = p.clients[n.URL].BreakerState()
+	}
+	return nodes
+}
+
+// Refresh checks the health of every node concurrently
+func (p *Pool) Refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, url := range p.urls() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health, err := p.client(url).Health(ctx)
+			p.record(url, health, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// record stores the result of a health check
+func (p *Pool) record(url string, health *HealthResponse, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, n := range p.nodes {
+		if n.URL != url {
+			continue
+		}
+		n.CheckedAt = time.Now()
+		if err != nil {
+			if n.Healthy {
+				logger.Warn("Browser server is unhealthy", "node", url, "error", err)
+			}
+			n.Healthy = false
+			n.Error = err.Error()
+			return
+		}
+		if !n.Healthy {
+			logger.Info("Browser server is healthy", "node", url, "active_sessions", health.ActiveSessions, "max_sessions", health.MaxSessions)
+		}
+		n.Healthy = health.Status == "ok"
+		n.ActiveSessions = health.ActiveSessions
+		n.MaxSessions = health.MaxSessions
+		n.Error = ""
+	}
+}
+
+// stale reports whether any node hasn't been checked recently
+func (p *Pool) stale() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, n := range p.nodes {
+		if time.Since(n.CheckedAt) > poolStaleAfter {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the least-loaded healthy node with free capacity and counts
+// the session about to be placed on it, so placements between health checks
+// still spread out
+func (p *Pool) pick() (*NodeStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *NodeStatus
+	healthy := 0
+	for _, n := range p.nodes {
+		if !n.Healthy || p.clients[n.URL].BreakerState() == BreakerOpen {
+			continue
+		}
+		healthy++
+		if n.free() <= 0 {
+			continue
+		}
+		if best == nil || n.load() < best.load() || (n.load() == best.load() && n.free() > best.free()) {
+			best = n
+		}
+	}
+
+	if healthy == 0 {
+		return nil, fmt.Errorf("%w: no healthy browser server", ErrUnavailable)
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w: all %d healthy browser servers are full", ErrAtCapacity, healthy)
+	}
+	best.ActiveSessions++
+	return best, nil
+}
+
+// release undoes the count taken by pick when placement fails
+func (p *Pool) release(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, n := range p.nodes {
+		if n.URL == url && n.ActiveSessions > 0 {
+			n.ActiveSessions--
+		}
+	}
+}
+
+// CreateSession starts a session on the least-loaded healthy node. The
+// returned session's Node records where it was placed.
+func (p *Pool) CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error) {
+	if p.stale() {
+		p.Refresh(ctx)
+	}
+
+	node, err := p.pick()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := p.client(node.URL).CreateSession(ctx, req)
+	if err != nil {
+		p.release(node.URL)
+		return nil, fmt.Errorf("browser server %s: %w", node.URL, err)
+	}
+	session.Node = node.URL
+	return session, nil
+}
+
+// find calls fn against each node in turn until one knows the session. It is
+// used for sessions recorded without a node. If no node knows the session the
+// first failure other than ErrSessionNotFound is returned, since the session
+// may be on a node that couldn't be asked.
+func (p *Pool) find(fn func(c *Client) error) error {
+	var firstErr error
+	for _, url := range p.urls() {
+		err := fn(p.client(url))
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrSessionNotFound) {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return ErrSessionNotFound
+}
+
+// GetSession looks the session up on every node
+func (p *Pool) GetSession(ctx context.Context, sessionID string) (*SessionResponse, error) {
+	var session *SessionResponse
+	err := p.find(func(c *Client) error {
+		var err error
+		session, err = c.GetSession(ctx, sessionID)
+		if err == nil {
+			session.Node = c.baseURL
+		}
+		return err
+	})
+	return session, err
+}
+
+// ListSessions lists the sessions of every healthy node
+func (p *Pool) ListSessions(ctx context.Context) ([]*SessionResponse, error) {
+	var all []*SessionResponse
+	for _, n := range p.Nodes() {
+		if !n.Healthy {
+			continue
+		}
+		sessions, err := p.client(n.URL).ListSessions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("browser server %s: %w", n.URL, err)
+		}
+		for _, s := range sessions {
+			s.Node = n.URL
+		}
+		all = append(all, sessions...)
+	}
+	return all, nil
+}
+
+// DeleteSession ends the session on whichever node hosts it
+func (p *Pool) DeleteSession(ctx context.Context, sessionID string) error {
+	return p.find(func(c *Client) error {
+		return c.DeleteSession(ctx, sessionID)
+	})
+}
+
+// UpdateEmulation updates the session on whichever node hosts it
+func (p *Pool) UpdateEmulation(ctx context.Context, sessionID string, emulation Emulation) (*SessionResponse, error) {
+	var session *SessionResponse
+	err := p.find(func(c *Client) error {
+		var err error
+		session, err = c.UpdateEmulation(ctx, sessionID, emulation)
+		if err == nil {
+			session.Node = c.baseURL
+		}
+		return err
+	})
+	return session, err
+}
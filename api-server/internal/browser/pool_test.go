@@ -0,0 +1,127 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubNode is a minimal browser server reporting a fixed capacity
+type stubNode struct {
+	mu       sync.Mutex
+	active   int
+	max      int
+	sessions map[string]bool
+}
+
+func newStubNode(t *testing.T, active, max int) (*stubNode, *httptest.Server) {
+	n := &stubNode{active: active, max: max, sessions: map[string]bool{}}
+	srv := httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	t.Cleanup(srv.Close)
+	return n, srv
+}
+
+func (n *stubNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/health":
+		json.NewEncoder(w).Encode(HealthResponse{Status: "ok", ActiveSessions: n.active, MaxSessions: n.max})
+	case r.Method == http.MethodPost && r.URL.Path == "/sessions":
+		id := "s" + string(rune('a'+len(n.sessions)))
+		n.sessions[id] = true
+		n.active++
+		json.NewEncoder(w).Encode(SessionResponse{ID: id, BrowserType: "chromium"})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/sessions/"):
+		id := strings.TrimPrefix(r.URL.Path, "/sessions/")
+		if !n.sessions[id] {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(ErrorResponse{Detail: "not found"})
+			return
+		}
+		delete(n.sessions, id)
+		n.active--
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPoolPlacesOnLeastLoadedNode(t *testing.T) {
+	ctx := context.Background()
+	_, busy := newStubNode(t, 8, 10)
+	idle, quiet := newStubNode(t, 1, 10)
+
+	pool := newPool([]string{busy.URL, quiet.URL}, testSettings(t))
+	session, err := pool.CreateSession(ctx, CreateSessionRequest{})
+	require.NoError(t, err)
+	require.Equal(t, quiet.URL, session.Node)
+	require.Equal(t, 2, idle.active)
+
+	// Sessions recorded without a node are found on whichever node has them
+	require.NoError(t, pool.DeleteSession(ctx, session.ID))
+	require.ErrorIs(t, pool.DeleteSession(ctx, session.ID), ErrSessionNotFound)
+}
+
+func TestPoolSkipsUnhealthyAndFullNodes(t *testing.T) {
+	ctx := context.Background()
+	_, full := newStubNode(t, 2, 2)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	pool := newPool([]string{full.URL, down.URL}, testSettings(t))
+	_, err := pool.CreateSession(ctx, CreateSessionRequest{})
+	require.ErrorIs(t, err, ErrAtCapacity)
+
+	nodes := pool.Nodes()
+	require.Len(t, nodes, 2)
+	require.True(t, nodes[0].Healthy)
+	require.False(t, nodes[1].Healthy)
+	require.NotEmpty(t, nodes[1].Error)
+}
+
+func TestPoolSpreadsPlacementsBetweenHealthChecks(t *testing.T) {
+	ctx := context.Background()
+	a, first := newStubNode(t, 0, 10)
+	b, second := newStubNode(t, 0, 10)
+
+	pool := newPool([]string{first.URL, second.URL, first.URL + "/"}, testSettings(t))
+	require.Len(t, pool.Nodes(), 2)
+
+	for range 4 {
+		_, err := pool.CreateSession(ctx, CreateSessionRequest{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, a.active)
+	require.Equal(t, 2, b.active)
+}
+
+func TestPoolReachesUnconfiguredNodesConcurrently(t *testing.T) {
+	_, srv := newStubNode(t, 0, 10)
+	p := newPool([]string{srv.URL}, testSettings(t))
+
+	// Node adds clients for nodes removed from the configuration while
+	// health checks read the configured ones
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.Refresh(context.Background())
+		}()
+		go func() {
+			defer wg.Done()
+			p.Node(fmt.Sprintf("http://old-node-%d:8000", i))
+		}()
+	}
+	wg.Wait()
+	require.True(t, p.Nodes()[0].Healthy)
+}
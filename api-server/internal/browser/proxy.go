@@ -0,0 +1,47 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// supportedProxySchemes are the proxy schemes the browser server accepts.
+// Whether the proxy is reachable is checked by the browser server, which is
+// what connects through it, when it launches the browser.
+var supportedProxySchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks5": true,
+}
+
+// ProxySettings describes an upstream proxy the browser routes its traffic through
+type ProxySettings struct {
+	Server   string `json:"server"`
+	Bypass   string `json:"bypass,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validate checks that the proxy server is a well-formed http, https or socks5 URL
+func (p *ProxySettings) Validate() error {
+	if p.Server == "" {
+		return errors.New("proxy server is required")
+	}
+
+	u, err := url.Parse(p.Server)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy server %q: expected scheme://host:port", p.Server)
+	}
+	if !supportedProxySchemes[u.Scheme] {
+		return fmt.Errorf("unsupported proxy scheme %q: must be http, https or socks5", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("proxy credentials must be passed as username and password, not in the server URL")
+	}
+	if p.Password != "" && p.Username == "" {
+		return errors.New("proxy password requires a username")
+	}
+
+	return nil
+}
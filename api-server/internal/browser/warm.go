@@ -0,0 +1,350 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warmRefillInterval is how often the warm pool tops itself up when no claim
+// has woken it
+const warmRefillInterval = 5 * time.Second
+
+// WarmSpec is a kind of browser the warm pool keeps pre-launched
+type WarmSpec struct {
+	BrowserType string
+	Headless    bool
+	// Size is how many idle browsers of this kind to keep
+	Size int
+}
+
+// ParseWarmSpecs parses a comma-separated list of type:mode=size entries,
+// e.g. "chromium:headless=2,firefox:headed=1"
+func ParseWarmSpecs(s string) ([]WarmSpec, error) {
+	var specs []WarmSpec
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, size, ok := strings.Cut(entry, "=")
+		browserType, mode, hasMode := strings.Cut(kind, ":")
+		n, err := strconv.Atoi(size)
+		if !ok || !hasMode || browserType == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid warm pool entry %q: expected type:headless=N or type:headed=N", entry)
+		}
+		if mode != "headless" && mode != "headed" {
+			return nil, fmt.Errorf("invalid warm pool entry %q: mode must be headless or headed", entry)
+		}
+		specs = append(specs, WarmSpec{BrowserType: browserType, Headless: mode == "headless", Size: n})
+	}
+	return specs, nil
+}
+
+// WarmPoolStats reports one kind of browser in the warm pool
+type WarmPoolStats struct {
+	BrowserType string `json:"browser_type"`
+	Headless    bool   `json:"headless"`
+	Size        int    `json:"size"`
+	// Unclaimed is how many idle browsers are ready to be claimed
+	Unclaimed int `json:"unclaimed"`
+	Launching int `json:"launching"`
+	// Claimed is how many browsers have been claimed since startup
+	Claimed   int64  `json:"claimed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type warmKey struct {
+	browserType string
+	headless    bool
+}
+
+type warmBrowser struct {
+	session    *SessionResponse
+	launchedAt time.Time
+}
+
+type warmBucket struct {
+	size      int
+	idle      []*warmBrowser
+	launching int
+	claimed   int64
+	lastError string
+}
+
+// WarmPool is a BrowserClient that keeps idle browsers pre-launched and hands
+// one out for each CreateSession request it can satisfy, falling back to a
+// cold launch otherwise. Only requests with the template viewport and timeout
+// and no proxy, emulation, device or user agent can be satisfied.
+//
+// Idle browsers are recycled after maxIdle and launched with maxIdle added to
+// their timeout, so a claimed browser always has at least the requested
+// timeout left and may outlive it by up to maxIdle. Each one is checked to be
+// still running before it is handed out, since its browser server may have
+// restarted since the launch.
+type WarmPool struct {
+	client   BrowserClient
+	viewport ViewportSize
+	timeout  int
+	maxIdle  time.Duration
+
+	mu      sync.Mutex
+	buckets map[warmKey]*warmBucket
+	order   []warmKey
+	wake    chan struct{}
+}
+
+// NewWarmPool returns a warm pool launching browsers through client with the
+// given viewport and timeout in seconds. Run keeps it filled.
+func NewWarmPool(client BrowserClient, specs []WarmSpec, viewport ViewportSize, timeout int, maxIdle time.Duration) *WarmPool {
+	p := &WarmPool{
+		client:   client,
+		viewport: viewport,
+		timeout:  timeout,
+		maxIdle:  maxIdle,
+		buckets:  make(map[warmKey]*warmBucket),
+		wake:     make(chan struct{}, 1),
+	}
+	for _, spec := range specs {
+		key := warmKey{spec.BrowserType, spec.Headless}
+		if _, ok := p.buckets[key]; !ok {
+			p.order = append(p.order, key)
+		}
+		p.buckets[key] = &warmBucket{size: spec.Size}
+	}
+	return p
+}
+
+// compatible returns the bucket a request can be served from
+func (p *WarmPool) compatible(req CreateSessionRequest) (warmKey, bool) {
+	key := warmKey{req.BrowserType, req.Headless}
+	if _, ok := p.buckets[key]; !ok {
+		return key, false
+	}
+	if req.Proxy != nil || req.Emulation != nil || req.DeviceMetrics != nil || req.UserAgent != nil {
+		return key, false
+	}
+	if req.ViewportSize != nil && *req.ViewportSize != p.viewport {
+		return key, false
+	}
+	if req.Timeout != nil && *req.Timeout != p.timeout {
+		return key, false
+	}
+	return key, true
+}
+
+// take removes the longest-idle browser of a kind from the pool, or returns
+// nil
+func (p *WarmPool) take(key warmKey) *SessionResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.buckets[key]
+	if len(b.idle) == 0 {
+		return nil
+	}
+	taken := b.idle[0]
+	b.idle = b.idle[1:]
+
+	// Wake Run to launch a replacement
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return taken.session
+}
+
+// claim takes the longest-idle browser of a kind that is still running, or
+// returns nil. Browsers found gone, e.g. because their browser server
+// restarted, are dropped; ones that can't be checked are dropped too and left
+// to expire, since they can't be handed out either.
+func (p *WarmPool) claim(ctx context.Context, key warmKey) *SessionResponse {
+	for {
+		session := p.take(key)
+		if session == nil {
+			return nil
+		}
+
+		_, err := p.sessionClient(session).GetSession(ctx, session.ID)
+		if err == nil {
+			p.mu.Lock()
+			p.buckets[key].claimed++
+			p.mu.Unlock()
+			return session
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.WarnContext(ctx, "Dropping idle warm browser that can't be reached", "browser_id", session.ID, "node", session.Node, "error", err)
+	}
+}
+
+// sessionClient returns the client for the node hosting session
+func (p *WarmPool) sessionClient(session *SessionResponse) BrowserClient {
+	if pool, ok := p.client.(*Pool); ok && session.Node != "" {
+		return pool.Node(session.Node)
+	}
+	return p.client
+}
+
+// CreateSession claims a pre-launched browser when the request allows,
+// otherwise it launches one
+func (p *WarmPool) CreateSession(ctx context.Context, req CreateSessionRequest) (*SessionResponse, error) {
+	if key, ok := p.compatible(req); ok {
+		if session := p.claim(ctx, key); session != nil {
+			return session, nil
+		}
+	}
+	return p.client.CreateSession(ctx, req)
+}
+
+// GetSession passes through to the underlying client
+func (p *WarmPool) GetSession(ctx context.Context, sessionID string) (*SessionResponse, error) {
+	return p.client.GetSession(ctx, sessionID)
+}
+
+// ListSessions passes through to the underlying client, so it includes idle
+// browsers
+func (p *WarmPool) ListSessions(ctx context.Context) ([]*SessionResponse, error) {
+	return p.client.ListSessions(ctx)
+}
+
+// DeleteSession passes through to the underlying client
+func (p *WarmPool) DeleteSession(ctx context.Context, sessionID string) error {
+	return p.client.DeleteSession(ctx, sessionID)
+}
+
+// UpdateEmulation passes through to the underlying client
+func (p *WarmPool) UpdateEmulation(ctx context.Context, sessionID string, emulation Emulation) (*SessionResponse, error) {
+	return p.client.UpdateEmulation(ctx, sessionID, emulation)
+}
+
+// Stats reports each kind of browser in the pool
+func (p *WarmPool) Stats() []WarmPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]WarmPoolStats, 0, len(p.order))
+	for _, key := range p.order {
+		b := p.buckets[key]
+		stats = append(stats, WarmPoolStats{
+			BrowserType: key.browserType,
+			Headless:    key.headless,
+			Size:        b.size,
+			Unclaimed:   len(b.idle),
+			Launching:   b.launching,
+			Claimed:     b.claimed,
+			LastError:   b.lastError,
+		})
+	}
+	return stats
+}
+
+// Run keeps the pool filled until ctx is canceled, then waits for launches in
+// flight and shuts down the idle browsers
+func (p *WarmPool) Run(ctx context.Context) {
+	var launches sync.WaitGroup
+	ticker := time.NewTicker(warmRefillInterval)
+	defer ticker.Stop()
+
+	for {
+		p.refill(ctx, &launches)
+		select {
+		case <-ctx.Done():
+			launches.Wait()
+			p.drain()
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// refill recycles browsers idle for longer than maxIdle and starts launches
+// for every missing idle browser
+func (p *WarmPool) refill(ctx context.Context, launches *sync.WaitGroup) {
+	var stale []*warmBrowser
+	var needed []warmKey
+
+	p.mu.Lock()
+	for _, key := range p.order {
+		b := p.buckets[key]
+		b.idle = slices.DeleteFunc(b.idle, func(wb *warmBrowser) bool {
+			if time.Since(wb.launchedAt) > p.maxIdle {
+				stale = append(stale, wb)
+				return true
+			}
+			return false
+		})
+		for range b.size - len(b.idle) - b.launching {
+			b.launching++
+			needed = append(needed, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, wb := range stale {
+		if err := p.client.DeleteSession(ctx, wb.session.ID); err != nil {
+			logger.WarnContext(ctx, "Failed to recycle idle warm browser", "browser_id", wb.session.ID, "error", err)
+		}
+	}
+
+	for _, key := range needed {
+		launches.Add(1)
+		go func() {
+			defer launches.Done()
+			p.launch(ctx, key)
+		}()
+	}
+}
+
+// launch starts one idle browser of a kind
+func (p *WarmPool) launch(ctx context.Context, key warmKey) {
+	viewport := p.viewport
+	timeout := p.timeout + int(p.maxIdle.Seconds())
+	session, err := p.client.CreateSession(ctx, CreateSessionRequest{
+		BrowserType:  key.browserType,
+		Headless:     key.headless,
+		ViewportSize: &viewport,
+		Timeout:      &timeout,
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.buckets[key]
+	b.launching--
+	if err != nil {
+		if ctx.Err() == nil && b.lastError != err.Error() {
+			logger.WarnContext(ctx, "Failed to launch warm browser", "browser_type", key.browserType, "error", err)
+		}
+		b.lastError = err.Error()
+		return
+	}
+	b.lastError = ""
+	b.idle = append(b.idle, &warmBrowser{session: session, launchedAt: time.Now()})
+}
+
+// drain shuts down every idle browser
+func (p *WarmPool) drain() {
+	p.mu.Lock()
+	var idle []*warmBrowser
+	for _, b := range p.buckets {
+		idle = append(idle, b.idle...)
+		b.idle = nil
+	}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, wb := range idle {
+		if err := p.client.DeleteSession(ctx, wb.session.ID); err != nil {
+			logger.WarnContext(ctx, "Failed to shut down idle warm browser", "browser_id", wb.session.ID, "error", err)
+		}
+	}
+}
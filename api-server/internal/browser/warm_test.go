@@ -0,0 +1,140 @@
+package browser
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWarmSpecs(t *testing.T) {
+	specs, err := ParseWarmSpecs(" firefox:headed=2, chromium:headless=1,")
+	require.NoError(t, err)
+	require.Equal(t, []WarmSpec{
+		{BrowserType: "firefox", Headless: false, Size: 2},
+		{BrowserType: "chromium", Headless: true, Size: 1},
+	}, specs)
+
+	specs, err = ParseWarmSpecs("")
+	require.NoError(t, err)
+	require.Empty(t, specs)
+
+	for _, bad := range []string{"firefox=2", "firefox:visible=1", "firefox:headed", "firefox:headed=-1", ":headed=1"} {
+		_, err := ParseWarmSpecs(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+// waitForUnclaimed waits until the first kind of browser in the pool has n
+// idle browsers
+func waitForUnclaimed(t *testing.T, pool *WarmPool, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return pool.Stats()[0].Unclaimed == n
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestWarmPool(t *testing.T) {
+	fake := NewFakeClient(0)
+	viewport := ViewportSize{Width: 1280, Height: 720}
+	pool := NewWarmPool(fake, []WarmSpec{{BrowserType: "firefox", Headless: true, Size: 2}}, viewport, 60, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(done)
+	}()
+	waitForUnclaimed(t, pool, 2)
+
+	timeout := 60
+	compatible := CreateSessionRequest{BrowserType: "firefox", Headless: true, ViewportSize: &viewport, Timeout: &timeout}
+
+	// A compatible request claims an idle browser, which is then replaced
+	claimed, err := pool.CreateSession(ctx, compatible)
+	require.NoError(t, err)
+	require.Equal(t, "firefox", claimed.BrowserType)
+	require.Equal(t, int64(1), pool.Stats()[0].Claimed)
+	waitForUnclaimed(t, pool, 2)
+
+	// Other settings get a browser of their own
+	userAgent := "test-agent"
+	custom := compatible
+	custom.UserAgent = &userAgent
+	_, err = pool.CreateSession(ctx, custom)
+	require.NoError(t, err)
+
+	other := compatible
+	other.BrowserType = "chromium"
+	_, err = pool.CreateSession(ctx, other)
+	require.NoError(t, err)
+
+	stats := pool.Stats()[0]
+	require.Equal(t, int64(1), stats.Claimed)
+	require.Equal(t, 2, stats.Unclaimed)
+
+	// Stopping the pool shuts down only the idle browsers
+	cancel()
+	<-done
+	require.Zero(t, pool.Stats()[0].Unclaimed)
+	sessions, err := fake.ListSessions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+}
+
+func TestWarmPoolRecyclesIdleBrowsers(t *testing.T) {
+	fake := NewFakeClient(0)
+	pool := NewWarmPool(fake, []WarmSpec{{BrowserType: "firefox", Size: 1}}, ViewportSize{Width: 1280, Height: 720}, 60, 0)
+
+	var launches sync.WaitGroup
+	pool.refill(context.Background(), &launches)
+	launches.Wait()
+	first := pool.buckets[warmKey{"firefox", false}].idle[0].session.ID
+
+	// With no idle time allowed the next refill replaces the browser
+	pool.refill(context.Background(), &launches)
+	launches.Wait()
+	replaced := pool.buckets[warmKey{"firefox", false}].idle[0].session.ID
+	require.NotEqual(t, first, replaced)
+
+	_, err := fake.GetSession(context.Background(), first)
+	require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestWarmPoolSkipsDeadBrowsers(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFakeClient(0)
+	viewport := ViewportSize{Width: 1280, Height: 720}
+	pool := NewWarmPool(fake, []WarmSpec{{BrowserType: "firefox", Headless: true, Size: 2}}, viewport, 60, time.Minute)
+
+	var launches sync.WaitGroup
+	pool.refill(ctx, &launches)
+	launches.Wait()
+	idle := pool.buckets[warmKey{"firefox", true}].idle
+	dead, alive := idle[0].session.ID, idle[1].session.ID
+
+	// The browser server lost the longest-idle browser, e.g. in a restart
+	require.NoError(t, fake.DeleteSession(ctx, dead))
+
+	timeout := 60
+	compatible := CreateSessionRequest{BrowserType: "firefox", Headless: true, ViewportSize: &viewport, Timeout: &timeout}
+	claimed, err := pool.CreateSession(ctx, compatible)
+	require.NoError(t, err)
+	require.Equal(t, alive, claimed.ID)
+	require.Equal(t, int64(1), pool.Stats()[0].Claimed)
+
+	// With only dead browsers left the request gets a cold launch
+	pool.refill(ctx, &launches)
+	launches.Wait()
+	for _, wb := range pool.buckets[warmKey{"firefox", true}].idle {
+		require.NoError(t, fake.DeleteSession(ctx, wb.session.ID))
+	}
+	launched, err := pool.CreateSession(ctx, compatible)
+	require.NoError(t, err)
+	require.NotEqual(t, alive, launched.ID)
+	stats := pool.Stats()[0]
+	require.Equal(t, int64(1), stats.Claimed)
+	require.Zero(t, stats.Unclaimed)
+}
@@ -0,0 +1,386 @@
+// Package config loads the API server's configuration from defaults, an
+// optional YAML or TOML file and the environment, in increasing order of
+// precedence, and validates it
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	_ "github.com/joho/godotenv/autoload"
+	"gopkg.in/yaml.v3"
+
+	"api-server/internal/logging"
+)
+
+// Config is the configuration of the API server. Each field can be set in
+// the file under its yaml or toml key and overridden by its env variable.
+// Fields tagged secret are redacted by Redacted.
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	Browser   Browser   `yaml:"browser" toml:"browser"`
+	Sessions  Sessions  `yaml:"sessions" toml:"sessions"`
+	Webhooks  Webhooks  `yaml:"webhooks" toml:"webhooks"`
+	Metrics   Metrics   `yaml:"metrics" toml:"metrics"`
+	Telemetry Telemetry `yaml:"telemetry" toml:"telemetry"`
+	Logging   Logging   `yaml:"logging" toml:"logging"`
+}
+
+// Server configures the HTTP server and its shutdown
+type Server struct {
+	Port int `yaml:"port" toml:"port" env:"PORT"`
+	// InstanceID identifies this instance as the owner of the sessions it
+	// creates; it defaults to the hostname
+	InstanceID         string        `yaml:"instance_id" toml:"instance_id" env:"INSTANCE_ID"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	DrainDelay         time.Duration `yaml:"drain_delay" toml:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+	SessionPolicy      string        `yaml:"session_policy" toml:"session_policy" env:"SHUTDOWN_SESSION_POLICY"`
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" toml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	ExportWriteTimeout time.Duration `yaml:"export_write_timeout" toml:"export_write_timeout" env:"EXPORT_WRITE_TIMEOUT"`
+}
+
+// Database configures the Postgres connection
+type Database struct {
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT"`
+	Username string `yaml:"username" toml:"username" env:"DB_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Database string `yaml:"database" toml:"database" env:"DB_DATABASE"`
+	Schema   string `yaml:"schema" toml:"schema" env:"DB_SCHEMA"`
+	// AutoMigrate applies pending migrations at startup
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// Auth configures user tokens and the encryption of stored credentials
+type Auth struct {
+	JWTSecret string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	JWTExpiry time.Duration `yaml:"jwt_expiry" toml:"jwt_expiry" env:"JWT_EXPIRY"`
+	// SecretsKey encrypts proxy passwords and webhook secrets at rest
+	SecretsKey string `yaml:"secrets_key" toml:"secrets_key" env:"SECRETS_KEY" secret:"true"`
+}
+
+// Browser configures the browser servers and the sessions launched on them
+type Browser struct {
+	// Backend is http or fake; Fallback selects fake when Backend is unset
+	Backend    string   `yaml:"backend" toml:"backend" env:"BROWSER_BACKEND"`
+	Fallback   bool     `yaml:"fallback" toml:"fallback" env:"BROWSER_SERVER_FALLBACK"`
+	ServerURLs []string `yaml:"server_urls" toml:"server_urls" env:"BROWSER_SERVER_URLS"`
+	// ServerURL is the single node used when ServerURLs is empty
+	ServerURL        string        `yaml:"server_url" toml:"server_url" env:"BROWSER_SERVER_URL"`
+	Secret           string        `yaml:"secret" toml:"secret" env:"BROWSER_SERVER_SECRET" secret:"true"`
+	TLSCAFile        string        `yaml:"tls_ca_file" toml:"tls_ca_file" env:"BROWSER_TLS_CA_FILE"`
+	TLSCertFile      string        `yaml:"tls_cert_file" toml:"tls_cert_file" env:"BROWSER_TLS_CERT_FILE"`
+	TLSKeyFile       string        `yaml:"tls_key_file" toml:"tls_key_file" env:"BROWSER_TLS_KEY_FILE"`
+	CreateTimeout    time.Duration `yaml:"create_timeout" toml:"create_timeout" env:"BROWSER_CREATE_TIMEOUT"`
+	RequestTimeout   time.Duration `yaml:"request_timeout" toml:"request_timeout" env:"BROWSER_REQUEST_TIMEOUT"`
+	MaxRetries       int           `yaml:"max_retries" toml:"max_retries" env:"BROWSER_MAX_RETRIES"`
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold" env:"BROWSER_BREAKER_THRESHOLD"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" env:"BROWSER_BREAKER_COOLDOWN"`
+	HealthInterval   time.Duration `yaml:"health_interval" toml:"health_interval" env:"BROWSER_HEALTH_INTERVAL"`
+	FakeMaxSessions  int           `yaml:"fake_max_sessions" toml:"fake_max_sessions" env:"FAKE_BROWSER_MAX_SESSIONS"`
+
+	// Defaults for new sessions
+	DefaultType     string `yaml:"default_type" toml:"default_type" env:"DEFAULT_BROWSER_TYPE"`
+	DefaultHeadless bool   `yaml:"default_headless" toml:"default_headless" env:"DEFAULT_BROWSER_HEADLESS"`
+	ViewportWidth   int    `yaml:"viewport_width" toml:"viewport_width" env:"DEFAULT_BROWSER_VIEWPORT_WIDTH"`
+	ViewportHeight  int    `yaml:"viewport_height" toml:"viewport_height" env:"DEFAULT_BROWSER_VIEWPORT_HEIGHT"`
+	// DefaultTimeout is a session's lifetime in seconds
+	DefaultTimeout int `yaml:"default_timeout" toml:"default_timeout" env:"DEFAULT_BROWSER_TIMEOUT"`
+
+	// WarmPool lists the browsers to keep pre-launched, e.g.
+	// "firefox:headed=2,chromium:headless=1"
+	WarmPool        string        `yaml:"warm_pool" toml:"warm_pool" env:"WARM_POOL"`
+	WarmPoolMaxIdle time.Duration `yaml:"warm_pool_max_idle" toml:"warm_pool_max_idle" env:"WARM_POOL_MAX_IDLE"`
+}
+
+// Sessions configures the background jobs maintaining sessions
+type Sessions struct {
+	// Retention is how long archived sessions are kept; zero keeps them
+	Retention           time.Duration `yaml:"retention" toml:"retention" env:"SESSION_RETENTION"`
+	PurgeInterval       time.Duration `yaml:"purge_interval" toml:"purge_interval" env:"SESSION_PURGE_INTERVAL"`
+	ExpiryInterval      time.Duration `yaml:"expiry_interval" toml:"expiry_interval" env:"SESSION_EXPIRY_INTERVAL"`
+	PendingTimeout      time.Duration `yaml:"pending_timeout" toml:"pending_timeout" env:"PENDING_SESSION_TIMEOUT"`
+	AsyncCreateWorkers  int           `yaml:"async_create_workers" toml:"async_create_workers" env:"ASYNC_CREATE_WORKERS"`
+	UsageRollupInterval time.Duration `yaml:"usage_rollup_interval" toml:"usage_rollup_interval" env:"USAGE_ROLLUP_INTERVAL"`
+}
+
+// Webhooks configures webhook delivery
+type Webhooks struct {
+	DispatchInterval time.Duration `yaml:"dispatch_interval" toml:"dispatch_interval" env:"WEBHOOK_DISPATCH_INTERVAL"`
+	Timeout          time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	// Retention is how long finished deliveries are kept, purged with
+	// archived sessions; zero keeps them
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"WEBHOOK_RETENTION"`
+	// AllowPrivateAddresses lets endpoints resolve to loopback, private and
+	// link-local addresses, which is only safe in local development
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses" toml:"allow_private_addresses" env:"WEBHOOK_ALLOW_PRIVATE_ADDRESSES"`
+}
+
+// Metrics configures the Prometheus listener, which is off without an Addr
+type Metrics struct {
+	Addr  string `yaml:"addr" toml:"addr" env:"METRICS_ADDR"`
+	Token string `yaml:"token" toml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// Telemetry configures the APM provider and trace export
+type Telemetry struct {
+	// Provider is newrelic, otel or none; it defaults to newrelic when a
+	// license key is configured
+	Provider        string `yaml:"provider" toml:"provider" env:"TELEMETRY_PROVIDER"`
+	NewRelicAppName string `yaml:"new_relic_app_name" toml:"new_relic_app_name" env:"NEW_RELIC_APP_NAME"`
+	NewRelicLicense string `yaml:"new_relic_license_key" toml:"new_relic_license_key" env:"NEW_RELIC_LICENSE_KEY" secret:"true"`
+	// NewRelicLicenseFile names a file holding the license key, such as a
+	// mounted secret
+	NewRelicLicenseFile string `yaml:"new_relic_license_key_file" toml:"new_relic_license_key_file" env:"NEW_RELIC_LICENSE_KEY_FILE"`
+	// TracesExporter is none, otlp or stdout
+	TracesExporter string `yaml:"traces_exporter" toml:"traces_exporter" env:"OTEL_TRACES_EXPORTER"`
+	// MetricsExporter is none, otlp or stdout; it defaults to otlp with the
+	// otel provider and none otherwise
+	MetricsExporter string `yaml:"metrics_exporter" toml:"metrics_exporter" env:"OTEL_METRICS_EXPORTER"`
+}
+
+// Logging configures the JSON logs
+type Logging struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	// Levels overrides Level per package, e.g. "browser=debug,database=warn"
+	Levels string `yaml:"levels" toml:"levels" env:"LOG_LEVELS"`
+}
+
+// Default returns the configuration used for everything left unset
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:               8080,
+			ShutdownTimeout:    5 * time.Second,
+			DrainDelay:         5 * time.Second,
+			SessionPolicy:      "leave",
+			HealthCheckTimeout: 2 * time.Second,
+			ExportWriteTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			Port:   5432,
+			Schema: "public",
+		},
+		Auth: Auth{
+			JWTExpiry: 24 * time.Hour,
+		},
+		Browser: Browser{
+			ServerURL:        "http://browser:8000",
+			CreateTimeout:    30 * time.Second,
+			RequestTimeout:   10 * time.Second,
+			MaxRetries:       2,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+			HealthInterval:   10 * time.Second,
+			FakeMaxSessions:  10,
+			DefaultType:      "firefox",
+			ViewportWidth:    1280,
+			ViewportHeight:   720,
+			DefaultTimeout:   3600,
+			WarmPoolMaxIdle:  10 * time.Minute,
+		},
+		Sessions: Sessions{
+			Retention:           30 * 24 * time.Hour,
+			PurgeInterval:       time.Hour,
+			ExpiryInterval:      time.Minute,
+			PendingTimeout:      5 * time.Minute,
+			AsyncCreateWorkers:  4,
+			UsageRollupInterval: 15 * time.Minute,
+		},
+		Webhooks: Webhooks{
+			DispatchInterval: 5 * time.Second,
+			Timeout:          10 * time.Second,
+			Retention:        7 * 24 * time.Hour,
+		},
+		Telemetry: Telemetry{
+			NewRelicAppName: "Orchestrator API",
+			TracesExporter:  "none",
+		},
+		Logging: Logging{
+			Level: "info",
+		},
+	}
+}
+
+// Load reads the configuration with Read and validates it. Every problem
+// found is reported in the returned error, alongside the configuration as far
+// as it could be read.
+func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Read reads the configuration without validating it: the defaults, overlaid
+// with the YAML or TOML file at path, if any, and then the environment. The
+// file format follows its extension.
+func Read(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.resolve()
+}
+
+// FromEnv returns the defaults overlaid with the environment, without
+// validating them, for tools and tests that need only part of the
+// configuration
+func FromEnv() (*Config, error) {
+	return Read("")
+}
+
+// loadFile overlays the settings in a YAML or TOML file
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml, not %q", path, ext)
+	}
+	return nil
+}
+
+// loadEnv overlays every env variable that is set and not empty
+func (c *Config) loadEnv() error {
+	var errs []error
+	walk(reflect.ValueOf(c).Elem(), func(field reflect.StructField, value reflect.Value) {
+		key := field.Tag.Get("env")
+		raw := os.Getenv(key)
+		if key == "" || raw == "" {
+			return
+		}
+		if err := set(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// resolve fills in the settings that depend on others once everything has
+// been read: the license key from its file, the telemetry provider and its
+// metrics exporter, and the browser backend
+func (c *Config) resolve() error {
+	if path := c.Telemetry.NewRelicLicenseFile; path != "" {
+		license, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read NEW_RELIC_LICENSE_KEY_FILE: %w", err)
+		}
+		c.Telemetry.NewRelicLicense = strings.TrimSpace(string(license))
+	}
+	if c.Telemetry.Provider == "" {
+		c.Telemetry.Provider = "none"
+		if c.Telemetry.NewRelicLicense != "" {
+			c.Telemetry.Provider = "newrelic"
+		}
+	}
+	if c.Telemetry.MetricsExporter == "" {
+		c.Telemetry.MetricsExporter = "none"
+		if c.Telemetry.Provider == "otel" {
+			c.Telemetry.MetricsExporter = "otlp"
+		}
+	}
+	if c.Browser.Backend == "" {
+		c.Browser.Backend = "http"
+		if c.Browser.Fallback {
+			c.Browser.Backend = "fake"
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every leaf field of the struct v
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value)) {
+	for i := range v.NumField() {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			walk(value, fn)
+			continue
+		}
+		fn(field, value)
+	}
+}
+
+// set parses raw into a field
+func set(v reflect.Value, raw string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(raw)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with every secret that is set
+// replaced, safe to print or log
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	walk(reflect.ValueOf(&redacted).Elem(), func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString(logging.Redacted)
+		}
+	})
+	return &redacted
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"api-server/internal/logging"
+)
+
+// clearEnv unsets every variable the configuration reads for the duration of
+// the test
+func clearEnv(t *testing.T) {
+	walk(reflect.ValueOf(&Config{}).Elem(), func(field reflect.StructField, _ reflect.Value) {
+		if key := field.Tag.Get("env"); key != "" {
+			t.Setenv(key, "")
+		}
+	})
+}
+
+// writeFile writes a config file into a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// setRequired sets the settings that have no default
+func setRequired(t *testing.T) {
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_USERNAME", "user")
+	t.Setenv("DB_PASSWORD", "password")
+	t.Setenv("DB_DATABASE", "api")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	t.Setenv("SECRETS_KEY", "secrets-key")
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	setRequired(t)
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, 8080, cfg.Server.Port)
+	require.Equal(t, "leave", cfg.Server.SessionPolicy)
+	require.Equal(t, "public", cfg.Database.Schema)
+	require.Equal(t, 24*time.Hour, cfg.Auth.JWTExpiry)
+	require.Equal(t, "http", cfg.Browser.Backend)
+	require.Equal(t, "none", cfg.Telemetry.Provider)
+}
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	setRequired(t)
+
+	yamlPath := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  session_policy: handoff
+browser:
+  server_urls: [http://browser-1:8000, http://browser-2:8000]
+  create_timeout: 45s
+sessions:
+  async_create_workers: 8
+`)
+	tomlPath := writeFile(t, "config.toml", `
+[server]
+port = 9000
+session_policy = "handoff"
+
+[browser]
+server_urls = ["http://browser-1:8000", "http://browser-2:8000"]
+create_timeout = "45s"
+
+[sessions]
+async_create_workers = 8
+`)
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		cfg, err := Load(path)
+		require.NoError(t, err, path)
+		require.Equal(t, 9000, cfg.Server.Port)
+		require.Equal(t, "handoff", cfg.Server.SessionPolicy)
+		require.Equal(t, []string{"http://browser-1:8000", "http://browser-2:8000"}, cfg.Browser.ServerURLs)
+		require.Equal(t, 45*time.Second, cfg.Browser.CreateTimeout)
+		require.Equal(t, 8, cfg.Sessions.AsyncCreateWorkers)
+		// Unset keys keep their defaults
+		require.Equal(t, 10*time.Second, cfg.Browser.RequestTimeout)
+	}
+
+	// The environment overrides the file
+	t.Setenv("PORT", "9100")
+	t.Setenv("BROWSER_SERVER_URLS", "http://browser-3:8000, http://browser-4:8000")
+	t.Setenv("DEFAULT_BROWSER_HEADLESS", "true")
+	cfg, err := Load(yamlPath)
+	require.NoError(t, err)
+	require.Equal(t, 9100, cfg.Server.Port)
+	require.Equal(t, []string{"http://browser-3:8000", "http://browser-4:8000"}, cfg.Browser.ServerURLs)
+	require.True(t, cfg.Browser.DefaultHeadless)
+
+	_, err = Load(writeFile(t, "typo.yaml", "server:\n  prot: 9000\n"))
+	require.ErrorContains(t, err, "prot")
+	_, err = Load(writeFile(t, "typo.toml", "[server]\nprot = 9000\n"))
+	require.ErrorContains(t, err, "prot")
+	_, err = Load(writeFile(t, "config.json", "{}"))
+	require.Error(t, err)
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PORT", "0")
+	t.Setenv("SHUTDOWN_SESSION_POLICY", "drop")
+	t.Setenv("TELEMETRY_PROVIDER", "newrelic")
+	t.Setenv("LOG_LEVELS", "browser")
+
+	// Every problem is reported at once
+	_, err := Load("")
+	require.Error(t, err)
+	for _, want := range []string{
+		"PORT", "SHUTDOWN_SESSION_POLICY", "DB_HOST", "JWT_SECRET",
+		"SECRETS_KEY", "NEW_RELIC_LICENSE_KEY", "LOG_LEVELS",
+	} {
+		require.ErrorContains(t, err, want)
+	}
+
+	// Values that can't be parsed are reported by key
+	t.Setenv("BROWSER_CREATE_TIMEOUT", "soon")
+	t.Setenv("BROWSER_MAX_RETRIES", "many")
+	t.Setenv("DB_AUTO_MIGRATE", "on")
+	_, err = FromEnv()
+	require.ErrorContains(t, err, "BROWSER_CREATE_TIMEOUT")
+	require.ErrorContains(t, err, "BROWSER_MAX_RETRIES")
+	require.ErrorContains(t, err, "DB_AUTO_MIGRATE")
+
+	// Booleans take any spelling strconv.ParseBool does
+	t.Setenv("BROWSER_CREATE_TIMEOUT", "")
+	t.Setenv("BROWSER_MAX_RETRIES", "")
+	t.Setenv("DB_AUTO_MIGRATE", "True")
+	cfg, err := FromEnv()
+	require.NoError(t, err)
+	require.True(t, cfg.Database.AutoMigrate)
+}
+
+func TestResolve(t *testing.T) {
+	clearEnv(t)
+	setRequired(t)
+
+	t.Setenv("BROWSER_SERVER_FALLBACK", "true")
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, "fake", cfg.Browser.Backend)
+
+	// A license key read from a secret file selects New Relic
+	t.Setenv("NEW_RELIC_LICENSE_KEY_FILE", writeFile(t, "license", "secret-license\n"))
+	cfg, err = Load("")
+	require.NoError(t, err)
+	require.Equal(t, "newrelic", cfg.Telemetry.Provider)
+	require.Equal(t, "secret-license", cfg.Telemetry.NewRelicLicense)
+
+	// An explicit provider wins
+	t.Setenv("TELEMETRY_PROVIDER", "otel")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	require.Equal(t, "otel", cfg.Telemetry.Provider)
+	require.Equal(t, "otlp", cfg.Telemetry.MetricsExporter)
+
+	// The otel provider has nothing to record its gauges into without an
+	// exporter
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	_, err = Load("")
+	require.ErrorContains(t, err, "OTEL_METRICS_EXPORTER")
+	t.Setenv("OTEL_METRICS_EXPORTER", "")
+
+	t.Setenv("NEW_RELIC_LICENSE_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = Load("")
+	require.ErrorContains(t, err, "NEW_RELIC_LICENSE_KEY_FILE")
+}
+
+func TestRedacted(t *testing.T) {
+	clearEnv(t)
+	setRequired(t)
+	t.Setenv("BROWSER_SERVER_SECRET", "browser-secret")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	redacted := cfg.Redacted()
+	require.Equal(t, logging.Redacted, redacted.Auth.JWTSecret)
+	require.Equal(t, logging.Redacted, redacted.Database.Password)
+	require.Equal(t, logging.Redacted, redacted.Browser.Secret)
+	// Unset secrets stay empty and other settings are untouched
+	require.Empty(t, redacted.Metrics.Token)
+	require.Equal(t, "user", redacted.Database.Username)
+	// The original keeps its secrets
+	require.Equal(t, "jwt-secret", cfg.Auth.JWTSecret)
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"api-server/internal/logging"
+)
+
+// Accepted values of the enumerated settings
+var (
+	sessionPolicies    = []string{"leave", "stop", "handoff"}
+	browserBackends    = []string{"http", "fake"}
+	telemetryProviders = []string{"newrelic", "otel", "none"}
+	otelExporters      = []string{"none", "otlp", "stdout"}
+)
+
+// problems collects the validation errors of a configuration
+type problems []error
+
+func (p *problems) check(ok bool, format string, args ...any) {
+	if !ok {
+		*p = append(*p, fmt.Errorf(format, args...))
+	}
+}
+
+func (p *problems) oneOf(key, value string, allowed []string) {
+	p.check(slices.Contains(allowed, value), "%s must be one of %v, not %q", key, allowed, value)
+}
+
+func (p *problems) positive(key string, d time.Duration) {
+	p.check(d > 0, "%s must be positive, not %s", key, d)
+}
+
+func (p *problems) nonNegative(key string, d time.Duration) {
+	p.check(d >= 0, "%s must not be negative, not %s", key, d)
+}
+
+// Validate checks the whole configuration and reports every problem found,
+// joined into one error
+func (c *Config) Validate() error {
+	var p problems
+	check, oneOf, positive, nonNegative := p.check, p.oneOf, p.positive, p.nonNegative
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "PORT must be between 1 and 65535, not %d", c.Server.Port)
+	oneOf("SHUTDOWN_SESSION_POLICY", c.Server.SessionPolicy, sessionPolicies)
+	positive("SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	nonNegative("SHUTDOWN_DRAIN_DELAY", c.Server.DrainDelay)
+	positive("HEALTH_CHECK_TIMEOUT", c.Server.HealthCheckTimeout)
+	positive("EXPORT_WRITE_TIMEOUT", c.Server.ExportWriteTimeout)
+
+	c.Database.validate(&p)
+
+	check(c.Auth.JWTSecret != "", "JWT_SECRET is required")
+	positive("JWT_EXPIRY", c.Auth.JWTExpiry)
+	check(c.Auth.SecretsKey != "", "SECRETS_KEY is required")
+
+	oneOf("BROWSER_BACKEND", c.Browser.Backend, browserBackends)
+	if c.Browser.Backend == "http" {
+		check(len(c.Browser.ServerURLs) > 0 || c.Browser.ServerURL != "", "BROWSER_SERVER_URLS or BROWSER_SERVER_URL is required")
+	}
+	check((c.Browser.TLSCertFile == "") == (c.Browser.TLSKeyFile == ""), "BROWSER_TLS_CERT_FILE and BROWSER_TLS_KEY_FILE must be set together")
+	positive("BROWSER_CREATE_TIMEOUT", c.Browser.CreateTimeout)
+	positive("BROWSER_REQUEST_TIMEOUT", c.Browser.RequestTimeout)
+	check(c.Browser.MaxRetries >= 0, "BROWSER_MAX_RETRIES must not be negative, not %d", c.Browser.MaxRetries)
+	check(c.Browser.BreakerThreshold > 0, "BROWSER_BREAKER_THRESHOLD must be positive, not %d", c.Browser.BreakerThreshold)
+	positive("BROWSER_BREAKER_COOLDOWN", c.Browser.BreakerCooldown)
+	positive("BROWSER_HEALTH_INTERVAL", c.Browser.HealthInterval)
+	check(c.Browser.FakeMaxSessions > 0, "FAKE_BROWSER_MAX_SESSIONS must be positive, not %d", c.Browser.FakeMaxSessions)
+	check(c.Browser.ViewportWidth > 0 && c.Browser.ViewportHeight > 0, "DEFAULT_BROWSER_VIEWPORT_WIDTH and DEFAULT_BROWSER_VIEWPORT_HEIGHT must be positive")
+	check(c.Browser.DefaultTimeout > 0, "DEFAULT_BROWSER_TIMEOUT must be positive, not %d", c.Browser.DefaultTimeout)
+	positive("WARM_POOL_MAX_IDLE", c.Browser.WarmPoolMaxIdle)
+
+	nonNegative("SESSION_RETENTION", c.Sessions.Retention)
+	positive("SESSION_PURGE_INTERVAL", c.Sessions.PurgeInterval)
+	positive("SESSION_EXPIRY_INTERVAL", c.Sessions.ExpiryInterval)
+	positive("PENDING_SESSION_TIMEOUT", c.Sessions.PendingTimeout)
+	check(c.Sessions.AsyncCreateWorkers > 0, "ASYNC_CREATE_WORKERS must be positive, not %d", c.Sessions.AsyncCreateWorkers)
+	positive("USAGE_ROLLUP_INTERVAL", c.Sessions.UsageRollupInterval)
+
+	positive("WEBHOOK_DISPATCH_INTERVAL", c.Webhooks.DispatchInterval)
+	positive("WEBHOOK_TIMEOUT", c.Webhooks.Timeout)
+	nonNegative("WEBHOOK_RETENTION", c.Webhooks.Retention)
+
+	oneOf("TELEMETRY_PROVIDER", c.Telemetry.Provider, telemetryProviders)
+	if c.Telemetry.Provider == "newrelic" {
+		check(c.Telemetry.NewRelicLicense != "", "NEW_RELIC_LICENSE_KEY or NEW_RELIC_LICENSE_KEY_FILE is required by the newrelic provider")
+	}
+	oneOf("OTEL_TRACES_EXPORTER", c.Telemetry.TracesExporter, otelExporters)
+	oneOf("OTEL_METRICS_EXPORTER", c.Telemetry.MetricsExporter, otelExporters)
+	if c.Telemetry.Provider == "otel" {
+		check(c.Telemetry.MetricsExporter != "none", "OTEL_METRICS_EXPORTER must be otlp or stdout for the otel provider to export its metrics")
+	}
+
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		p = append(p, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	if _, err := logging.ParseLevels(c.Logging.Levels); err != nil {
+		p = append(p, fmt.Errorf("LOG_LEVELS: %w", err))
+	}
+
+	return errors.Join(p...)
+}
+
+// Validate checks the database settings alone, for commands that only need
+// the database
+func (d Database) Validate() error {
+	var p problems
+	d.validate(&p)
+	return errors.Join(p...)
+}
+
+func (d Database) validate(p *problems) {
+	p.check(d.Host != "", "DB_HOST is required")
+	p.check(d.Port > 0 && d.Port <= 65535, "DB_PORT must be between 1 and 65535, not %d", d.Port)
+	p.check(d.Username != "", "DB_USERNAME is required")
+	p.check(d.Password != "", "DB_PASSWORD is required")
+	p.check(d.Database != "", "DB_DATABASE is required")
+	p.check(d.Schema != "", "DB_SCHEMA is required")
+}
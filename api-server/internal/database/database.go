@@ -4,16 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v5/stdlib"
-	_ "github.com/joho/godotenv/autoload"
+
+	"api-server/internal/config"
+	"api-server/internal/logging"
 )
 
+// logger is the database package's logger
+var logger = logging.For("database")
+
 // Service represents a service that interacts with a database.
 type Service interface {
 	// DB returns the underlying sql.DB connection
@@ -27,20 +30,82 @@ type Service interface {
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
+	// SchemaVersion returns the applied migration version and whether the
+	// last migration failed part way through
+	SchemaVersion(ctx context.Context) (version int, dirty bool, err error)
+
 	// User methods
 	CreateUser(ctx context.Context, u *User) (uuid.UUID, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	ListUsers(ctx context.Context) ([]*User, error)
+	DisableUser(ctx context.Context, id uuid.UUID) (*User, error)
+	IsUserDisabled(ctx context.Context, id uuid.UUID) (bool, error)
 	
 	// Session methods
 	CreateSession(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string) (*Session, error)
+	CreateSessionWithOptions(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string, opts SessionOptions) (*Session, error)
 	GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*Session, error)
+	ListSessions(ctx context.Context, filter SessionFilter) ([]*Session, error)
+	StreamSessions(ctx context.Context, filter SessionFilter, fn func(*Session) error) error
 	GetSessionByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, error)
 	StopSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, error)
+	UpdateSessionEmulation(ctx context.Context, id uuid.UUID, userID uuid.UUID, emulation SessionEmulation) (*Session, error)
 	DeleteSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	PurgeArchivedSessions(ctx context.Context, archivedBefore time.Time) (int64, error)
+	ExpireSessions(ctx context.Context) ([]*Session, error)
+	CompletePendingSession(ctx context.Context, id uuid.UUID, launch SessionLaunch) (*Session, error)
+	FailPendingSession(ctx context.Context, id uuid.UUID, reason string) (*Session, error)
+	FailStalePendingSessions(ctx context.Context, startedBefore time.Time, reason string) ([]*Session, error)
+	CountActiveSessionsByBrowserType(ctx context.Context) (map[string]int, error)
+	ListInstanceSessions(ctx context.Context, instanceID string) ([]*Session, error)
+	ListActiveSessions(ctx context.Context) ([]*Session, error)
+	ReleaseInstanceSessions(ctx context.Context, instanceID string) (int64, error)
+	AdoptOrphanedSessions(ctx context.Context, instanceID string) (int64, error)
+
+	// Sharing methods
+	GetSessionAccess(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, AccessLevel, error)
+	GetSessionsSharedWithUser(ctx context.Context, userID uuid.UUID) ([]*SharedSession, error)
+	CreateSessionShare(ctx context.Context, share *SessionShare) error
+	GetSessionShares(ctx context.Context, sessionID uuid.UUID) ([]*SessionShare, error)
+	RevokeSessionShare(ctx context.Context, sessionID uuid.UUID, shareID uuid.UUID) error
+
+	// Organization methods
+	CreateOrganization(ctx context.Context, org *Organization, ownerID uuid.UUID) error
+	GetOrganizationForUser(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*Organization, error)
+	GetOrganizationsByUserID(ctx context.Context, userID uuid.UUID) ([]*Organization, error)
+	UpdateOrganization(ctx context.Context, org *Organization) error
+	GetOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]*OrganizationMember, error)
+	AddOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role OrgRole) error
+	UpdateOrganizationMemberRole(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role OrgRole) error
+	RemoveOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error
+	GetSessionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*Session, error)
+	CountActiveOrgSessions(ctx context.Context, orgID uuid.UUID) (int, error)
+	RecordOrgAuditEvent(ctx context.Context, e *OrgAuditEvent) error
+	GetOrgAuditEvents(ctx context.Context, orgID uuid.UUID, limit int) ([]*OrgAuditEvent, error)
+
+	// Usage methods
+	RollupUsage(ctx context.Context, from, to time.Time) error
+	UsageRolledUpTo(ctx context.Context) (sql.NullTime, error)
+	GetUsage(ctx context.Context, filter UsageFilter) ([]*UsageRecord, error)
+	IsUserAdmin(ctx context.Context, userID uuid.UUID) (bool, error)
+
+	// Webhook methods
+	CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) error
+	GetWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]*WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, event string, payload []byte) (int64, error)
+	GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, endpointID uuid.UUID, deliveryID uuid.UUID) (*WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	CompleteWebhookDelivery(ctx context.Context, d *WebhookDelivery) error
+	PurgeWebhookDeliveries(ctx context.Context, finishedBefore time.Time) (int64, error)
 }
 
 type service struct {
 	db *sql.DB
+	// name is the database's name, for logging
+	name string
 }
 
 // DB returns the underlying sql.DB connection
@@ -52,40 +117,34 @@ var (
 	dbInstance *service
 )
 
-// New creates a new database service using environment variables for configuration.
-func New() (Service, error) {
+// New creates the database service for the configured connection, reusing
+// it on later calls.
+func New(cfg config.Database) (Service, error) {
 	// Reuse existing connection if already initialised
 	if dbInstance != nil {
 		return dbInstance, nil
 	}
 
-	// Read environment variables at call-time (not package init) so tests can
-	// inject values dynamically.
-	dbName := os.Getenv("DB_DATABASE")
-	pwd := os.Getenv("DB_PASSWORD")
-	user := os.Getenv("DB_USERNAME")
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	schemaName := os.Getenv("DB_SCHEMA")
+	// Basic sanity check
+	if cfg.Host == "" || cfg.Port == 0 || cfg.Username == "" || cfg.Password == "" || cfg.Database == "" {
+		return nil, fmt.Errorf("database configuration not set")
+	}
 
+	schemaName := cfg.Schema
 	// Provide sensible default for search_path when not supplied
 	if schemaName == "" {
 		schemaName = "public"
 	}
 
-	// Basic sanity check
-	if host == "" || port == "" || user == "" || pwd == "" || dbName == "" {
-		return nil, fmt.Errorf("database environment variables not set")
-	}
-
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s",
-		user, pwd, host, port, dbName, schemaName)
+	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable&search_path=%s",
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database, schemaName)
 
 	svc, err := NewWithDSN(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database service: %w", err)
 	}
 
+	svc.name = cfg.Database
 	dbInstance = svc
 	return dbInstance, nil
 }
@@ -128,7 +187,7 @@ func (s *service) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Printf("db down: %v", err) // Log the error but don't terminate
+		logger.Error("Database is down", "error", err) // Log the error but don't terminate
 		return stats
 	}
 
@@ -171,6 +230,6 @@ func (s *service) Health() map[string]string {
 // If the connection is successfully closed, it returns nil.
 // If an error occurs while closing the connection, it returns the error.
 func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", os.Getenv("DB_DATABASE"))
+	logger.Info("Disconnected from database", "database", s.name)
 	return s.db.Close()
 }
@@ -3,19 +3,25 @@ package database
 import (
     "context"
     "database/sql"
+    "fmt"
     "log"
     "os"
     "path/filepath"
-    "sort"
+    "strconv"
     "strings"
+    "sync"
+    "sync/atomic"
     "testing"
     "time"
 
     "github.com/google/uuid"
+    "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
     "github.com/testcontainers/testcontainers-go"
     "github.com/testcontainers/testcontainers-go/modules/postgres"
     "github.com/testcontainers/testcontainers-go/wait"
+
+    "api-server/internal/config"
 )
 
 // Container teardown callback (set in TestMain).
@@ -38,7 +44,7 @@ func TestMain(m *testing.M) {
 
     // Apply migrations so that the schema exists before tests run.
     var err error
-    sharedSvc, err = New()
+    sharedSvc, err = New(testConfig())
     if err != nil {
         log.Fatalf("failed to connect DB in TestMain: %v", err)
     }
@@ -58,8 +64,18 @@ func TestMain(m *testing.M) {
     os.Exit(code)
 }
 
+// testConfig returns the database configuration from the DB_* env vars, as
+// set by startPostgresContainer.
+func testConfig() config.Database {
+    cfg, err := config.FromEnv()
+    if err != nil {
+        log.Fatalf("invalid test configuration: %v", err)
+    }
+    return cfg.Database
+}
+
 // startPostgresContainer provisions a postgres container and sets the DB_* env
-// vars consumed by database.New().
+// vars consumed by testConfig.
 func startPostgresContainer() (func(context.Context, ...testcontainers.TerminateOption) error, error) {
     const (
         dbName = "api"
@@ -100,39 +116,11 @@ func startPostgresContainer() (func(context.Context, ...testcontainers.Terminate
     return pgC.Terminate, nil
 }
 
-// applyMigrations executes all *.up.sql files under migrations/ in lexical
-// order using the provided connection. This avoids an additional dependency on
-// a migration library and keeps the test environment self-contained.
+// applyMigrations brings the schema up to date with the embedded migrations,
+// as the API server does at startup.
 func applyMigrations(db *sql.DB) error {
-    migrationsDir := filepath.Join("..", "..", "migrations") // relative to internal/database/
-    entries, err := os.ReadDir(migrationsDir)
-    if err != nil {
-        return err
-    }
-
-    // select *.up.sql files and sort them for deterministic order
-    var files []string
-    for _, e := range entries {
-        if e.IsDir() {
-            continue
-        }
-        name := e.Name()
-        if strings.HasSuffix(name, ".up.sql") {
-            files = append(files, filepath.Join(migrationsDir, name))
-        }
-    }
-    sort.Strings(files)
-
-    for _, f := range files {
-        content, err := os.ReadFile(f)
-        if err != nil {
-            return err
-        }
-        if _, err := db.Exec(string(content)); err != nil {
-            return err
-        }
-    }
-    return nil
+    _, err := NewMigrator(db).Up(context.Background(), 0)
+    return err
 }
 
 // TestHealth verifies the Health implementation returns an "up" status when
@@ -145,6 +133,66 @@ func TestHealth(t *testing.T) {
     require.NotContains(t, stats, "error", "expected no error field in health response")
 }
 
+// TestMigrations verifies the embedded migrations and that the Migrator
+// records versions as the migrate tool does.
+func TestMigrations(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+    m := NewMigrator(dbSvc.DB())
+
+    // Every migration file is embedded
+    entries, err := os.ReadDir(filepath.Join("..", "..", "migrations"))
+    require.NoError(t, err)
+    newest := 0
+    for _, e := range entries {
+        if !strings.HasSuffix(e.Name(), ".sql") {
+            continue
+        }
+        version, err := strconv.Atoi(strings.SplitN(e.Name(), "_", 2)[0])
+        require.NoError(t, err, e.Name())
+        newest = max(newest, version)
+    }
+    require.Equal(t, newest, LatestSchemaVersion)
+
+    // TestMain applied every migration
+    version, dirty, err := dbSvc.SchemaVersion(ctx)
+    require.NoError(t, err)
+    require.Equal(t, LatestSchemaVersion, version)
+    require.False(t, dirty)
+    applied, err := m.Up(ctx, 0)
+    require.NoError(t, err)
+    require.Empty(t, applied)
+
+    // Down reverts the latest migrations and Up reapplies them
+    reverted, err := m.Down(ctx, 2)
+    require.NoError(t, err)
+    require.Len(t, reverted, 2)
+    require.Equal(t, LatestSchemaVersion, reverted[0].Version)
+    _, _, statuses, err := m.Status(ctx)
+    require.NoError(t, err)
+    require.False(t, statuses[len(statuses)-1].Applied)
+    require.True(t, statuses[len(statuses)-3].Applied)
+
+    applied, err = m.Up(ctx, 1)
+    require.NoError(t, err)
+    require.Len(t, applied, 1)
+    applied, err = m.Up(ctx, 0)
+    require.NoError(t, err)
+    require.Equal(t, LatestSchemaVersion, applied[0].Version)
+
+    // A dirty schema left by the migrate tool blocks migrating until forced
+    _, err = dbSvc.DB().Exec(`UPDATE schema_migrations SET dirty = true`)
+    require.NoError(t, err)
+    _, err = m.Up(ctx, 0)
+    require.ErrorIs(t, err, ErrDirtySchema)
+    require.Error(t, m.Force(ctx, LatestSchemaVersion+1))
+    require.NoError(t, m.Force(ctx, LatestSchemaVersion))
+    version, dirty, err = dbSvc.SchemaVersion(ctx)
+    require.NoError(t, err)
+    require.Equal(t, LatestSchemaVersion, version)
+    require.False(t, dirty)
+}
+
 // TestUserQueries exercises CreateUser and GetUserByEmail.
 func TestUserQueries(t *testing.T) {
     dbSvc := mustDB(t)
@@ -211,13 +259,728 @@ func TestSessionQueries(t *testing.T) {
     require.Error(t, err)
 }
 
+// TestSessionArchiveAndPurge verifies deleted sessions are archived and only
+// removed by the purge once they fall outside the retention window.
+func TestSessionArchiveAndPurge(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "archive@example.com",
+        FirstName:    "Arch",
+        LastName:     "Ive",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    sess, err := dbSvc.CreateSession(ctx, userID, "archived", "b-arch", "chromium", "ws://cdp", true, 1280, 720, nil)
+    require.NoError(t, err)
+
+    // Deleting an active session stops and archives it
+    require.NoError(t, dbSvc.DeleteSession(ctx, sess.ID, userID))
+    require.Error(t, dbSvc.DeleteSession(ctx, sess.ID, userID))
+
+    list, err := dbSvc.GetSessionsByUserID(ctx, userID)
+    require.NoError(t, err)
+    require.Empty(t, list)
+
+    // Still within the retention window
+    purged, err := dbSvc.PurgeArchivedSessions(ctx, time.Now().Add(-time.Hour))
+    require.NoError(t, err)
+    require.Zero(t, purged)
+
+    purged, err = dbSvc.PurgeArchivedSessions(ctx, time.Now().Add(time.Minute))
+    require.NoError(t, err)
+    require.EqualValues(t, 1, purged)
+}
+
+// TestSessionProxyOptions verifies proxy settings round-trip through the sessions table.
+func TestSessionProxyOptions(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "proxy@example.com",
+        FirstName:    "Prox",
+        LastName:     "Y",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    opts := SessionOptions{Proxy: &SessionProxy{
+        Server:            "socks5://proxy.internal:1080",
+        Bypass:            "localhost",
+        Username:          "alice",
+        PasswordEncrypted: "ciphertext",
+    }}
+    sess, err := dbSvc.CreateSessionWithOptions(ctx, userID, "proxied", "browser-id", "chromium", "ws://cdp", true, 1280, 720, nil, opts)
+    require.NoError(t, err)
+    require.Equal(t, opts.Proxy, sess.Proxy)
+
+    fetched, err := dbSvc.GetSessionByID(ctx, sess.ID, userID)
+    require.NoError(t, err)
+    require.Equal(t, opts.Proxy, fetched.Proxy)
+
+    view := fetched.ToView()
+    require.NotNil(t, view.Proxy)
+    require.Equal(t, "alice", view.Proxy.Username)
+
+    // A session without a proxy has no proxy view
+    plain, err := dbSvc.CreateSession(ctx, userID, "direct", "browser-id-2", "firefox", "", false, 1280, 720, nil)
+    require.NoError(t, err)
+    require.Nil(t, plain.Proxy)
+    require.Nil(t, plain.ToView().Proxy)
+}
+
+// TestSessionEmulation verifies emulation overrides are stored at creation and can be replaced.
+func TestSessionEmulation(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "emulation@example.com",
+        FirstName:    "Emu",
+        LastName:     "Lation",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    emulation := SessionEmulation{
+        Locale:      "de-DE",
+        Timezone:    "Europe/Berlin",
+        Geolocation: &SessionGeolocation{Latitude: 52.52, Longitude: 13.405, Accuracy: 10},
+        ColorScheme: "dark",
+    }
+    sess, err := dbSvc.CreateSessionWithOptions(ctx, userID, "berlin", "browser-id", "chromium", "ws://cdp", true, 1280, 720, nil, SessionOptions{Emulation: emulation})
+    require.NoError(t, err)
+    require.Equal(t, emulation, sess.Emulation)
+
+    // Replacing the overrides clears fields that are no longer set
+    updated, err := dbSvc.UpdateSessionEmulation(ctx, sess.ID, userID, SessionEmulation{Locale: "fr-FR"})
+    require.NoError(t, err)
+    require.Equal(t, "fr-FR", updated.Emulation.Locale)
+    require.Empty(t, updated.Emulation.Timezone)
+    require.Nil(t, updated.Emulation.Geolocation)
+
+    // Stopped sessions cannot be changed
+    _, err = dbSvc.StopSession(ctx, sess.ID, userID)
+    require.NoError(t, err)
+    _, err = dbSvc.UpdateSessionEmulation(ctx, sess.ID, userID, emulation)
+    require.Error(t, err)
+}
+
+// TestSessionShares covers granting, checking and revoking access to a session.
+func TestSessionShares(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    ownerID, err := dbSvc.CreateUser(ctx, &User{Email: "owner@example.com", FirstName: "O", LastName: "Wner", PasswordHash: "hashed"})
+    require.NoError(t, err)
+    guestID, err := dbSvc.CreateUser(ctx, &User{Email: "guest@example.com", FirstName: "G", LastName: "Uest", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    sess, err := dbSvc.CreateSession(ctx, ownerID, "shared", "browser-id", "chromium", "ws://cdp", true, 1280, 720, nil)
+    require.NoError(t, err)
+
+    // Without a grant the guest can't see the session
+    _, err = dbSvc.GetSessionByID(ctx, sess.ID, guestID)
+    require.ErrorIs(t, err, ErrSessionNotFound)
+
+    _, access, err := dbSvc.GetSessionAccess(ctx, sess.ID, ownerID)
+    require.NoError(t, err)
+    require.Equal(t, AccessOwner, access)
+
+    // Grant view access, then upgrade it to control
+    share := &SessionShare{SessionID: sess.ID, UserID: guestID, Access: AccessView, CreatedBy: ownerID}
+    require.NoError(t, dbSvc.CreateSessionShare(ctx, share))
+    require.Equal(t, "guest@example.com", share.UserEmail)
+
+    _, access, err = dbSvc.GetSessionAccess(ctx, sess.ID, guestID)
+    require.NoError(t, err)
+    require.Equal(t, AccessView, access)
+
+    upgrade := &SessionShare{SessionID: sess.ID, UserID: guestID, Access: AccessControl, CreatedBy: ownerID}
+    require.NoError(t, dbSvc.CreateSessionShare(ctx, upgrade))
+    require.Equal(t, share.ID, upgrade.ID)
+
+    shared, err := dbSvc.GetSessionsSharedWithUser(ctx, guestID)
+    require.NoError(t, err)
+    require.Len(t, shared, 1)
+    require.Equal(t, AccessControl, shared[0].Access)
+
+    shares, err := dbSvc.GetSessionShares(ctx, sess.ID)
+    require.NoError(t, err)
+    require.Len(t, shares, 1)
+
+    // Revoking removes access
+    require.NoError(t, dbSvc.RevokeSessionShare(ctx, sess.ID, share.ID))
+    require.ErrorIs(t, dbSvc.RevokeSessionShare(ctx, sess.ID, share.ID), ErrShareNotFound)
+    _, _, err = dbSvc.GetSessionAccess(ctx, sess.ID, guestID)
+    require.ErrorIs(t, err, ErrSessionNotFound)
+
+    // Expired grants are ignored
+    expired := &SessionShare{
+        SessionID: sess.ID, UserID: guestID, Access: AccessView, CreatedBy: ownerID,
+        ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+    }
+    require.NoError(t, dbSvc.CreateSessionShare(ctx, expired))
+    _, err = dbSvc.GetSessionByID(ctx, sess.ID, guestID)
+    require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+// TestOrganizationSessions verifies org membership grants control over org-owned sessions.
+func TestOrganizationSessions(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    ownerID, err := dbSvc.CreateUser(ctx, &User{Email: "org-owner@example.com", FirstName: "O", LastName: "O", PasswordHash: "hashed"})
+    require.NoError(t, err)
+    memberID, err := dbSvc.CreateUser(ctx, &User{Email: "org-member@example.com", FirstName: "M", LastName: "M", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    org := &Organization{Name: "Acme", MaxActiveSessions: sql.NullInt64{Int64: 2, Valid: true}}
+    require.NoError(t, dbSvc.CreateOrganization(ctx, org, ownerID))
+    require.Equal(t, OrgRoleOwner, org.Role)
+
+    // Non-members can't see the organization
+    _, err = dbSvc.GetOrganizationForUser(ctx, org.ID, memberID)
+    require.ErrorIs(t, err, ErrOrganizationNotFound)
+
+    require.NoError(t, dbSvc.AddOrganizationMember(ctx, org.ID, memberID, OrgRoleMember))
+    members, err := dbSvc.GetOrganizationMembers(ctx, org.ID)
+    require.NoError(t, err)
+    require.Len(t, members, 2)
+
+    sess, err := dbSvc.CreateSessionWithOptions(ctx, ownerID, "team", "browser-id", "chromium", "ws://cdp", true, 1280, 720, nil,
+        SessionOptions{OrgID: uuid.NullUUID{UUID: org.ID, Valid: true}})
+    require.NoError(t, err)
+    require.Equal(t, org.ID, sess.OrgID.UUID)
+
+    _, access, err := dbSvc.GetSessionAccess(ctx, sess.ID, memberID)
+    require.NoError(t, err)
+    require.Equal(t, AccessControl, access)
+
+    orgSessions, err := dbSvc.GetSessionsByOrgID(ctx, org.ID)
+    require.NoError(t, err)
+    require.Len(t, orgSessions, 1)
+
+    active, err := dbSvc.CountActiveOrgSessions(ctx, org.ID)
+    require.NoError(t, err)
+    require.Equal(t, 1, active)
+
+    // Concurrent creates can't take the organization past its quota of 2
+    var wg sync.WaitGroup
+    var created atomic.Int32
+    for i := range 5 {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := dbSvc.CreateSessionWithOptions(ctx, ownerID, "team", fmt.Sprintf("quota-%d", i), "chromium", "ws://cdp", true, 1280, 720, nil,
+                SessionOptions{OrgID: uuid.NullUUID{UUID: org.ID, Valid: true}})
+            if err == nil {
+                created.Add(1)
+            } else {
+                assert.ErrorIs(t, err, ErrOrgQuotaReached)
+            }
+        }()
+    }
+    wg.Wait()
+    require.EqualValues(t, 1, created.Load())
+    active, err = dbSvc.CountActiveOrgSessions(ctx, org.ID)
+    require.NoError(t, err)
+    require.Equal(t, 2, active)
+
+    // Removed members lose access
+    require.NoError(t, dbSvc.RemoveOrganizationMember(ctx, org.ID, memberID))
+    _, _, err = dbSvc.GetSessionAccess(ctx, sess.ID, memberID)
+    require.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+// TestOrganizationMemberRoles covers adding members and changing roles
+// without ever leaving an organization ownerless.
+func TestOrganizationMemberRoles(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    ownerID, err := dbSvc.CreateUser(ctx, &User{Email: "roles-owner@example.com", FirstName: "O", LastName: "O", PasswordHash: "hashed"})
+    require.NoError(t, err)
+    adminID, err := dbSvc.CreateUser(ctx, &User{Email: "roles-admin@example.com", FirstName: "A", LastName: "A", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    org := &Organization{Name: "Roles"}
+    require.NoError(t, dbSvc.CreateOrganization(ctx, org, ownerID))
+    require.NoError(t, dbSvc.AddOrganizationMember(ctx, org.ID, adminID, OrgRoleAdmin))
+
+    // Adding an existing member doesn't change their role
+    require.ErrorIs(t, dbSvc.AddOrganizationMember(ctx, org.ID, ownerID, OrgRoleMember), ErrMemberExists)
+    owner, err := dbSvc.GetOrganizationForUser(ctx, org.ID, ownerID)
+    require.NoError(t, err)
+    require.Equal(t, OrgRoleOwner, owner.Role)
+
+    // The only owner can't be demoted
+    require.ErrorIs(t, dbSvc.UpdateOrganizationMemberRole(ctx, org.ID, ownerID, OrgRoleMember), ErrLastOwner)
+
+    // Once there is another owner they can
+    require.NoError(t, dbSvc.UpdateOrganizationMemberRole(ctx, org.ID, adminID, OrgRoleOwner))
+    require.NoError(t, dbSvc.UpdateOrganizationMemberRole(ctx, org.ID, ownerID, OrgRoleMember))
+    demoted, err := dbSvc.GetOrganizationForUser(ctx, org.ID, ownerID)
+    require.NoError(t, err)
+    require.Equal(t, OrgRoleMember, demoted.Role)
+
+    require.ErrorIs(t, dbSvc.UpdateOrganizationMemberRole(ctx, org.ID, uuid.New(), OrgRoleAdmin), ErrMemberNotFound)
+}
+
+// TestOrganizationAuditEvents covers recording and listing an organization's
+// audit log
+func TestOrganizationAuditEvents(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    ownerID, err := dbSvc.CreateUser(ctx, &User{Email: "audit-owner@example.com", FirstName: "O", LastName: "O", PasswordHash: "hashed"})
+    require.NoError(t, err)
+    memberID, err := dbSvc.CreateUser(ctx, &User{Email: "audit-member@example.com", FirstName: "M", LastName: "M", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    org := &Organization{Name: "Audited"}
+    require.NoError(t, dbSvc.CreateOrganization(ctx, org, ownerID))
+    other := &Organization{Name: "Other"}
+    require.NoError(t, dbSvc.CreateOrganization(ctx, other, ownerID))
+
+    require.NoError(t, dbSvc.RecordOrgAuditEvent(ctx, &OrgAuditEvent{OrgID: org.ID, ActorID: ownerID, Action: AuditOrgCreated, Detail: "Audited"}))
+    added := &OrgAuditEvent{
+        OrgID:        org.ID,
+        ActorID:      ownerID,
+        Action:       AuditMemberAdded,
+        TargetUserID: uuid.NullUUID{UUID: memberID, Valid: true},
+        Detail:       string(OrgRoleMember),
+    }
+    require.NoError(t, dbSvc.RecordOrgAuditEvent(ctx, added))
+    require.NotEqual(t, uuid.Nil, added.ID)
+    require.False(t, added.CreatedAt.IsZero())
+    require.NoError(t, dbSvc.RecordOrgAuditEvent(ctx, &OrgAuditEvent{OrgID: other.ID, ActorID: ownerID, Action: AuditOrgCreated}))
+
+    // Newest first, and only the organization's own events
+    events, err := dbSvc.GetOrgAuditEvents(ctx, org.ID, 10)
+    require.NoError(t, err)
+    require.Len(t, events, 2)
+    require.Equal(t, AuditMemberAdded, events[0].Action)
+    require.Equal(t, memberID, events[0].TargetUserID.UUID)
+    require.Equal(t, AuditOrgCreated, events[1].Action)
+
+    events, err = dbSvc.GetOrgAuditEvents(ctx, org.ID, 1)
+    require.NoError(t, err)
+    require.Len(t, events, 1)
+}
+
+// TestInstanceSessions covers the ownership of sessions by API server
+// instances: listing, handing off and adopting them.
+func TestInstanceSessions(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{Email: "instance@example.com", FirstName: "I", LastName: "N", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    owned, err := dbSvc.CreateSessionWithOptions(ctx, userID, "owned", "b-owned", "firefox", "ws://x", true, 800, 600, nil, SessionOptions{InstanceID: "instance-a"})
+    require.NoError(t, err)
+    require.Equal(t, "instance-a", owned.InstanceID)
+    stopped, err := dbSvc.CreateSessionWithOptions(ctx, userID, "stopped", "b-stopped", "firefox", "ws://x", true, 800, 600, nil, SessionOptions{InstanceID: "instance-a"})
+    require.NoError(t, err)
+    _, err = dbSvc.StopSession(ctx, stopped.ID, userID)
+    require.NoError(t, err)
+
+    // Only active sessions are listed and handed off
+    sessions, err := dbSvc.ListInstanceSessions(ctx, "instance-a")
+    require.NoError(t, err)
+    require.Len(t, sessions, 1)
+    require.Equal(t, owned.ID, sessions[0].ID)
+
+    released, err := dbSvc.ReleaseInstanceSessions(ctx, "instance-a")
+    require.NoError(t, err)
+    require.EqualValues(t, 1, released)
+    sessions, err = dbSvc.ListInstanceSessions(ctx, "instance-a")
+    require.NoError(t, err)
+    require.Empty(t, sessions)
+
+    adopted, err := dbSvc.AdoptOrphanedSessions(ctx, "instance-b")
+    require.NoError(t, err)
+    require.GreaterOrEqual(t, adopted, int64(1))
+    sessions, err = dbSvc.ListInstanceSessions(ctx, "instance-b")
+    require.NoError(t, err)
+    var ids []uuid.UUID
+    for _, session := range sessions {
+        ids = append(ids, session.ID)
+    }
+    require.Contains(t, ids, owned.ID)
+}
+
+func TestAdminQueries(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{Email: "admin-queries@example.com", FirstName: "A", LastName: "Q", PasswordHash: "hashed"})
+    require.NoError(t, err)
+
+    users, err := dbSvc.ListUsers(ctx)
+    require.NoError(t, err)
+    var emails []string
+    for _, u := range users {
+        emails = append(emails, u.Email)
+    }
+    require.Contains(t, emails, "admin-queries@example.com")
+
+    // Disabling is recorded once and survives a second disable
+    disabled, err := dbSvc.DisableUser(ctx, userID)
+    require.NoError(t, err)
+    require.True(t, disabled.DisabledAt.Valid)
+    again, err := dbSvc.DisableUser(ctx, userID)
+    require.NoError(t, err)
+    require.True(t, again.DisabledAt.Time.Equal(disabled.DisabledAt.Time))
+    loaded, err := dbSvc.GetUserByEmail(ctx, "admin-queries@example.com")
+    require.NoError(t, err)
+    require.True(t, loaded.DisabledAt.Valid)
+    _, err = dbSvc.DisableUser(ctx, uuid.New())
+    require.ErrorIs(t, err, ErrUserNotFound)
+    isDisabled, err := dbSvc.IsUserDisabled(ctx, userID)
+    require.NoError(t, err)
+    require.True(t, isDisabled)
+    _, err = dbSvc.IsUserDisabled(ctx, uuid.New())
+    require.ErrorIs(t, err, ErrUserNotFound)
+
+    // Active sessions of every user are listed, stopped ones aren't
+    active, err := dbSvc.CreateSession(ctx, userID, "active", "b-admin-active", "firefox", "ws://x", true, 800, 600, nil)
+    require.NoError(t, err)
+    stopped, err := dbSvc.CreateSession(ctx, userID, "stopped", "b-admin-stopped", "firefox", "ws://x", true, 800, 600, nil)
+    require.NoError(t, err)
+    _, err = dbSvc.StopSession(ctx, stopped.ID, userID)
+    require.NoError(t, err)
+
+    sessions, err := dbSvc.ListActiveSessions(ctx)
+    require.NoError(t, err)
+    var ids []uuid.UUID
+    for _, session := range sessions {
+        require.False(t, session.StoppedAt.Valid)
+        ids = append(ids, session.ID)
+    }
+    require.Contains(t, ids, active.ID)
+    require.NotContains(t, ids, stopped.ID)
+}
+
 // mustDB is a helper that returns a ready Service instance or fails the test.
 func mustDB(t *testing.T) Service {
     t.Helper()
     if sharedSvc != nil {
         return sharedSvc
     }
-    dbSvc, err := New()
+    dbSvc, err := New(testConfig())
     require.NoError(t, err)
     return dbSvc
 }
+
+// TestUsageRollup verifies session time is split across UTC days and browser types.
+func TestUsageRollup(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "usage@example.com",
+        FirstName:    "Use",
+        LastName:     "Age",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    sess, err := dbSvc.CreateSession(ctx, userID, "overnight", "b-usage", "chromium", "ws://cdp", true, 1280, 720, nil)
+    require.NoError(t, err)
+
+    // Backdate the session to run 23:00 - 01:30 UTC across two days
+    day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+    _, err = dbSvc.DB().ExecContext(ctx,
+        `UPDATE sessions SET started_at = $2, stopped_at = $3 WHERE id = $1`,
+        sess.ID, day.Add(23*time.Hour), day.Add(25*time.Hour+30*time.Minute))
+    require.NoError(t, err)
+
+    // Before any rollup, rolling up starts from the earliest session
+    start, err := dbSvc.UsageRolledUpTo(ctx)
+    require.NoError(t, err)
+    require.True(t, start.Valid)
+    require.False(t, start.Time.After(day.Add(23*time.Hour)))
+
+    require.NoError(t, dbSvc.RollupUsage(ctx, day, day.AddDate(0, 0, 2)))
+    // Rolling up again replaces rather than adds
+    require.NoError(t, dbSvc.RollupUsage(ctx, day, day.AddDate(0, 0, 2)))
+
+    // The end of the rollup is kept, but not by a rollup leaving a gap
+    rolledUpTo, err := dbSvc.UsageRolledUpTo(ctx)
+    require.NoError(t, err)
+    require.True(t, rolledUpTo.Time.Equal(day.AddDate(0, 0, 2)))
+    require.NoError(t, dbSvc.RollupUsage(ctx, day.AddDate(0, 0, 5), day.AddDate(0, 0, 6)))
+    rolledUpTo, err = dbSvc.UsageRolledUpTo(ctx)
+    require.NoError(t, err)
+    require.True(t, rolledUpTo.Time.Equal(day.AddDate(0, 0, 2)))
+
+    // Rolling up from inside a day recomputes the whole day, including
+    // sessions that ended before from
+    require.NoError(t, dbSvc.RollupUsage(ctx, day.Add(36*time.Hour), day.AddDate(0, 0, 2)))
+
+    usage, err := dbSvc.GetUsage(ctx, UsageFilter{
+        UserID: uuid.NullUUID{UUID: userID, Valid: true},
+        From:   day,
+        To:     day.AddDate(0, 0, 1),
+    })
+    require.NoError(t, err)
+    require.Len(t, usage, 2)
+    require.Equal(t, "chromium", usage[0].BrowserType)
+    require.EqualValues(t, 3600, usage[0].BrowserSeconds)
+    require.EqualValues(t, 5400, usage[1].BrowserSeconds)
+    require.Equal(t, 1, usage[1].SessionCount)
+
+    isAdmin, err := dbSvc.IsUserAdmin(ctx, userID)
+    require.NoError(t, err)
+    require.False(t, isAdmin)
+}
+
+// TestUsageRollupDropsFailedSessions verifies re-rolling removes the usage of
+// a pending session that has since failed.
+func TestUsageRollupDropsFailedSessions(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "usage-failed@example.com",
+        FirstName:    "Use",
+        LastName:     "Age",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    pending, err := dbSvc.CreateSessionWithOptions(ctx, userID, "launching", "", "webkit", "", true, 1280, 720, nil,
+        SessionOptions{State: SessionPending})
+    require.NoError(t, err)
+
+    // The pending session is counted, as it may still launch
+    today := time.Now().UTC().Truncate(24 * time.Hour)
+    filter := UsageFilter{UserID: uuid.NullUUID{UUID: userID, Valid: true}, From: today, To: today}
+    require.NoError(t, dbSvc.RollupUsage(ctx, today, today.AddDate(0, 0, 1)))
+    usage, err := dbSvc.GetUsage(ctx, filter)
+    require.NoError(t, err)
+    require.Len(t, usage, 1)
+    require.Equal(t, 1, usage[0].SessionCount)
+
+    // Once it fails, re-rolling the day drops the row it was alone in
+    _, err = dbSvc.FailPendingSession(ctx, pending.ID, "boom")
+    require.NoError(t, err)
+    require.NoError(t, dbSvc.RollupUsage(ctx, today, today.AddDate(0, 0, 1)))
+    usage, err = dbSvc.GetUsage(ctx, filter)
+    require.NoError(t, err)
+    require.Empty(t, usage)
+}
+
+// TestWebhookQueue verifies events fan out to subscribed endpoints and move
+// through the delivery queue.
+func TestWebhookQueue(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "hooks@example.com",
+        FirstName:    "Web",
+        LastName:     "Hook",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    all := &WebhookEndpoint{UserID: userID, URL: "https://ci.example.com/all", SecretEncrypted: "enc"}
+    require.NoError(t, dbSvc.CreateWebhookEndpoint(ctx, all))
+    stops := &WebhookEndpoint{UserID: userID, URL: "https://ci.example.com/stops", SecretEncrypted: "enc", Events: []string{"session.stopped"}}
+    require.NoError(t, dbSvc.CreateWebhookEndpoint(ctx, stops))
+
+    queued, err := dbSvc.EnqueueWebhookEvent(ctx, userID, "session.started", []byte(`{"event":"session.started"}`))
+    require.NoError(t, err)
+    require.EqualValues(t, 1, queued)
+    queued, err = dbSvc.EnqueueWebhookEvent(ctx, userID, "session.stopped", []byte(`{"event":"session.stopped"}`))
+    require.NoError(t, err)
+    require.EqualValues(t, 2, queued)
+
+    claimed, err := dbSvc.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Len(t, claimed, 3)
+    require.NotEmpty(t, claimed[0].EndpointURL)
+
+    // Claimed deliveries aren't handed out again while leased
+    again, err := dbSvc.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+    require.NoError(t, err)
+    require.Empty(t, again)
+
+    for _, d := range claimed {
+        d.Attempts++
+        d.Status = DeliverySucceeded
+        d.ResponseStatus = sql.NullInt64{Int64: 200, Valid: true}
+        require.NoError(t, dbSvc.CompleteWebhookDelivery(ctx, d))
+    }
+
+    history, err := dbSvc.GetWebhookDeliveries(ctx, stops.ID, 10)
+    require.NoError(t, err)
+    require.Len(t, history, 1)
+    require.Equal(t, DeliverySucceeded, history[0].Status)
+
+    replay, err := dbSvc.ReplayWebhookDelivery(ctx, stops.ID, history[0].ID)
+    require.NoError(t, err)
+    require.Equal(t, DeliveryPending, replay.Status)
+    require.JSONEq(t, string(history[0].Payload), string(replay.Payload))
+
+    _, err = dbSvc.ReplayWebhookDelivery(ctx, all.ID, history[0].ID)
+    require.ErrorIs(t, err, ErrDeliveryNotFound)
+
+    // Finished deliveries are purged once past the cutoff; the pending replay
+    // stays queued
+    purged, err := dbSvc.PurgeWebhookDeliveries(ctx, time.Now().Add(-time.Hour))
+    require.NoError(t, err)
+    require.Zero(t, purged)
+    purged, err = dbSvc.PurgeWebhookDeliveries(ctx, time.Now().Add(time.Hour))
+    require.NoError(t, err)
+    require.EqualValues(t, 3, purged)
+    history, err = dbSvc.GetWebhookDeliveries(ctx, stops.ID, 10)
+    require.NoError(t, err)
+    require.Len(t, history, 1)
+    require.Equal(t, replay.ID, history[0].ID)
+}
+
+// TestExpireSessions verifies sessions past their expiry time are stopped.
+func TestExpireSessions(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "expiry@example.com",
+        FirstName:    "Ex",
+        LastName:     "Pired",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    expiresAt := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+    sess, err := dbSvc.CreateSessionWithOptions(ctx, userID, "expiring", "b-exp", "chromium", "ws://cdp", true, 1280, 720, nil,
+        SessionOptions{ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true}})
+    require.NoError(t, err)
+
+    expired, err := dbSvc.ExpireSessions(ctx)
+    require.NoError(t, err)
+    require.Len(t, expired, 1)
+    require.Equal(t, sess.ID, expired[0].ID)
+    require.True(t, expired[0].StoppedAt.Time.Equal(expiresAt))
+
+    expired, err = dbSvc.ExpireSessions(ctx)
+    require.NoError(t, err)
+    require.Empty(t, expired)
+}
+
+
+// TestSessionBrowserNode verifies the hosting node is recorded on the session.
+func TestSessionBrowserNode(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "node@example.com",
+        FirstName:    "No",
+        LastName:     "De",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    sess, err := dbSvc.CreateSessionWithOptions(ctx, userID, "placed", "b-node", "chromium", "ws://cdp", true, 1280, 720, nil,
+        SessionOptions{BrowserNode: "http://browser-2:8000"})
+    require.NoError(t, err)
+
+    fetched, err := dbSvc.GetSessionByID(ctx, sess.ID, userID)
+    require.NoError(t, err)
+    require.Equal(t, "http://browser-2:8000", fetched.BrowserNode)
+
+    // Sessions created without a pool have no node
+    plain, err := dbSvc.CreateSession(ctx, userID, "unplaced", "b-plain", "chromium", "ws://cdp", true, 1280, 720, nil)
+    require.NoError(t, err)
+    require.Empty(t, plain.BrowserNode)
+}
+
+// TestPendingSessionLifecycle covers sessions created before their browser launches.
+func TestPendingSessionLifecycle(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "pending@example.com",
+        FirstName:    "Pen",
+        LastName:     "Ding",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    pending, err := dbSvc.CreateSessionWithOptions(ctx, userID, "launching", "", "firefox", "", false, 1280, 720, nil,
+        SessionOptions{State: SessionPending})
+    require.NoError(t, err)
+    require.Equal(t, SessionPending, pending.ToView().State)
+
+    running, err := dbSvc.CompletePendingSession(ctx, pending.ID, SessionLaunch{
+        BrowserID:   "b-launched",
+        BrowserType: "firefox",
+        CdpURL:      "ws://cdp",
+        ViewportW:   1280,
+        ViewportH:   720,
+        BrowserNode: "http://browser-1:8000",
+    })
+    require.NoError(t, err)
+    require.Equal(t, SessionRunning, running.State)
+    require.Equal(t, "b-launched", running.BrowserID)
+    require.Equal(t, "http://browser-1:8000", running.BrowserNode)
+
+    // Only pending sessions can be completed or failed
+    _, err = dbSvc.CompletePendingSession(ctx, pending.ID, SessionLaunch{})
+    require.ErrorIs(t, err, ErrSessionNotFound)
+    _, err = dbSvc.FailPendingSession(ctx, pending.ID, "boom")
+    require.ErrorIs(t, err, ErrSessionNotFound)
+
+    // Sessions stuck pending are failed and stopped
+    stuck, err := dbSvc.CreateSessionWithOptions(ctx, userID, "stuck", "", "firefox", "", false, 1280, 720, nil,
+        SessionOptions{State: SessionPending})
+    require.NoError(t, err)
+    failed, err := dbSvc.FailStalePendingSessions(ctx, time.Now().Add(time.Minute), "Browser launch did not complete")
+    require.NoError(t, err)
+    require.Len(t, failed, 1)
+    require.Equal(t, stuck.ID, failed[0].ID)
+
+    view := failed[0].ToView()
+    require.Equal(t, SessionFailed, view.State)
+    require.False(t, view.Active)
+    require.Equal(t, "Browser launch did not complete", *view.Error)
+}
+
+func TestCountActiveSessionsByBrowserType(t *testing.T) {
+    dbSvc := mustDB(t)
+    ctx := context.Background()
+
+    userID, err := dbSvc.CreateUser(ctx, &User{
+        Email:        "counts@example.com",
+        FirstName:    "Count",
+        LastName:     "Ing",
+        PasswordHash: "hashed",
+    })
+    require.NoError(t, err)
+
+    before, err := dbSvc.CountActiveSessionsByBrowserType(ctx)
+    require.NoError(t, err)
+
+    for _, browserType := range []string{"firefox", "firefox", "chromium"} {
+        _, err := dbSvc.CreateSession(ctx, userID, "counted", "b-"+uuid.NewString(), browserType, "ws://cdp", true, 1280, 720, nil)
+        require.NoError(t, err)
+    }
+    stopped, err := dbSvc.CreateSession(ctx, userID, "stopped", "b-"+uuid.NewString(), "chromium", "ws://cdp", true, 1280, 720, nil)
+    require.NoError(t, err)
+    _, err = dbSvc.StopSession(ctx, stopped.ID, userID)
+    require.NoError(t, err)
+
+    after, err := dbSvc.CountActiveSessionsByBrowserType(ctx)
+    require.NoError(t, err)
+    require.Equal(t, before["firefox"]+2, after["firefox"])
+    require.Equal(t, before["chromium"]+1, after["chromium"])
+}
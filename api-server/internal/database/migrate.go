@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"api-server/migrations"
+)
+
+// ErrDirtySchema is returned when the last migration failed part way through
+// and the schema must be repaired by hand, then recorded with Force
+var ErrDirtySchema = errors.New("schema is dirty")
+
+// migrationLockID is the advisory lock held while migrating, so instances
+// starting together apply each migration once
+const migrationLockID = 7_212_505_614
+
+// migrationFileName matches NNNNNN_description.up.sql and .down.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema
+type Migration struct {
+	Version int
+	Name    string
+
+	up, down string
+}
+
+// embeddedMigrations are the migrations compiled into the binary
+var embeddedMigrations = mustLoadMigrations(migrations.FS)
+
+// LatestSchemaVersion is the version of the newest embedded migration, which
+// is the schema this build expects
+var LatestSchemaVersion = embeddedMigrations[len(embeddedMigrations)-1].Version
+
+// loadMigrations reads the migration files in fsys, ordered by version
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		match := migrationFileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	var loaded []Migration
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up migration", m.Version, m.Name)
+		}
+		loaded = append(loaded, *m)
+	}
+	if len(loaded) == 0 {
+		return nil, errors.New("no migrations found")
+	}
+	slices.SortFunc(loaded, func(a, b Migration) int { return a.Version - b.Version })
+	return loaded, nil
+}
+
+func mustLoadMigrations(fsys fs.FS) []Migration {
+	loaded, err := loadMigrations(fsys)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded migrations: %v", err))
+	}
+	return loaded
+}
+
+// Migrator applies migrations, recording the schema version in the
+// schema_migrations table the migrate tool uses, so either can take over from
+// the other. Each migration runs in a transaction along with its version
+// update, under an advisory lock.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator applying the embedded migrations to db
+func NewMigrator(db *sql.DB) *Migrator {
+	return &Migrator{db: db, migrations: embeddedMigrations}
+}
+
+// MigrationStatus reports a migration and whether it is applied
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Status returns the schema version and every migration, marked applied up
+// to that version
+func (m *Migrator) Status(ctx context.Context) (version int, dirty bool, statuses []MigrationStatus, err error) {
+	version, dirty, err = schemaVersion(ctx, m.db)
+	if err != nil {
+		return 0, false, nil, err
+	}
+	for _, migration := range m.migrations {
+		statuses = append(statuses, MigrationStatus{Migration: migration, Applied: migration.Version <= version})
+	}
+	return version, dirty, statuses, nil
+}
+
+// Up applies up to n pending migrations, or all of them when n is zero or
+// less, and returns those applied
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, version int) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if n > 0 && len(applied) == n {
+				break
+			}
+			if err := m.apply(ctx, conn, migration.up, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.InfoContext(ctx, "Applied migration", "version", migration.Version, "name", migration.Name)
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the n latest applied migrations and returns those reverted
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, version int) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < n; i-- {
+			migration := m.migrations[i]
+			if migration.Version > version {
+				continue
+			}
+			if migration.down == "" {
+				return fmt.Errorf("migration %d_%s can't be reverted: it has no down migration", migration.Version, migration.Name)
+			}
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, conn, migration.down, previous); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			logger.InfoContext(ctx, "Reverted migration", "version", migration.Version, "name", migration.Name)
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records version as the schema version and clears the dirty flag,
+// without running any migration, once a failed migration has been repaired
+// by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+		return fmt.Errorf("no migration has version %d", version)
+	}
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := setSchemaVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked calls fn with the current schema version while holding the
+// migration lock. It fails with ErrDirtySchema rather than migrate a dirty
+// schema.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, version int) error) error {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	version, dirty, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d: repair it, then force the version", ErrDirtySchema, version)
+	}
+	return fn(conn, version)
+}
+
+// lock takes the migration lock on a dedicated connection, waiting for
+// another instance's migrations to finish, and creates schema_migrations
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, func(), error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	unlock := func() {
+		// The lock is released with the session if this fails
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+		conn.Close()
+	}
+
+	q := `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`
+	if _, err := conn.ExecContext(ctx, q); err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return conn, unlock, nil
+}
+
+// apply runs a migration script and records the resulting version in one
+// transaction, so a failed migration leaves the schema as it was
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := setSchemaVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setSchemaVersion records a clean version, as the migrate tool does: a
+// single row, none once every migration is reverted
+func setSchemaVersion(ctx context.Context, tx *sql.Tx, version int) error {
+	if _, err := tx.ExecContext(ctx, `TRUNCATE schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
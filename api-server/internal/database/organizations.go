@@ -0,0 +1,516 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrOrganizationNotFound is returned when the organization doesn't exist or the caller isn't a member.
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrMemberNotFound is returned when the user isn't a member of the organization.
+	ErrMemberNotFound = errors.New("member not found")
+	// ErrMemberExists is returned when adding a user who is already a member.
+	ErrMemberExists = errors.New("user is already a member")
+	// ErrLastOwner is returned when a change would leave an organization without an owner.
+	ErrLastOwner = errors.New("an organization must keep at least one owner")
+	// ErrOrgQuotaReached is returned when an organization already has as many active sessions as its quota allows.
+	ErrOrgQuotaReached = errors.New("organization active session quota reached")
+)
+
+// OrgRole is a member's role within an organization
+type OrgRole string
+
+const (
+	// OrgRoleOwner can manage the organization, its members and quota
+	OrgRoleOwner OrgRole = "owner"
+	// OrgRoleAdmin can manage members
+	OrgRoleAdmin OrgRole = "admin"
+	// OrgRoleMember can use the organization's sessions
+	OrgRoleMember OrgRole = "member"
+)
+
+// Valid reports whether r is a known role
+func (r OrgRole) Valid() bool {
+	return r == OrgRoleOwner || r == OrgRoleAdmin || r == OrgRoleMember
+}
+
+// CanManageMembers reports whether the role may add and remove members
+func (r OrgRole) CanManageMembers() bool {
+	return r == OrgRoleOwner || r == OrgRoleAdmin
+}
+
+// Organization holds a row from organizations
+type Organization struct {
+	ID                uuid.UUID
+	Name              string
+	MaxActiveSessions sql.NullInt64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	// Role of the user the organization was loaded for, if any
+	Role OrgRole
+}
+
+// OrganizationView is the public representation of an Organization
+type OrganizationView struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	MaxActiveSessions *int64    `json:"max_active_sessions"`
+	Role              string    `json:"role,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// ToView converts an Organization to an OrganizationView
+func (o *Organization) ToView() *OrganizationView {
+	view := &OrganizationView{
+		ID:        o.ID.String(),
+		Name:      o.Name,
+		Role:      string(o.Role),
+		CreatedAt: o.CreatedAt,
+	}
+	if o.MaxActiveSessions.Valid {
+		limit := o.MaxActiveSessions.Int64
+		view.MaxActiveSessions = &limit
+	}
+	return view
+}
+
+// OrganizationMember holds a row from organization_members joined with users
+type OrganizationMember struct {
+	OrgID     uuid.UUID
+	UserID    uuid.UUID
+	Email     string
+	FirstName string
+	LastName  string
+	Role      OrgRole
+	CreatedAt time.Time
+}
+
+// OrganizationMemberView is the public representation of an OrganizationMember
+type OrganizationMemberView struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToView converts an OrganizationMember to an OrganizationMemberView
+func (m *OrganizationMember) ToView() *OrganizationMemberView {
+	return &OrganizationMemberView{
+		UserID:    m.UserID.String(),
+		Email:     m.Email,
+		FirstName: m.FirstName,
+		LastName:  m.LastName,
+		Role:      string(m.Role),
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// CreateOrganization inserts an organization and makes ownerID its owner
+func (s *service) CreateOrganization(ctx context.Context, org *Organization, ownerID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := `
+		INSERT INTO organizations (name, max_active_sessions)
+		VALUES ($1, $2)
+		RETURNING id, created_at, updated_at
+	`
+	if err := tx.QueryRowContext(ctx, q, org.Name, org.MaxActiveSessions).Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return err
+	}
+
+	q = `
+		INSERT INTO organization_members (org_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`
+	if _, err := tx.ExecContext(ctx, q, org.ID, ownerID, string(OrgRoleOwner)); err != nil {
+		return err
+	}
+	org.Role = OrgRoleOwner
+
+	return tx.Commit()
+}
+
+// GetOrganizationForUser loads an organization with the user's role, or
+// ErrOrganizationNotFound if the user isn't a member
+func (s *service) GetOrganizationForUser(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*Organization, error) {
+	q := `
+		SELECT o.id, o.name, o.max_active_sessions, o.created_at, o.updated_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id
+		WHERE o.id = $1 AND m.user_id = $2
+	`
+	org := &Organization{}
+	var role string
+	err := s.db.QueryRowContext(ctx, q, orgID, userID).Scan(
+		&org.ID, &org.Name, &org.MaxActiveSessions, &org.CreatedAt, &org.UpdatedAt, &role,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	org.Role = OrgRole(role)
+	return org, nil
+}
+
+// GetOrganizationsByUserID lists the organizations a user belongs to
+func (s *service) GetOrganizationsByUserID(ctx context.Context, userID uuid.UUID) ([]*Organization, error) {
+	q := `
+		SELECT o.id, o.name, o.max_active_sessions, o.created_at, o.updated_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name
+	`
+	rows, err := s.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []*Organization
+	for rows.Next() {
+		org := &Organization{}
+		var role string
+		if err := rows.Scan(&org.ID, &org.Name, &org.MaxActiveSessions, &org.CreatedAt, &org.UpdatedAt, &role); err != nil {
+			return nil, err
+		}
+		org.Role = OrgRole(role)
+		orgs = append(orgs, org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// UpdateOrganization updates an organization's name and session quota
+func (s *service) UpdateOrganization(ctx context.Context, org *Organization) error {
+	q := `
+		UPDATE organizations
+		SET name = $2, max_active_sessions = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING created_at, updated_at
+	`
+	err := s.db.QueryRowContext(ctx, q, org.ID, org.Name, org.MaxActiveSessions).Scan(&org.CreatedAt, &org.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOrganizationNotFound
+	}
+	return err
+}
+
+// GetOrganizationMembers lists the members of an organization
+func (s *service) GetOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]*OrganizationMember, error) {
+	q := `
+		SELECT m.org_id, m.user_id, u.email, u.first_name, u.last_name, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.created_at
+	`
+	rows, err := s.db.QueryContext(ctx, q, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*OrganizationMember
+	for rows.Next() {
+		m := &OrganizationMember{}
+		var role string
+		if err := rows.Scan(&m.OrgID, &m.UserID, &m.Email, &m.FirstName, &m.LastName, &role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.Role = OrgRole(role)
+		members = append(members, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// AddOrganizationMember adds a user to an organization. It returns
+// ErrMemberExists if the user is already a member, whose role it leaves alone.
+func (s *service) AddOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role OrgRole) error {
+	q := `
+		INSERT INTO organization_members (org_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`
+	result, err := s.db.ExecContext(ctx, q, orgID, userID, string(role))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMemberExists
+	}
+
+	return nil
+}
+
+// UpdateOrganizationMemberRole changes a member's role. It returns
+// ErrLastOwner rather than demote the organization's only owner.
+func (s *service) UpdateOrganizationMemberRole(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role OrgRole) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the organization so concurrent demotions can't both see another
+	// owner left
+	var locked uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT id FROM organizations WHERE id = $1 FOR UPDATE`, orgID).Scan(&locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrganizationNotFound
+		}
+		return err
+	}
+
+	var current string
+	q := `SELECT role FROM organization_members WHERE org_id = $1 AND user_id = $2`
+	if err := tx.QueryRowContext(ctx, q, orgID, userID).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+
+	if OrgRole(current) == OrgRoleOwner && role != OrgRoleOwner {
+		var owners int
+		q = `SELECT COUNT(*) FROM organization_members WHERE org_id = $1 AND role = $2`
+		if err := tx.QueryRowContext(ctx, q, orgID, string(OrgRoleOwner)).Scan(&owners); err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	q = `UPDATE organization_members SET role = $3 WHERE org_id = $1 AND user_id = $2`
+	if _, err := tx.ExecContext(ctx, q, orgID, userID, string(role)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveOrganizationMember removes a user from an organization
+func (s *service) RemoveOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error {
+	q := `
+		DELETE FROM organization_members
+		WHERE org_id = $1 AND user_id = $2
+	`
+	result, err := s.db.ExecContext(ctx, q, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// GetSessionsByOrgID retrieves all sessions owned by an organization
+func (s *service) GetSessionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*Session, error) {
+	q := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE org_id = $1 AND deleted_at IS NULL
+		ORDER BY started_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// checkOrgSessionQuota locks the organization's row for the rest of tx and
+// returns ErrOrgQuotaReached if it can't take another active session
+func checkOrgSessionQuota(ctx context.Context, tx *sql.Tx, orgID uuid.UUID) error {
+	var quota sql.NullInt64
+	err := tx.QueryRowContext(ctx, `SELECT max_active_sessions FROM organizations WHERE id = $1 FOR UPDATE`, orgID).Scan(&quota)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrganizationNotFound
+		}
+		return err
+	}
+	if !quota.Valid {
+		return nil
+	}
+
+	q := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE org_id = $1 AND stopped_at IS NULL AND deleted_at IS NULL
+	`
+	var active int64
+	if err := tx.QueryRowContext(ctx, q, orgID).Scan(&active); err != nil {
+		return err
+	}
+	if active >= quota.Int64 {
+		return ErrOrgQuotaReached
+	}
+	return nil
+}
+
+// CountActiveOrgSessions counts an organization's sessions that haven't been stopped
+func (s *service) CountActiveOrgSessions(ctx context.Context, orgID uuid.UUID) (int, error) {
+	q := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE org_id = $1 AND stopped_at IS NULL AND deleted_at IS NULL
+	`
+	var count int
+	err := s.db.QueryRowContext(ctx, q, orgID).Scan(&count)
+	return count, err
+}
+
+// Organization audit actions
+const (
+	AuditOrgCreated        = "org.created"
+	AuditOrgUpdated        = "org.updated"
+	AuditMemberAdded       = "member.added"
+	AuditMemberRoleChanged = "member.role_changed"
+	AuditMemberRemoved     = "member.removed"
+	AuditOrgSessionCreated = "session.created"
+	AuditOrgSessionStopped = "session.stopped"
+)
+
+// OrgAuditEvent holds a row from organization_audit_events
+type OrgAuditEvent struct {
+	ID           uuid.UUID
+	OrgID        uuid.UUID
+	ActorID      uuid.UUID
+	Action       string
+	TargetUserID uuid.NullUUID
+	SessionID    uuid.NullUUID
+	Detail       string
+	CreatedAt    time.Time
+}
+
+// OrgAuditEventView is the public representation of an OrgAuditEvent
+type OrgAuditEventView struct {
+	ID           string    `json:"id"`
+	ActorID      string    `json:"actor_id"`
+	Action       string    `json:"action"`
+	TargetUserID *string   `json:"target_user_id,omitempty"`
+	SessionID    *string   `json:"session_id,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToView converts an OrgAuditEvent to an OrgAuditEventView
+func (e *OrgAuditEvent) ToView() *OrgAuditEventView {
+	view := &OrgAuditEventView{
+		ID:        e.ID.String(),
+		ActorID:   e.ActorID.String(),
+		Action:    e.Action,
+		Detail:    e.Detail,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.TargetUserID.Valid {
+		id := e.TargetUserID.UUID.String()
+		view.TargetUserID = &id
+	}
+	if e.SessionID.Valid {
+		id := e.SessionID.UUID.String()
+		view.SessionID = &id
+	}
+	return view
+}
+
+// RecordOrgAuditEvent appends an event to an organization's audit log
+func (s *service) RecordOrgAuditEvent(ctx context.Context, e *OrgAuditEvent) error {
+	q := `
+		INSERT INTO organization_audit_events (org_id, actor_id, action, target_user_id, session_id, detail)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	return s.db.QueryRowContext(ctx, q,
+		e.OrgID, e.ActorID, e.Action, e.TargetUserID, e.SessionID, nullString(e.Detail),
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// GetOrgAuditEvents lists the latest limit events of an organization's audit
+// log, newest first
+func (s *service) GetOrgAuditEvents(ctx context.Context, orgID uuid.UUID, limit int) ([]*OrgAuditEvent, error) {
+	q := `
+		SELECT id, org_id, actor_id, action, target_user_id, session_id, detail, created_at
+		FROM organization_audit_events
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, q, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*OrgAuditEvent
+	for rows.Next() {
+		e := &OrgAuditEvent{}
+		var detail sql.NullString
+		if err := rows.Scan(&e.ID, &e.OrgID, &e.ActorID, &e.Action, &e.TargetUserID, &e.SessionID, &detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Detail = detail.String
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -5,11 +5,28 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrSessionNotFound is returned when no session is visible to the caller.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session launch states
+const (
+	// SessionPending sessions are waiting for their browser to launch
+	SessionPending = "pending"
+	// SessionRunning sessions have a browser; they may since have stopped
+	SessionRunning = "running"
+	// SessionFailed sessions never got a browser
+	SessionFailed = "failed"
+	// SessionStopped is reported in views for sessions that have stopped,
+	// including pending sessions stopped before their browser launched
+	SessionStopped = "stopped"
+)
+
 // Session represents a user session
 type Session struct {
 	ID        uuid.UUID
@@ -25,6 +42,83 @@ type Session struct {
 	ViewportW   int
 	ViewportH   int
 	UserAgent   sql.NullString
+	// Upstream proxy, nil when the session connects directly
+	Proxy *SessionProxy
+	// Locale, timezone, geolocation and color-scheme overrides
+	Emulation SessionEmulation
+	// Name of the device preset, empty when none was selected
+	Device string
+	// Organization owning the session; members share control of it
+	OrgID uuid.NullUUID
+	// When the browser server will expire the session, if known
+	ExpiresAt sql.NullTime
+	// Browser server node hosting the session, empty for the default node
+	BrowserNode string
+	// Launch state, one of SessionPending, SessionRunning or SessionFailed
+	State string
+	// Why the launch failed, for failed sessions
+	Error sql.NullString
+	// API server instance owning the session, empty once handed off
+	InstanceID string
+}
+
+// SessionProxy holds the upstream proxy a session was launched with.
+// PasswordEncrypted is ciphertext from the secrets package and is never
+// decrypted by the database layer.
+type SessionProxy struct {
+	Server            string
+	Bypass            string
+	Username          string
+	PasswordEncrypted string
+}
+
+// SessionEmulation holds the emulation overrides applied to a session.
+// Empty strings and a nil Geolocation mean no override.
+type SessionEmulation struct {
+	Locale      string
+	Timezone    string
+	Geolocation *SessionGeolocation
+	ColorScheme string
+}
+
+// SessionGeolocation is an emulated position
+type SessionGeolocation struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64
+}
+
+// IsZero reports whether no override is set
+func (e SessionEmulation) IsZero() bool {
+	return e.Locale == "" && e.Timezone == "" && e.Geolocation == nil && e.ColorScheme == ""
+}
+
+// SessionOptions holds optional launch settings recorded alongside a session
+type SessionOptions struct {
+	Proxy     *SessionProxy
+	Emulation SessionEmulation
+	Device    string
+	OrgID       uuid.NullUUID
+	ExpiresAt   sql.NullTime
+	BrowserNode string
+	// State defaults to SessionRunning
+	State string
+	// InstanceID is the API server instance creating the session
+	InstanceID string
+}
+
+// SessionLaunch holds the browser details recorded when a pending session's
+// browser has launched
+type SessionLaunch struct {
+	BrowserID   string
+	BrowserType string
+	CdpURL      string
+	Headless    bool
+	ViewportW   int
+	ViewportH   int
+	UserAgent   *string
+	ExpiresAt   sql.NullTime
+	BrowserNode string
 }
 
 // SessionView is the public representation of a Session
@@ -35,50 +129,71 @@ type SessionView struct {
 	StartedAt time.Time `json:"started_at"`
 	StoppedAt *time.Time `json:"stopped_at"`
 	Active    bool      `json:"active"`
+	// State is pending, running, stopped or failed
+	State     string    `json:"state"`
+	Error     *string   `json:"error,omitempty"`
 	Duration  *string   `json:"duration"`
 	// Browser details
-	BrowserID   string  `json:"browser_id"`
-	BrowserType string  `json:"browser_type"`
-	CdpURL      string  `json:"cdp_url"`
-	Headless    bool    `json:"headless"`
-	ViewportW   int     `json:"viewport_width"`
-	ViewportH   int     `json:"viewport_height"`
-	UserAgent   *string `json:"user_agent,omitempty"`
+	BrowserID   string     `json:"browser_id"`
+	BrowserType string     `json:"browser_type"`
+	CdpURL      string     `json:"cdp_url"`
+	Headless    bool       `json:"headless"`
+	ViewportW   int        `json:"viewport_width"`
+	ViewportH   int        `json:"viewport_height"`
+	UserAgent   *string        `json:"user_agent,omitempty"`
+	Proxy       *ProxyView     `json:"proxy,omitempty"`
+	Emulation   *EmulationView `json:"emulation,omitempty"`
+	Device      string         `json:"device,omitempty"`
+	OrgID       *string        `json:"org_id,omitempty"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
 }
 
-// CreateSession inserts a new session
-func (s *service) CreateSession(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string) (*Session, error) {
-	q := `
-		INSERT INTO sessions (
-			user_id, name, browser_id, browser_type, cdp_url, 
-			headless, viewport_w, viewport_h, user_agent
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, user_id, name, started_at, stopped_at, browser_id, 
-		browser_type, cdp_url, headless, viewport_w, viewport_h, user_agent
-	`
-	session := &Session{
-		UserID:      userID,
-		Name:        name,
-		BrowserID:   browserID,
-		BrowserType: browserType,
-		CdpURL:      cdpURL,
-		Headless:    headless,
-		ViewportW:   viewportW,
-		ViewportH:   viewportH,
-	}
-	
-	// Set user agent if provided
-	if userAgent != nil {
-		session.UserAgent = sql.NullString{String: *userAgent, Valid: true}
-	}
+// ProxyView is the public representation of a SessionProxy. It never
+// includes the password.
+type ProxyView struct {
+	Server   string `json:"server"`
+	Bypass   string `json:"bypass,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// EmulationView is the public representation of a SessionEmulation
+type EmulationView struct {
+	Locale      string           `json:"locale,omitempty"`
+	Timezone    string           `json:"timezone,omitempty"`
+	Geolocation *GeolocationView `json:"geolocation,omitempty"`
+	ColorScheme string           `json:"color_scheme,omitempty"`
+}
+
+// GeolocationView is the public representation of a SessionGeolocation
+type GeolocationView struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy,omitempty"`
+}
+
+// sessionColumns lists the columns read by scanSession, in order
+const sessionColumns = `id, user_id, name, started_at, stopped_at,
+		browser_id, browser_type, cdp_url, headless,
+		viewport_w, viewport_h, user_agent,
+		proxy_server, proxy_bypass, proxy_username, proxy_password,
+		locale, timezone, latitude, longitude, geo_accuracy, color_scheme,
+		device, org_id, expires_at, browser_node,
+		state, error_message, instance_id`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	row := s.db.QueryRowContext(ctx, q, 
-		userID, name, browserID, browserType, cdpURL, 
-		headless, viewportW, viewportH, 
-		sql.NullString{String: session.UserAgent.String, Valid: session.UserAgent.Valid},
-	)
-	err := row.Scan(
+// scanSession reads a row selected with sessionColumns into a Session. Any
+// extra destinations are scanned from the columns that follow sessionColumns.
+func scanSession(row rowScanner, extra ...any) (*Session, error) {
+	session := &Session{}
+	var proxyServer, proxyBypass, proxyUsername, proxyPassword sql.NullString
+	var locale, timezone, colorScheme sql.NullString
+	var latitude, longitude, geoAccuracy sql.NullFloat64
+	var device, browserNode, instanceID sql.NullString
+	dest := []any{
 		&session.ID,
 		&session.UserID,
 		&session.Name,
@@ -91,91 +206,263 @@ func (s *service) CreateSession(ctx context.Context, userID uuid.UUID, name stri
 		&session.ViewportW,
 		&session.ViewportH,
 		&session.UserAgent,
-	)
+		&proxyServer,
+		&proxyBypass,
+		&proxyUsername,
+		&proxyPassword,
+		&locale,
+		&timezone,
+		&latitude,
+		&longitude,
+		&geoAccuracy,
+		&colorScheme,
+		&device,
+		&session.OrgID,
+		&session.ExpiresAt,
+		&browserNode,
+		&session.State,
+		&session.Error,
+		&instanceID,
+	}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
+	session.Device = device.String
+	session.BrowserNode = browserNode.String
+	session.InstanceID = instanceID.String
+
+	if proxyServer.Valid {
+		session.Proxy = &SessionProxy{
+			Server:            proxyServer.String,
+			Bypass:            proxyBypass.String,
+			Username:          proxyUsername.String,
+			PasswordEncrypted: proxyPassword.String,
+		}
+	}
+
+	session.Emulation = SessionEmulation{
+		Locale:      locale.String,
+		Timezone:    timezone.String,
+		ColorScheme: colorScheme.String,
+	}
+	if latitude.Valid && longitude.Valid {
+		session.Emulation.Geolocation = &SessionGeolocation{
+			Latitude:  latitude.Float64,
+			Longitude: longitude.Float64,
+			Accuracy:  geoAccuracy.Float64,
+		}
+	}
 
 	return session, nil
 }
 
+// emulationArgs converts a SessionEmulation to column values in the order
+// locale, timezone, latitude, longitude, geo_accuracy, color_scheme
+func emulationArgs(e SessionEmulation) []any {
+	var latitude, longitude, accuracy sql.NullFloat64
+	if e.Geolocation != nil {
+		latitude = sql.NullFloat64{Float64: e.Geolocation.Latitude, Valid: true}
+		longitude = sql.NullFloat64{Float64: e.Geolocation.Longitude, Valid: true}
+		accuracy = sql.NullFloat64{Float64: e.Geolocation.Accuracy, Valid: true}
+	}
+	return []any{
+		nullString(e.Locale),
+		nullString(e.Timezone),
+		latitude,
+		longitude,
+		accuracy,
+		nullString(e.ColorScheme),
+	}
+}
+
+// nullString converts an empty string to a NULL column value
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// CreateSession inserts a new session
+func (s *service) CreateSession(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string) (*Session, error) {
+	return s.CreateSessionWithOptions(ctx, userID, name, browserID, browserType, cdpURL, headless, viewportW, viewportH, userAgent, SessionOptions{})
+}
+
+// CreateSessionWithOptions inserts a new session along with its optional launch settings
+func (s *service) CreateSessionWithOptions(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string, opts SessionOptions) (*Session, error) {
+	q := `
+		INSERT INTO sessions (
+			user_id, name, browser_id, browser_type, cdp_url, 
+			headless, viewport_w, viewport_h, user_agent,
+			proxy_server, proxy_bypass, proxy_username, proxy_password,
+			locale, timezone, latitude, longitude, geo_accuracy, color_scheme,
+			device, org_id, expires_at, browser_node, state, instance_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+			$14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)
+		RETURNING ` + sessionColumns
+
+	// Set user agent if provided
+	var ua sql.NullString
+	if userAgent != nil {
+		ua = sql.NullString{String: *userAgent, Valid: true}
+	}
+
+	var proxyServer, proxyBypass, proxyUsername, proxyPassword sql.NullString
+	if opts.Proxy != nil {
+		proxyServer = nullString(opts.Proxy.Server)
+		proxyBypass = nullString(opts.Proxy.Bypass)
+		proxyUsername = nullString(opts.Proxy.Username)
+		proxyPassword = nullString(opts.Proxy.PasswordEncrypted)
+	}
+
+	args := []any{
+		userID, name, browserID, browserType, cdpURL,
+		headless, viewportW, viewportH, ua,
+		proxyServer, proxyBypass, proxyUsername, proxyPassword,
+	}
+	args = append(args, emulationArgs(opts.Emulation)...)
+	args = append(args, nullString(opts.Device), opts.OrgID, opts.ExpiresAt, nullString(opts.BrowserNode))
+
+	state := opts.State
+	if state == "" {
+		state = SessionRunning
+	}
+	args = append(args, state, nullString(opts.InstanceID))
+
+	if !opts.OrgID.Valid {
+		return scanSession(s.db.QueryRowContext(ctx, q, args...))
+	}
+
+	// The organization's quota is checked and the session recorded in one
+	// transaction, holding the organization's row so concurrent creates take
+	// turns
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkOrgSessionQuota(ctx, tx, opts.OrgID.UUID); err != nil {
+		return nil, err
+	}
+	session, err := scanSession(tx.QueryRowContext(ctx, q, args...))
+	if err != nil {
+		return nil, err
+	}
+	return session, tx.Commit()
+}
+
+// SessionStatus filters sessions by whether they are still running
+type SessionStatus string
+
+const (
+	SessionStatusAny     SessionStatus = ""
+	SessionStatusActive  SessionStatus = "active"
+	SessionStatusStopped SessionStatus = "stopped"
+)
+
+// SessionFilter selects a user's sessions. Zero-valued fields don't filter.
+type SessionFilter struct {
+	UserID        uuid.UUID
+	Status        SessionStatus
+	BrowserType   string
+	StartedAfter  time.Time
+	StartedBefore time.Time
+}
+
+// where builds the WHERE clause and arguments for the filter
+func (f SessionFilter) where() (string, []any) {
+	conds := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []any{f.UserID}
+
+	switch f.Status {
+	case SessionStatusActive:
+		conds = append(conds, "stopped_at IS NULL")
+	case SessionStatusStopped:
+		conds = append(conds, "stopped_at IS NOT NULL")
+	}
+	if f.BrowserType != "" {
+		args = append(args, f.BrowserType)
+		conds = append(conds, fmt.Sprintf("browser_type = $%d", len(args)))
+	}
+	if !f.StartedAfter.IsZero() {
+		args = append(args, f.StartedAfter)
+		conds = append(conds, fmt.Sprintf("started_at >= $%d", len(args)))
+	}
+	if !f.StartedBefore.IsZero() {
+		args = append(args, f.StartedBefore)
+		conds = append(conds, fmt.Sprintf("started_at < $%d", len(args)))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
 // GetSessionsByUserID retrieves all sessions for a specific user
 func (s *service) GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	return s.ListSessions(ctx, SessionFilter{UserID: userID})
+}
+
+// ListSessions retrieves the sessions matching the filter, newest first
+func (s *service) ListSessions(ctx context.Context, filter SessionFilter) ([]*Session, error) {
+	var sessions []*Session
+	err := s.StreamSessions(ctx, filter, func(session *Session) error {
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// StreamSessions calls fn for each session matching the filter, newest first,
+// without holding the whole result in memory. It stops at the first error fn
+// returns.
+func (s *service) StreamSessions(ctx context.Context, filter SessionFilter, fn func(*Session) error) error {
+	where, args := filter.where()
 	q := `
-		SELECT id, user_id, name, started_at, stopped_at, 
-		       browser_id, browser_type, cdp_url, headless, 
-		       viewport_w, viewport_h, user_agent
+		SELECT ` + sessionColumns + `
 		FROM sessions
-		WHERE user_id = $1
+		WHERE ` + where + `
 		ORDER BY started_at DESC
 	`
 
-	rows, err := s.db.QueryContext(ctx, q, userID)
+	rows, err := s.db.QueryContext(ctx, q, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var sessions []*Session
 	for rows.Next() {
-		session := &Session{}
-		err := rows.Scan(
-			&session.ID,
-			&session.UserID,
-			&session.Name,
-			&session.StartedAt,
-			&session.StoppedAt,
-			&session.BrowserID,
-			&session.BrowserType,
-			&session.CdpURL,
-			&session.Headless,
-			&session.ViewportW,
-			&session.ViewportH,
-			&session.UserAgent,
-		)
+		session, err := scanSession(rows)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(session); err != nil {
+			return err
 		}
-		sessions = append(sessions, session)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return sessions, nil
+	return rows.Err()
 }
 
-// GetSessionByID retrieves a specific session
+// GetSessionByID retrieves a session the user owns or has an active share for
 func (s *service) GetSessionByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, error) {
-	q := `
-		SELECT id, user_id, name, started_at, stopped_at, 
-		       browser_id, browser_type, cdp_url, headless, 
-		       viewport_w, viewport_h, user_agent
-		FROM sessions
-		WHERE id = $1 AND user_id = $2
-	`
+	session, _, err := s.GetSessionAccess(ctx, id, userID)
+	return session, err
+}
 
-	session := &Session{}
-	row := s.db.QueryRowContext(ctx, q, id, userID)
-	err := row.Scan(
-		&session.ID,
-		&session.UserID,
-		&session.Name,
-		&session.StartedAt,
-		&session.StoppedAt,
-		&session.BrowserID,
-		&session.BrowserType,
-		&session.CdpURL,
-		&session.Headless,
-		&session.ViewportW,
-		&session.ViewportH,
-		&session.UserAgent,
-	)
+// StopSession updates a session by setting its stopped_at time
+func (s *service) StopSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, error) {
+	q := `
+		UPDATE sessions
+		SET stopped_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND stopped_at IS NULL AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
 
+	session, err := scanSession(s.db.QueryRowContext(ctx, q, id, userID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("session not found")
+			return nil, errors.New("session not found or already stopped")
 		}
 		return nil, err
 	}
@@ -183,34 +470,17 @@ func (s *service) GetSessionByID(ctx context.Context, id uuid.UUID, userID uuid.
 	return session, nil
 }
 
-// StopSession updates a session by setting its stopped_at time
-func (s *service) StopSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, error) {
+// UpdateSessionEmulation replaces the emulation overrides of an active session
+func (s *service) UpdateSessionEmulation(ctx context.Context, id uuid.UUID, userID uuid.UUID, emulation SessionEmulation) (*Session, error) {
 	q := `
 		UPDATE sessions
-		SET stopped_at = NOW()
-		WHERE id = $1 AND user_id = $2 AND stopped_at IS NULL
-		RETURNING id, user_id, name, started_at, stopped_at, 
-		          browser_id, browser_type, cdp_url, headless, 
-		          viewport_w, viewport_h, user_agent
-	`
-
-	session := &Session{}
-	row := s.db.QueryRowContext(ctx, q, id, userID)
-	err := row.Scan(
-		&session.ID,
-		&session.UserID,
-		&session.Name,
-		&session.StartedAt,
-		&session.StoppedAt,
-		&session.BrowserID,
-		&session.BrowserType,
-		&session.CdpURL,
-		&session.Headless,
-		&session.ViewportW,
-		&session.ViewportH,
-		&session.UserAgent,
-	)
+		SET locale = $3, timezone = $4, latitude = $5,
+		    longitude = $6, geo_accuracy = $7, color_scheme = $8
+		WHERE id = $1 AND user_id = $2 AND stopped_at IS NULL AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
 
+	args := append([]any{id, userID}, emulationArgs(emulation)...)
+	session, err := scanSession(s.db.QueryRowContext(ctx, q, args...))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.New("session not found or already stopped")
@@ -221,11 +491,14 @@ func (s *service) StopSession(ctx context.Context, id uuid.UUID, userID uuid.UUI
 	return session, nil
 }
 
-// DeleteSession permanently removes a session
+// DeleteSession archives a session. Archived sessions are hidden from every
+// query except PurgeArchivedSessions, which removes them for good once the
+// retention window has passed. Active sessions are stopped as they are archived.
 func (s *service) DeleteSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
 	q := `
-		DELETE FROM sessions
-		WHERE id = $1 AND user_id = $2
+		UPDATE sessions
+		SET deleted_at = NOW(), stopped_at = COALESCE(stopped_at, NOW())
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
 	`
 
 	result, err := s.db.ExecContext(ctx, q, id, userID)
@@ -245,6 +518,136 @@ func (s *service) DeleteSession(ctx context.Context, id uuid.UUID, userID uuid.U
 	return nil
 }
 
+// PurgeArchivedSessions permanently removes sessions archived before the
+// cutoff, along with their shares. It returns the number of sessions removed.
+func (s *service) PurgeArchivedSessions(ctx context.Context, archivedBefore time.Time) (int64, error) {
+	q := `
+		DELETE FROM sessions
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+	`
+
+	result, err := s.db.ExecContext(ctx, q, archivedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ExpireSessions stops the active sessions whose expiry time has passed,
+// recording the expiry time as the stop time, and returns them
+func (s *service) ExpireSessions(ctx context.Context) ([]*Session, error) {
+	q := `
+		UPDATE sessions
+		SET stopped_at = expires_at
+		WHERE stopped_at IS NULL AND deleted_at IS NULL AND expires_at <= NOW()
+		RETURNING ` + sessionColumns
+
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// CompletePendingSession records the launched browser of a pending session
+// and marks it running. It returns ErrSessionNotFound if the session is no
+// longer pending, e.g. because it was stopped while launching.
+func (s *service) CompletePendingSession(ctx context.Context, id uuid.UUID, launch SessionLaunch) (*Session, error) {
+	q := `
+		UPDATE sessions
+		SET state = 'running', browser_id = $2, browser_type = $3, cdp_url = $4,
+		    headless = $5, viewport_w = $6, viewport_h = $7, user_agent = $8,
+		    expires_at = $9, browser_node = $10
+		WHERE id = $1 AND state = 'pending' AND stopped_at IS NULL AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
+
+	var ua sql.NullString
+	if launch.UserAgent != nil {
+		ua = sql.NullString{String: *launch.UserAgent, Valid: true}
+	}
+
+	session, err := scanSession(s.db.QueryRowContext(ctx, q, id,
+		launch.BrowserID, launch.BrowserType, launch.CdpURL,
+		launch.Headless, launch.ViewportW, launch.ViewportH, ua,
+		launch.ExpiresAt, nullString(launch.BrowserNode)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// FailPendingSession marks a pending session failed and stopped. It returns
+// ErrSessionNotFound if the session is no longer pending.
+func (s *service) FailPendingSession(ctx context.Context, id uuid.UUID, reason string) (*Session, error) {
+	q := `
+		UPDATE sessions
+		SET state = 'failed', error_message = $2, stopped_at = NOW()
+		WHERE id = $1 AND state = 'pending' AND stopped_at IS NULL AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
+
+	session, err := scanSession(s.db.QueryRowContext(ctx, q, id, reason))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// FailStalePendingSessions fails the sessions that have been pending since
+// before startedBefore, e.g. because the instance launching them exited, and
+// returns them
+func (s *service) FailStalePendingSessions(ctx context.Context, startedBefore time.Time, reason string) ([]*Session, error) {
+	q := `
+		UPDATE sessions
+		SET state = 'failed', error_message = $2, stopped_at = NOW()
+		WHERE state = 'pending' AND started_at < $1 AND stopped_at IS NULL AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
+
+	rows, err := s.db.QueryContext(ctx, q, startedBefore, reason)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
 // ToView converts a Session to a SessionView
 func (s *Session) ToView() *SessionView {
 	view := &SessionView{
@@ -253,12 +656,14 @@ func (s *Session) ToView() *SessionView {
 		Name:        s.Name,
 		StartedAt:   s.StartedAt,
 		Active:      !s.StoppedAt.Valid,
+		State:       s.State,
 		BrowserID:   s.BrowserID,
 		BrowserType: s.BrowserType,
 		CdpURL:      s.CdpURL,
 		Headless:    s.Headless,
 		ViewportW:   s.ViewportW,
 		ViewportH:   s.ViewportH,
+		Device:      s.Device,
 	}
 
 	if s.StoppedAt.Valid {
@@ -271,12 +676,54 @@ func (s *Session) ToView() *SessionView {
 		view.Duration = &durationStr
 	}
 	
+	if s.StoppedAt.Valid && s.State != SessionFailed {
+		view.State = SessionStopped
+	}
+	if s.Error.Valid {
+		errMsg := s.Error.String
+		view.Error = &errMsg
+	}
+
 	// Set user agent if valid
 	if s.UserAgent.Valid {
 		userAgent := s.UserAgent.String
 		view.UserAgent = &userAgent
 	}
 
+	if s.OrgID.Valid {
+		orgID := s.OrgID.UUID.String()
+		view.OrgID = &orgID
+	}
+
+	if s.ExpiresAt.Valid && view.Active {
+		expiresAt := s.ExpiresAt.Time
+		view.ExpiresAt = &expiresAt
+	}
+
+	if !s.Emulation.IsZero() {
+		view.Emulation = &EmulationView{
+			Locale:      s.Emulation.Locale,
+			Timezone:    s.Emulation.Timezone,
+			ColorScheme: s.Emulation.ColorScheme,
+		}
+		if g := s.Emulation.Geolocation; g != nil {
+			view.Emulation.Geolocation = &GeolocationView{
+				Latitude:  g.Latitude,
+				Longitude: g.Longitude,
+				Accuracy:  g.Accuracy,
+			}
+		}
+	}
+
+	// Expose proxy settings without the password
+	if s.Proxy != nil {
+		view.Proxy = &ProxyView{
+			Server:   s.Proxy.Server,
+			Bypass:   s.Proxy.Bypass,
+			Username: s.Proxy.Username,
+		}
+	}
+
 	return view
 }
 
@@ -304,4 +751,114 @@ func formatTimePart(value time.Duration, unit string) string {
 		return "1 " + unit
 	}
 	return fmt.Sprintf("%d %s", value, unit+"s")
-}
\ No newline at end of file
+}
+
+// CountActiveSessionsByBrowserType counts the sessions that haven't been
+// stopped or deleted, including pending ones, per browser type
+func (s *service) CountActiveSessionsByBrowserType(ctx context.Context) (map[string]int, error) {
+	q := `
+		SELECT browser_type, COUNT(*)
+		FROM sessions
+		WHERE stopped_at IS NULL AND deleted_at IS NULL
+		GROUP BY browser_type
+	`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var browserType string
+		var count int
+		if err := rows.Scan(&browserType, &count); err != nil {
+			return nil, err
+		}
+		counts[browserType] = count
+	}
+	return counts, rows.Err()
+}
+
+// ListInstanceSessions returns the active sessions, including pending ones,
+// owned by an API server instance
+func (s *service) ListInstanceSessions(ctx context.Context, instanceID string) ([]*Session, error) {
+	q := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE instance_id = $1 AND stopped_at IS NULL AND deleted_at IS NULL
+		ORDER BY started_at
+	`
+	rows, err := s.db.QueryContext(ctx, q, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ListActiveSessions returns every session that hasn't stopped, pending ones
+// included, oldest first
+func (s *service) ListActiveSessions(ctx context.Context) ([]*Session, error) {
+	q := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE stopped_at IS NULL AND deleted_at IS NULL
+		ORDER BY started_at
+	`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// ReleaseInstanceSessions hands off the active sessions of an instance,
+// leaving them without an owner until AdoptOrphanedSessions. It returns how
+// many were released.
+func (s *service) ReleaseInstanceSessions(ctx context.Context, instanceID string) (int64, error) {
+	q := `
+		UPDATE sessions
+		SET instance_id = NULL
+		WHERE instance_id = $1 AND stopped_at IS NULL AND deleted_at IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, q, instanceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// AdoptOrphanedSessions makes an instance the owner of every active session
+// without one. It returns how many were adopted.
+func (s *service) AdoptOrphanedSessions(ctx context.Context, instanceID string) (int64, error) {
+	q := `
+		UPDATE sessions
+		SET instance_id = $1
+		WHERE instance_id IS NULL AND stopped_at IS NULL AND deleted_at IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, q, instanceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
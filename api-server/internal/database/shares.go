@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrShareNotFound is returned when no active share matches.
+var ErrShareNotFound = errors.New("share not found or already revoked")
+
+// AccessLevel describes what a user may do with a session
+type AccessLevel string
+
+const (
+	// AccessNone grants nothing
+	AccessNone AccessLevel = ""
+	// AccessView allows reading the session but not its CDP URL
+	AccessView AccessLevel = "view"
+	// AccessControl allows driving and stopping the session
+	AccessControl AccessLevel = "control"
+	// AccessOwner allows everything, including deleting and sharing
+	AccessOwner AccessLevel = "owner"
+)
+
+var accessRank = map[AccessLevel]int{
+	AccessNone:    0,
+	AccessView:    1,
+	AccessControl: 2,
+	AccessOwner:   3,
+}
+
+// Allows reports whether a holds at least the required level
+func (a AccessLevel) Allows(required AccessLevel) bool {
+	return accessRank[a] >= accessRank[required]
+}
+
+// SessionShare holds a row from session_shares
+type SessionShare struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+	UserEmail string
+	Access    AccessLevel
+	CreatedBy uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+// SharedSession is a session together with the access a grantee holds on it
+type SharedSession struct {
+	Session *Session
+	Access  AccessLevel
+}
+
+// SessionShareView is the public representation of a SessionShare
+type SessionShareView struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"`
+	UserEmail string     `json:"user_email"`
+	Access    string     `json:"access"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ToView converts a SessionShare to a SessionShareView
+func (s *SessionShare) ToView() *SessionShareView {
+	view := &SessionShareView{
+		ID:        s.ID.String(),
+		SessionID: s.SessionID.String(),
+		UserID:    s.UserID.String(),
+		UserEmail: s.UserEmail,
+		Access:    string(s.Access),
+		CreatedAt: s.CreatedAt,
+	}
+	if s.ExpiresAt.Valid {
+		expiresAt := s.ExpiresAt.Time
+		view.ExpiresAt = &expiresAt
+	}
+	return view
+}
+
+// activeShareCondition matches unrevoked, unexpired grants in session_shares aliased as sh
+const activeShareCondition = `sh.revoked_at IS NULL AND (sh.expires_at IS NULL OR sh.expires_at > NOW())`
+
+// GetSessionAccess loads a session together with the caller's access level.
+// The owner gets AccessOwner, members of the owning organization get
+// AccessControl, and other users get the level of their active grant.
+func (s *service) GetSessionAccess(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Session, AccessLevel, error) {
+	q := `
+		SELECT ` + sessionColumns + `,
+		       CASE
+		           WHEN user_id = $2 THEN 'owner'
+		           WHEN org_id IS NOT NULL AND EXISTS (
+		               SELECT 1 FROM organization_members m
+		               WHERE m.org_id = sessions.org_id AND m.user_id = $2
+		           ) THEN 'control'
+		           ELSE (
+		               SELECT sh.access FROM session_shares sh
+		               WHERE sh.session_id = sessions.id AND sh.user_id = $2 AND ` + activeShareCondition + `
+		           )
+		       END AS access
+		FROM sessions
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	var access sql.NullString
+	session, err := scanSession(s.db.QueryRowContext(ctx, q, id, userID), &access)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, AccessNone, ErrSessionNotFound
+		}
+		return nil, AccessNone, err
+	}
+
+	// Don't reveal that the session exists to users without a grant
+	if !access.Valid {
+		return nil, AccessNone, ErrSessionNotFound
+	}
+
+	return session, AccessLevel(access.String), nil
+}
+
+// GetSessionsSharedWithUser retrieves sessions other users have shared with userID
+func (s *service) GetSessionsSharedWithUser(ctx context.Context, userID uuid.UUID) ([]*SharedSession, error) {
+	q := `
+		SELECT ` + sessionColumns + `, (
+		           SELECT sh.access FROM session_shares sh
+		           WHERE sh.session_id = sessions.id AND sh.user_id = $1 AND ` + activeShareCondition + `
+		       ) AS access
+		FROM sessions
+		WHERE user_id <> $1 AND deleted_at IS NULL AND EXISTS (
+		    SELECT 1 FROM session_shares sh
+		    WHERE sh.session_id = sessions.id AND sh.user_id = $1 AND ` + activeShareCondition + `
+		)
+		ORDER BY started_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shared []*SharedSession
+	for rows.Next() {
+		var access string
+		session, err := scanSession(rows, &access)
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, &SharedSession{Session: session, Access: AccessLevel(access)})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shared, nil
+}
+
+// CreateSessionShare grants share.UserID access to share.SessionID. An existing
+// active grant for the same user is replaced.
+func (s *service) CreateSessionShare(ctx context.Context, share *SessionShare) error {
+	q := `
+		INSERT INTO session_shares (session_id, user_id, access, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (session_id, user_id) WHERE revoked_at IS NULL
+		DO UPDATE SET access = EXCLUDED.access,
+		              created_by = EXCLUDED.created_by,
+		              created_at = NOW(),
+		              expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at, (SELECT email FROM users WHERE id = $2)
+	`
+	row := s.db.QueryRowContext(ctx, q,
+		share.SessionID, share.UserID, string(share.Access), share.CreatedBy, share.ExpiresAt,
+	)
+	return row.Scan(&share.ID, &share.CreatedAt, &share.UserEmail)
+}
+
+// GetSessionShares lists the active grants on a session
+func (s *service) GetSessionShares(ctx context.Context, sessionID uuid.UUID) ([]*SessionShare, error) {
+	q := `
+		SELECT sh.id, sh.session_id, sh.user_id, u.email, sh.access,
+		       sh.created_by, sh.created_at, sh.expires_at, sh.revoked_at
+		FROM session_shares sh
+		JOIN users u ON u.id = sh.user_id
+		WHERE sh.session_id = $1 AND ` + activeShareCondition + `
+		ORDER BY sh.created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*SessionShare
+	for rows.Next() {
+		share := &SessionShare{}
+		var access string
+		if err := rows.Scan(
+			&share.ID, &share.SessionID, &share.UserID, &share.UserEmail, &access,
+			&share.CreatedBy, &share.CreatedAt, &share.ExpiresAt, &share.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		share.Access = AccessLevel(access)
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// RevokeSessionShare revokes an active grant on a session
+func (s *service) RevokeSessionShare(ctx context.Context, sessionID uuid.UUID, shareID uuid.UUID) error {
+	q := `
+		UPDATE session_shares
+		SET revoked_at = NOW()
+		WHERE id = $1 AND session_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, q, shareID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrShareNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageRecord holds a row from usage_daily joined with users
+type UsageRecord struct {
+	UserID         uuid.UUID
+	UserEmail      string
+	Day            time.Time
+	BrowserType    string
+	SessionCount   int
+	BrowserSeconds int64
+}
+
+// UsageView is the public representation of a UsageRecord
+type UsageView struct {
+	Day            string  `json:"day"`
+	UserID         string  `json:"user_id,omitempty"`
+	UserEmail      string  `json:"user_email,omitempty"`
+	BrowserType    string  `json:"browser_type"`
+	Sessions       int     `json:"sessions"`
+	BrowserMinutes float64 `json:"browser_minutes"`
+}
+
+// ToView converts a UsageRecord to a UsageView. The user is only included when
+// withUser is set, for reports that span several users.
+func (u *UsageRecord) ToView(withUser bool) *UsageView {
+	view := &UsageView{
+		Day:            u.Day.Format(time.DateOnly),
+		BrowserType:    u.BrowserType,
+		Sessions:       u.SessionCount,
+		BrowserMinutes: float64(u.BrowserSeconds) / 60,
+	}
+	if withUser {
+		view.UserID = u.UserID.String()
+		view.UserEmail = u.UserEmail
+	}
+	return view
+}
+
+// UsageFilter selects usage rows. From and To are inclusive days; an invalid
+// UserID selects every user.
+type UsageFilter struct {
+	UserID uuid.NullUUID
+	From   time.Time
+	To     time.Time
+}
+
+// RollupUsage recomputes the usage_daily rows for every UTC day between from
+// and to from the sessions table. A from inside a day covers the whole day. Active sessions count up to now, and
+// archived sessions are included so deleting a session doesn't erase its usage.
+// The days' rows are replaced, so a row whose only session has since failed is
+// removed. When from is no later than the previous rollup's end, to becomes
+// the new end returned by UsageRolledUpTo.
+func (s *service) RollupUsage(ctx context.Context, from, to time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := `
+		DELETE FROM usage_daily
+		WHERE day >= date_trunc('day', $1::timestamptz AT TIME ZONE 'UTC')
+		  AND day < $2::timestamptz AT TIME ZONE 'UTC'
+	`
+	if _, err := tx.ExecContext(ctx, q, from, to); err != nil {
+		return err
+	}
+
+	q = `
+		WITH spans AS (
+			SELECT user_id, browser_type,
+			       started_at AT TIME ZONE 'UTC' AS started,
+			       COALESCE(stopped_at, NOW()) AT TIME ZONE 'UTC' AS stopped
+			FROM sessions
+			WHERE started_at < $2::timestamptz
+			  AND COALESCE(stopped_at, NOW()) AT TIME ZONE 'UTC' >= date_trunc('day', $1::timestamptz AT TIME ZONE 'UTC')
+			  AND state <> 'failed'
+		), days AS (
+			SELECT sp.user_id, sp.browser_type, d.day,
+			       EXTRACT(EPOCH FROM LEAST(sp.stopped, d.day + INTERVAL '1 day') - GREATEST(sp.started, d.day)) AS seconds
+			FROM spans sp
+			CROSS JOIN LATERAL generate_series(
+			    date_trunc('day', sp.started), date_trunc('day', sp.stopped), INTERVAL '1 day'
+			) AS d(day)
+			WHERE d.day >= date_trunc('day', $1::timestamptz AT TIME ZONE 'UTC')
+			  AND d.day < $2::timestamptz AT TIME ZONE 'UTC'
+		)
+		INSERT INTO usage_daily (user_id, day, browser_type, session_count, browser_seconds, updated_at)
+		SELECT user_id, day::date, browser_type, COUNT(*), ROUND(SUM(seconds))::bigint, NOW()
+		FROM days
+		GROUP BY user_id, day, browser_type
+		ON CONFLICT (user_id, day, browser_type) DO UPDATE
+		SET session_count = EXCLUDED.session_count,
+		    browser_seconds = EXCLUDED.browser_seconds,
+		    updated_at = NOW()
+	`
+	if _, err := tx.ExecContext(ctx, q, from, to); err != nil {
+		return err
+	}
+
+	// A rollup starting after the previous end would leave a gap behind it
+	q = `
+		INSERT INTO usage_rollup_state (rolled_up_to) VALUES ($2)
+		ON CONFLICT (id) DO UPDATE
+		SET rolled_up_to = GREATEST(usage_rollup_state.rolled_up_to, EXCLUDED.rolled_up_to)
+		WHERE usage_rollup_state.rolled_up_to >= $1
+	`
+	if _, err := tx.ExecContext(ctx, q, from, to); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UsageRolledUpTo returns the end of the last usage rollup or, before the
+// first one, when the earliest session started. It is invalid when there is
+// neither.
+func (s *service) UsageRolledUpTo(ctx context.Context) (sql.NullTime, error) {
+	q := `
+		SELECT COALESCE(
+			(SELECT rolled_up_to FROM usage_rollup_state),
+			(SELECT MIN(started_at) FROM sessions)
+		)
+	`
+	var t sql.NullTime
+	err := s.db.QueryRowContext(ctx, q).Scan(&t)
+	return t, err
+}
+
+// GetUsage lists the daily usage rows matching the filter, oldest first
+func (s *service) GetUsage(ctx context.Context, filter UsageFilter) ([]*UsageRecord, error) {
+	q := `
+		SELECT ud.user_id, u.email, ud.day, ud.browser_type, ud.session_count, ud.browser_seconds
+		FROM usage_daily ud
+		JOIN users u ON u.id = ud.user_id
+		WHERE ud.day BETWEEN $1::date AND $2::date
+		  AND ($3::uuid IS NULL OR ud.user_id = $3)
+		ORDER BY ud.day, u.email, ud.browser_type
+	`
+
+	rows, err := s.db.QueryContext(ctx, q,
+		filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly), filter.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*UsageRecord
+	for rows.Next() {
+		r := &UsageRecord{}
+		if err := rows.Scan(&r.UserID, &r.UserEmail, &r.Day, &r.BrowserType, &r.SessionCount, &r.BrowserSeconds); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// IsUserAdmin reports whether the user may read other users' data
+func (s *service) IsUserAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	q := `SELECT is_admin FROM users WHERE id = $1`
+	var isAdmin bool
+	if err := s.db.QueryRowContext(ctx, q, userID).Scan(&isAdmin); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	return isAdmin, nil
+}
@@ -29,20 +29,29 @@ func (s *service) CreateUser(ctx context.Context, u *User) (uuid.UUID, error) {
 	return id, nil
 }
 
+// userColumns are the columns scanUser reads, in order
+const userColumns = `id, email, first_name, last_name, password_hash,
+           created_at, updated_at, disabled_at`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner) (*User, error) {
+	u := &User{}
+	err := row.Scan(
+		&u.ID, &u.Email, &u.FirstName, &u.LastName,
+		&u.PasswordHash, &u.CreatedAt, &u.UpdatedAt, &u.DisabledAt,
+	)
+	return u, err
+}
+
 // GetUserByEmail loads a user by email.
 func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	q := `
-    SELECT id, email, first_name, last_name, password_hash,
-           created_at, updated_at
+    SELECT ` + userColumns + `
     FROM users
     WHERE email = $1
   `
-	u := &User{}
-	row := s.db.QueryRowContext(ctx, q, email)
-	if err := row.Scan(
-		&u.ID, &u.Email, &u.FirstName, &u.LastName,
-		&u.PasswordHash, &u.CreatedAt, &u.UpdatedAt,
-	); err != nil {
+	u, err := scanUser(s.db.QueryRowContext(ctx, q, email))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
@@ -50,3 +59,59 @@ func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, erro
 	}
 	return u, nil
 }
+
+// ListUsers loads every user, oldest first.
+func (s *service) ListUsers(ctx context.Context) ([]*User, error) {
+	q := `
+    SELECT ` + userColumns + `
+    FROM users
+    ORDER BY created_at, email
+  `
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// DisableUser records that a user is disabled and returns the user. Disabling
+// a disabled user keeps the original time.
+func (s *service) DisableUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	q := `
+    UPDATE users
+    SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW()
+    WHERE id = $1
+    RETURNING ` + userColumns + `
+  `
+	u, err := scanUser(s.db.QueryRowContext(ctx, q, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// IsUserDisabled reports whether a user has been disabled
+func (s *service) IsUserDisabled(ctx context.Context, id uuid.UUID) (bool, error) {
+	q := `SELECT disabled_at IS NOT NULL FROM users WHERE id = $1`
+	var disabled bool
+	if err := s.db.QueryRowContext(ctx, q, id).Scan(&disabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	return disabled, nil
+}
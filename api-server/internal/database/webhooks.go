@@ -0,0 +1,383 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrWebhookNotFound is returned when the endpoint doesn't exist or belongs to another user.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned when the delivery doesn't exist for the endpoint.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint holds a row from webhook_endpoints. SecretEncrypted is
+// ciphertext from the secrets package.
+type WebhookEndpoint struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	URL             string
+	SecretEncrypted string
+	// Subscribed event types, empty for every event
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookEndpointView is the public representation of a WebhookEndpoint. The
+// secret is only returned when the endpoint is created.
+type WebhookEndpointView struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToView converts a WebhookEndpoint to a WebhookEndpointView
+func (e *WebhookEndpoint) ToView() *WebhookEndpointView {
+	events := e.Events
+	if events == nil {
+		events = []string{}
+	}
+	return &WebhookEndpointView{
+		ID:        e.ID.String(),
+		URL:       e.URL,
+		Events:    events,
+		Active:    e.Active,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// WebhookDelivery holds a row from webhook_deliveries. EndpointURL and
+// SecretEncrypted are only loaded for deliveries claimed for sending.
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	EndpointID     uuid.UUID
+	Event          string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt64
+	LastError      sql.NullString
+	CreatedAt      time.Time
+
+	EndpointURL     string
+	SecretEncrypted string
+}
+
+// WebhookDeliveryView is the public representation of a WebhookDelivery
+type WebhookDeliveryView struct {
+	ID             string          `json:"id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int64          `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// ToView converts a WebhookDelivery to a WebhookDeliveryView
+func (d *WebhookDelivery) ToView() *WebhookDeliveryView {
+	view := &WebhookDeliveryView{
+		ID:        d.ID.String(),
+		Event:     d.Event,
+		Payload:   d.Payload,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		LastError: d.LastError.String,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.Status == DeliveryPending {
+		next := d.NextAttemptAt
+		view.NextAttemptAt = &next
+	}
+	if d.LastAttemptAt.Valid {
+		last := d.LastAttemptAt.Time
+		view.LastAttemptAt = &last
+	}
+	if d.ResponseStatus.Valid {
+		status := d.ResponseStatus.Int64
+		view.ResponseStatus = &status
+	}
+	return view
+}
+
+const webhookEndpointColumns = `id, user_id, url, secret, events, active, created_at, updated_at`
+
+func scanWebhookEndpoint(row rowScanner) (*WebhookEndpoint, error) {
+	e := &WebhookEndpoint{}
+	var events []byte
+	if err := row.Scan(&e.ID, &e.UserID, &e.URL, &e.SecretEncrypted, &events, &e.Active, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(events, &e.Events); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+const webhookDeliveryColumns = `d.id, d.endpoint_id, d.event, d.payload, d.status, d.attempts,
+		d.next_attempt_at, d.last_attempt_at, d.response_status, d.last_error, d.created_at`
+
+func scanWebhookDelivery(row rowScanner, extra ...any) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var payload []byte
+	dest := []any{
+		&d.ID, &d.EndpointID, &d.Event, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	return d, nil
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint
+func (s *service) CreateWebhookEndpoint(ctx context.Context, e *WebhookEndpoint) error {
+	if e.Events == nil {
+		e.Events = []string{}
+	}
+	events, err := json.Marshal(e.Events)
+	if err != nil {
+		return err
+	}
+
+	q := `
+		INSERT INTO webhook_endpoints (user_id, url, secret, events)
+		VALUES ($1, $2, $3, $4::jsonb)
+		RETURNING id, active, created_at, updated_at
+	`
+	return s.db.QueryRowContext(ctx, q, e.UserID, e.URL, e.SecretEncrypted, string(events)).
+		Scan(&e.ID, &e.Active, &e.CreatedAt, &e.UpdatedAt)
+}
+
+// GetWebhookEndpoints lists a user's webhook endpoints
+func (s *service) GetWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]*WebhookEndpoint, error) {
+	q := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*WebhookEndpoint
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint loads one of a user's webhook endpoints
+func (s *service) GetWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*WebhookEndpoint, error) {
+	q := `
+		SELECT ` + webhookEndpointColumns + `
+		FROM webhook_endpoints
+		WHERE id = $1 AND user_id = $2
+	`
+	e, err := scanWebhookEndpoint(s.db.QueryRowContext(ctx, q, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	return e, err
+}
+
+// DeleteWebhookEndpoint removes a webhook endpoint along with its deliveries
+func (s *service) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	q := `
+		DELETE FROM webhook_endpoints
+		WHERE id = $1 AND user_id = $2
+	`
+	result, err := s.db.ExecContext(ctx, q, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueWebhookEvent queues a delivery of payload to each of the user's
+// active endpoints subscribed to event. It returns the number queued.
+func (s *service) EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, event string, payload []byte) (int64, error) {
+	q := `
+		INSERT INTO webhook_deliveries (endpoint_id, event, payload)
+		SELECT id, $2::text, $3::jsonb
+		FROM webhook_endpoints
+		WHERE user_id = $1 AND active
+		  AND (events = '[]'::jsonb OR events @> jsonb_build_array($2::text))
+	`
+	result, err := s.db.ExecContext(ctx, q, userID, event, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetWebhookDeliveries lists the most recent deliveries to an endpoint
+func (s *service) GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*WebhookDelivery, error) {
+	q := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM webhook_deliveries d
+		WHERE d.endpoint_id = $1
+		ORDER BY d.created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues a new delivery with the same event and payload
+// as an earlier one. The original stays in the log untouched.
+func (s *service) ReplayWebhookDelivery(ctx context.Context, endpointID uuid.UUID, deliveryID uuid.UUID) (*WebhookDelivery, error) {
+	q := `
+		INSERT INTO webhook_deliveries (endpoint_id, event, payload)
+		SELECT endpoint_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND endpoint_id = $2
+		RETURNING id, endpoint_id, event, payload, status, attempts,
+		          next_attempt_at, last_attempt_at, response_status, last_error, created_at
+	`
+	d, err := scanWebhookDelivery(s.db.QueryRowContext(ctx, q, deliveryID, endpointID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	return d, err
+}
+
+// ClaimWebhookDeliveries picks up to limit due deliveries for sending. Claimed
+// rows have their next attempt pushed out by lease so other dispatchers skip
+// them; if the sender dies they are retried once the lease runs out.
+func (s *service) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	q := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2::float8 * INTERVAL '1 second'
+		FROM due, webhook_endpoints e
+		WHERE d.id = due.id AND e.id = d.endpoint_id
+		RETURNING ` + webhookDeliveryColumns + `, e.url, e.secret
+	`
+
+	rows, err := s.db.QueryContext(ctx, q, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		d.EndpointURL = url
+		d.SecretEncrypted = secret
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// CompleteWebhookDelivery records the outcome of a delivery attempt: its
+// Status, Attempts, NextAttemptAt, ResponseStatus and LastError
+func (s *service) CompleteWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+	q := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_attempt_at = NOW(),
+		    response_status = $5, last_error = $6
+		WHERE id = $1
+	`
+	_, err := s.db.ExecContext(ctx, q, d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseStatus, d.LastError)
+	return err
+}
+
+// PurgeWebhookDeliveries removes succeeded and failed deliveries whose last
+// attempt was before the cutoff. Pending deliveries are kept however old. It
+// returns the number of deliveries removed.
+func (s *service) PurgeWebhookDeliveries(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	q := `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND last_attempt_at < $1
+	`
+
+	result, err := s.db.ExecContext(ctx, q, finishedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,229 @@
+// Package logging configures structured JSON logging with log/slog: levels
+// per package, request IDs carried through contexts, and redaction of
+// personal data and credentials
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces the values of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys, or key suffixes, whose values are never
+// logged
+var sensitiveKeys = []string{
+	"password", "token", "secret", "authorization", "cookie", "email", "cdp_url", "api_key", "license",
+}
+
+// config is the logging configuration set by Setup
+var config = struct {
+	sync.RWMutex
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}{
+	handler: newJSONHandler(os.Stderr),
+	level:   slog.LevelInfo,
+}
+
+// Setup installs the JSON logger writing to w as the default slog logger,
+// which the standard log package also writes through. level sets the
+// default level and levels overrides it per package, e.g.
+// "browser=debug,database=warn".
+func Setup(w io.Writer, level, levels string) error {
+	defaultLevel, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	packageLevels, err := ParseLevels(levels)
+	if err != nil {
+		return err
+	}
+
+	config.Lock()
+	config.handler = newJSONHandler(w)
+	config.level = defaultLevel
+	config.levels = packageLevels
+	config.Unlock()
+
+	slog.SetDefault(For("app"))
+	return nil
+}
+
+// ParseLevel parses a level name such as info or debug
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("invalid log level %q: %w", s, err)
+	}
+	return level, nil
+}
+
+// ParseLevels parses comma-separated package=level pairs
+func ParseLevels(s string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, lvl, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid package level %q: expected package=level", entry)
+		}
+		level, err := ParseLevel(lvl)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(pkg)] = level
+	}
+	return levels, nil
+}
+
+func newJSONHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		// Levels are filtered per package by packageHandler
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redact,
+	})
+}
+
+// sensitivePatterns match personal data and credentials inside messages and
+// error strings: email addresses, bearer tokens and JWTs
+var sensitivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+}
+
+// Scrub replaces personal data and credentials found in s
+func Scrub(s string) string {
+	for _, p := range sensitivePatterns {
+		s = p.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// redact hides the values of sensitive attributes and scrubs strings and
+// errors, including the message
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.HasSuffix(key, sensitive) {
+			return slog.String(a.Key, Redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+	return a
+}
+
+// For returns the logger of a package. Its records carry the package name and
+// are filtered at the package's level. The logger follows later calls to
+// Setup, so packages may create theirs at init.
+func For(pkg string) *slog.Logger {
+	return slog.New(&packageHandler{pkg: pkg}).With("package", pkg)
+}
+
+// packageHandler filters records at its package's level and adds the request
+// and trace IDs found in the context before passing them to the configured
+// handler
+type packageHandler struct {
+	pkg   string
+	attrs []slog.Attr
+	group string
+}
+
+func (h *packageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	config.RLock()
+	defer config.RUnlock()
+
+	threshold, ok := config.levels[h.pkg]
+	if !ok {
+		threshold = config.level
+	}
+	return level >= threshold
+}
+
+func (h *packageHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+
+	config.RLock()
+	handler := config.handler
+	config.RUnlock()
+
+	if len(h.attrs) > 0 {
+		handler = handler.WithAttrs(h.attrs)
+	}
+	if h.group != "" {
+		handler = handler.WithGroup(h.group)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	// Groups nest only one level deep here, which is all this service uses
+	clone := *h
+	clone.group = name
+	return &clone
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Stack returns the calling goroutine's stack, skipping skip frames, as a
+// list of "function file:line" entries suitable for a log attribute
+func Stack(skip int) []string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []string
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// capture sets up logging into a buffer with the given levels and returns
+// the buffer
+func capture(t *testing.T, level, levels string) *bytes.Buffer {
+	var buf bytes.Buffer
+	require.NoError(t, Setup(&buf, level, levels))
+	return &buf
+}
+
+// lines decodes the JSON records written to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		require.NoError(t, dec.Decode(&record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRedaction(t *testing.T) {
+	buf := capture(t, "info", "")
+
+	For("test").Info("signed in user@example.com",
+		"email", "user@example.com",
+		"access_token", "abc",
+		"user_id", "42",
+		"error", errors.New("request with Bearer abc.def failed for user@example.com"),
+	)
+
+	records := lines(t, buf)
+	require.Len(t, records, 1)
+	record := records[0]
+	require.Equal(t, "signed in "+Redacted, record["msg"])
+	require.Equal(t, Redacted, record["email"])
+	require.Equal(t, Redacted, record["access_token"])
+	require.Equal(t, "42", record["user_id"])
+	require.Equal(t, "request with "+Redacted+" failed for "+Redacted, record["error"])
+	require.Equal(t, "test", record["package"])
+}
+
+func TestPackageLevels(t *testing.T) {
+	buf := capture(t, "warn", "browser=debug")
+
+	For("browser").Debug("browser debug")
+	For("server").Info("server info")
+	For("server").Warn("server warn")
+
+	var msgs []any
+	for _, record := range lines(t, buf) {
+		msgs = append(msgs, record["msg"])
+	}
+	require.Equal(t, []any{"browser debug", "server warn"}, msgs)
+
+	require.Error(t, Setup(&bytes.Buffer{}, "info", "browser"))
+	require.Error(t, Setup(&bytes.Buffer{}, "loud", ""))
+}
+
+func TestRequestID(t *testing.T) {
+	buf := capture(t, "info", "")
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	require.Equal(t, "req-1", RequestID(ctx))
+	require.Empty(t, RequestID(context.Background()))
+
+	For("test").With("attempt", 1).InfoContext(ctx, "with id")
+	For("test").Info("without id")
+
+	records := lines(t, buf)
+	require.Len(t, records, 2)
+	require.Equal(t, "req-1", records[0]["request_id"])
+	require.EqualValues(t, 1, records[0]["attempt"])
+	require.NotContains(t, records[1], "request_id")
+}
+
+func TestStack(t *testing.T) {
+	stack := Stack(0)
+	require.NotEmpty(t, stack)
+	require.Contains(t, stack[0], "TestStack")
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrKeyNotConfigured is returned when SECRETS_KEY is not set
+var ErrKeyNotConfigured = errors.New("secrets key not configured")
+
+// Box encrypts and decrypts secrets with the configured SECRETS_KEY
+type Box struct {
+	rawKey string
+}
+
+// New returns a Box encrypting with key
+func New(key string) *Box {
+	return &Box{rawKey: key}
+}
+
+// key derives the AES-256 key from SECRETS_KEY
+func (b *Box) key() ([]byte, error) {
+	if b.rawKey == "" {
+		return nil, ErrKeyNotConfigured
+	}
+	sum := sha256.Sum256([]byte(b.rawKey))
+	return sum[:], nil
+}
+
+func (b *Box) newGCM() (cipher.AEAD, error) {
+	k, err := b.key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with AES-GCM and returns it base64 encoded with the
+// nonce prepended, suitable for storing in a TEXT column.
+func (b *Box) Encrypt(plaintext string) (string, error) {
+	gcm, err := b.newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt.
+func (b *Box) Decrypt(ciphertext string) (string, error) {
+	gcm, err := b.newGCM()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
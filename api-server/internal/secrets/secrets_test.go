@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	box := New("test-key")
+
+	ciphertext, err := box.Encrypt("proxy-password")
+	require.NoError(t, err)
+	require.NotContains(t, ciphertext, "proxy-password")
+
+	plaintext, err := box.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "proxy-password", plaintext)
+
+	// Every encryption uses a fresh nonce
+	again, err := box.Encrypt("proxy-password")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again)
+}
+
+func TestDecryptWithWrongKey(t *testing.T) {
+	box := New("test-key")
+
+	ciphertext, err := box.Encrypt("proxy-password")
+	require.NoError(t, err)
+
+	_, err = New("other-key").Decrypt(ciphertext)
+	require.Error(t, err)
+}
+
+func TestDecryptTampered(t *testing.T) {
+	box := New("test-key")
+
+	ciphertext, err := box.Encrypt("proxy-password")
+	require.NoError(t, err)
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	require.NoError(t, err)
+
+	data[len(data)-1] ^= 1
+	_, err = box.Decrypt(base64.StdEncoding.EncodeToString(data))
+	require.Error(t, err)
+
+	_, err = box.Decrypt(base64.StdEncoding.EncodeToString(data[:4]))
+	require.Error(t, err)
+	_, err = box.Decrypt("not base64!")
+	require.Error(t, err)
+}
+
+func TestKeyNotConfigured(t *testing.T) {
+	box := New("")
+
+	_, err := box.Encrypt("proxy-password")
+	require.ErrorIs(t, err, ErrKeyNotConfigured)
+	_, err = box.Decrypt("c2VjcmV0")
+	require.ErrorIs(t, err, ErrKeyNotConfigured)
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"api-server/internal/browser"
+	"api-server/internal/config"
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// Admin carries out the maintenance behind the API binary's admin commands.
+// It works through the same database and browser clients as the server, and
+// emits the same session events, but neither serves nor runs background
+// jobs.
+type Admin struct {
+	s *Server
+}
+
+// NewAdmin returns an Admin working on db and the browser backend of cfg,
+// with the server settings of cfg
+func NewAdmin(db database.Service, cfg *config.Config) (*Admin, error) {
+	browsers, err := browser.New(cfg.Browser)
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{s: newServer(db, cfg, browsers)}, nil
+}
+
+// CreateUser registers a user, as the register endpoint does
+func (a *Admin) CreateUser(ctx context.Context, email, firstName, lastName, password string) (*database.User, error) {
+	if email == "" || password == "" {
+		return nil, errors.New("email and password are required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	u := &database.User{
+		Email:        email,
+		FirstName:    firstName,
+		LastName:     lastName,
+		PasswordHash: string(hash),
+	}
+	id, err := a.s.db.CreateUser(ctx, u)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			return nil, fmt.Errorf("a user with email %s already exists", email)
+		}
+		return nil, err
+	}
+	u.ID = id
+	logger.InfoContext(ctx, "Created user", "user_id", u.ID)
+	return u, nil
+}
+
+// ListUsers returns every user
+func (a *Admin) ListUsers(ctx context.Context) ([]*database.User, error) {
+	return a.s.db.ListUsers(ctx)
+}
+
+// DisableUser stops the user with email from logging in and, when
+// stopSessions is set, stops the user's active sessions, which are returned.
+// Tokens already issued are rejected from then on.
+func (a *Admin) DisableUser(ctx context.Context, email string, stopSessions bool) (*database.User, []*database.Session, error) {
+	u, err := a.s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err = a.s.db.DisableUser(ctx, u.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.InfoContext(ctx, "Disabled user", "user_id", u.ID)
+
+	if !stopSessions {
+		return u, nil, nil
+	}
+	stopped, err := a.StopSessions(ctx, email, nil)
+	return u, stopped, err
+}
+
+// ListSessions returns the active sessions of the user with email, every
+// session of the user when all is set, or the active sessions of every user
+// when email is empty
+func (a *Admin) ListSessions(ctx context.Context, email string, all bool) ([]*database.Session, error) {
+	if email == "" {
+		if all {
+			return nil, errors.New("listing stopped sessions requires a user")
+		}
+		return a.s.db.ListActiveSessions(ctx)
+	}
+
+	u, err := a.s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	filter := database.SessionFilter{UserID: u.ID, Status: database.SessionStatusActive}
+	if all {
+		filter.Status = database.SessionStatusAny
+	}
+	return a.s.db.ListSessions(ctx, filter)
+}
+
+// StopSessions stops the given sessions of the user with email, or all of the
+// user's active sessions when ids is empty, and returns those stopped.
+// Sessions already stopped are skipped.
+func (a *Admin) StopSessions(ctx context.Context, email string, ids []uuid.UUID) ([]*database.Session, error) {
+	u, err := a.s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*database.Session
+	if len(ids) == 0 {
+		sessions, err = a.s.db.ListSessions(ctx, database.SessionFilter{UserID: u.ID, Status: database.SessionStatusActive})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		session, err := a.s.db.GetSessionByID(ctx, id, u.ID)
+		// Sessions shared with the user belong to someone else
+		if err == nil && session.UserID != u.ID {
+			err = database.ErrSessionNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %w", id, err)
+		}
+		if !session.StoppedAt.Valid {
+			sessions = append(sessions, session)
+		}
+	}
+
+	var stopped []*database.Session
+	var errs []error
+	for _, session := range sessions {
+		s, err := a.s.stopSession(ctx, session)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop session %s: %w", session.ID, err))
+			continue
+		}
+		stopped = append(stopped, s)
+	}
+	return stopped, errors.Join(errs...)
+}
+
+// ReapResult counts what a reap cleaned up
+type ReapResult struct {
+	Expired          int
+	FailedPending    int
+	Purged           int64
+	PurgedDeliveries int64
+}
+
+// Reap runs the session clean-up of the background jobs once: it stops
+// expired sessions, fails sessions stuck pending and purges archived sessions
+// and finished webhook deliveries past their retention
+func (a *Admin) Reap(ctx context.Context) (ReapResult, error) {
+	var result ReapResult
+	var errs []error
+	var err error
+	if result.Expired, err = a.s.expireSessions(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to expire sessions: %w", err))
+	}
+	if result.FailedPending, err = a.s.failStalePendingSessions(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to fail stale pending sessions: %w", err))
+	}
+	if a.s.sessionRetention > 0 {
+		if result.Purged, err = a.s.purgeArchivedSessions(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge archived sessions: %w", err))
+		}
+	}
+	if a.s.webhookRetention > 0 {
+		if result.PurgedDeliveries, err = a.s.purgeWebhookDeliveries(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to purge webhook deliveries: %w", err))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// ReconcileResult reports the differences a reconcile found between the
+// database and the browser servers
+type ReconcileResult struct {
+	// Stopped are active sessions whose browser no longer exists
+	Stopped []*database.Session
+	// Deleted are browsers no active session refers to
+	Deleted []*browser.SessionResponse
+	// Unreachable are browser server nodes that couldn't be checked, whose
+	// sessions were left alone
+	Unreachable []string
+}
+
+// Reconcile compares the active sessions in the database with the browsers
+// running on the browser servers. Sessions whose browser is gone are marked
+// stopped, and browsers no session refers to are deleted once they are older
+// than a launch or an idle warm browser can be. With dryRun set it only
+// reports what it would change.
+func (a *Admin) Reconcile(ctx context.Context, dryRun bool) (*ReconcileResult, error) {
+	result := &ReconcileResult{}
+
+	// checked reports whether the browsers on node were listed
+	checked := func(node string) bool { return true }
+	if pool := a.s.browsers.Pool(); pool != nil {
+		pool.Refresh(ctx)
+		healthy := make(map[string]bool)
+		for _, n := range pool.Nodes() {
+			if n.Healthy {
+				healthy[n.URL] = true
+			} else {
+				result.Unreachable = append(result.Unreachable, n.URL)
+			}
+		}
+		checked = func(node string) bool {
+			if node == "" {
+				return len(result.Unreachable) == 0
+			}
+			return healthy[node]
+		}
+	}
+
+	// Sessions are listed first so that every browser they refer to was
+	// launched before the browsers are listed. Browsers launched in between
+	// are younger than the grace period below.
+	sessions, err := a.s.db.ListActiveSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	browsers, err := a.s.browsers.Client().ListSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list browsers: %w", err)
+	}
+
+	running := make(map[string]bool, len(browsers))
+	for _, b := range browsers {
+		running[b.ID] = true
+	}
+	referenced := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		referenced[session.BrowserID] = true
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		// Pending sessions have no browser yet
+		if session.BrowserID == "" || running[session.BrowserID] || !checked(session.BrowserNode) {
+			continue
+		}
+		result.Stopped = append(result.Stopped, session)
+		if dryRun {
+			continue
+		}
+		stopped, err := a.s.db.StopSession(ctx, session.ID, session.UserID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop session %s: %w", session.ID, err))
+			continue
+		}
+		logger.InfoContext(ctx, "Stopped session whose browser is gone", "session_id", session.ID, "browser_id", session.BrowserID)
+		a.s.sessionUpdates.notify(session.ID)
+		a.s.emitSessionEvent(ctx, session.UserID, webhook.EventSessionStopped, stopped, "")
+	}
+
+	// Browsers being launched or kept warm aren't recorded on a session yet
+	grace := max(a.s.pendingSessionTimeout, a.s.warmPoolMaxIdle)
+	for _, b := range browsers {
+		createdAt := b.CreatedAt.Time()
+		if referenced[b.ID] || createdAt.IsZero() || time.Since(createdAt) < grace {
+			continue
+		}
+		result.Deleted = append(result.Deleted, b)
+		if dryRun {
+			continue
+		}
+		if err := a.s.browsers.NodeClient(b.Node).DeleteSession(ctx, b.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete browser %s: %w", b.ID, err))
+			continue
+		}
+		logger.InfoContext(ctx, "Deleted orphaned browser", "browser_id", b.ID, "node", b.Node)
+	}
+	return result, errors.Join(errs...)
+}
@@ -1,11 +1,8 @@
 package server
 
 import (
-	"api-server/internal/auth"
 	"api-server/internal/database"
-	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
 
@@ -25,12 +22,9 @@ func toView(u *database.User) *database.UserView {
 func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Log the incoming request
-	log.Printf("RegisterHandler: received request")
-
 	var req database.AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("RegisterHandler: failed to decode request body: %v", err)
+		logger.InfoContext(r.Context(), "Invalid registration request", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(database.APIResponse{
 			Error: "bad request",
@@ -39,11 +33,10 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("RegisterHandler: processing request for email: %s", req.Email)
 	// hash the password
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("RegisterHandler: failed to hash password: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to hash password", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(database.APIResponse{
 			Error: "server error",
@@ -58,12 +51,10 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		PasswordHash: string(hash),
 	}
 
-	log.Printf("RegisterHandler: creating user with email: %s", u.Email)
-
-	ctx := context.Background()
+	ctx := r.Context()
 	id, err := s.db.CreateUser(ctx, u)
 	if err != nil {
-		log.Printf("RegisterHandler: failed to create user: %v", err)
+		logger.ErrorContext(ctx, "Failed to create user", "error", err)
 		msg := "could not create user"
 		if strings.Contains(err.Error(), "duplicate key value") {
 			msg = "email already exists"
@@ -78,12 +69,12 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	u.ID = id
-	log.Printf("RegisterHandler: successfully created user with ID: %s", u.ID)
+	logger.InfoContext(ctx, "Registered user", "user_id", u.ID)
 
 	// generate token
-	token, err := auth.GenerateToken(u.ID.String())
+	token, err := s.tokens.Generate(u.ID.String())
 	if err != nil {
-		log.Printf("RegisterHandler: failed to generate token: %v", err)
+		logger.ErrorContext(ctx, "Failed to generate token", "user_id", u.ID, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(database.APIResponse{
 			Error: "could not sign token",
@@ -91,7 +82,6 @@ func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	log.Printf("RegisterHandler: successfully generated token for user: %s", u.Email)
 
 	authResponse := database.AuthResponse{
 		Token: token,
@@ -117,7 +107,7 @@ func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	ctx := context.Background()
+	ctx := r.Context()
 	u, err := s.db.GetUserByEmail(ctx, req.Email)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -136,7 +126,17 @@ func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	token, err := auth.GenerateToken(u.ID.String())
+	// Disabled users can't log in, and AuthMiddleware rejects the tokens
+	// they already hold
+	if u.DisabledAt.Valid {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(database.APIResponse{
+			Error: "account disabled",
+			Data:  nil,
+		})
+		return
+	}
+	token, err := s.tokens.Generate(u.ID.String())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(database.APIResponse{
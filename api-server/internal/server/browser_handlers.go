@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"api-server/internal/browser"
+)
+
+// BrowserNodesResponse lists the browser server nodes sessions are placed on
+type BrowserNodesResponse struct {
+	Backend string               `json:"backend"`
+	Nodes   []browser.NodeStatus `json:"nodes"`
+}
+
+// GetBrowserNodesHandler reports the last known health and capacity of each
+// browser server node. The fake backend has no nodes.
+func (s *Server) GetBrowserNodesHandler(w http.ResponseWriter, r *http.Request) {
+	resp := BrowserNodesResponse{
+		Backend: s.browsers.Name(),
+		Nodes:   []browser.NodeStatus{},
+	}
+	if pool := s.browsers.Pool(); pool != nil {
+		resp.Nodes = pool.Nodes()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -2,46 +2,39 @@ package server
 
 import (
 	"api-server/internal/database"
+	"api-server/internal/telemetry"
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
-// DatabaseInstrumentation wraps a database.Service to provide New Relic instrumentation
+// DatabaseInstrumentation wraps a database.Service to time every call as a
+// segment of the telemetry provider's current transaction
 type DatabaseInstrumentation struct {
-	db    database.Service
-	nrApp *newrelic.Application
+	db        database.Service
+	telemetry telemetry.Provider
 }
 
 // NewDatabaseInstrumentation creates a new database instrumentation layer
-func NewDatabaseInstrumentation(db database.Service, nrApp *newrelic.Application) database.Service {
-	if nrApp == nil {
-		return db // If New Relic isn't available, just return the original DB
+func NewDatabaseInstrumentation(db database.Service, provider telemetry.Provider) database.Service {
+	if provider == nil {
+		return db // Without a provider, just return the original DB
 	}
 	return &DatabaseInstrumentation{
-		db:    db,
-		nrApp: nrApp,
+		db:        db,
+		telemetry: provider,
 	}
 }
 
 // startSegment begins a database segment and returns the segment along with a callback to end it
-func (d *DatabaseInstrumentation) startSegment(ctx context.Context, operation string) (*newrelic.DatastoreSegment, func()) {
-	// Try to get transaction from context
-	txn := newrelic.FromContext(ctx)
-	if txn == nil {
+func (d *DatabaseInstrumentation) startSegment(ctx context.Context, operation string) (*telemetry.Segment, func()) {
+	segment := d.telemetry.StartSegment(ctx, operation)
+	if segment == nil {
 		return nil, func() {} // No transaction, return no-op
 	}
-
-	segment := &newrelic.DatastoreSegment{
-		Product:    newrelic.DatastorePostgres,
-		Collection: "", // Would be table name if available
-		Operation:  operation,
-		StartTime:  txn.StartSegmentNow(),
-	}
-
-	return segment, func() { segment.End() }
+	return segment, segment.End
 }
 
 // DB returns the underlying sql.DB connection
@@ -52,16 +45,28 @@ func (d *DatabaseInstrumentation) DB() *sql.DB {
 
 // Health returns a map of health status information
 func (d *DatabaseInstrumentation) Health() map[string]string {
-	// Not adding New Relic instrumentation to health check as it's internal
+	// Not timing health check as it's internal
 	return d.db.Health()
 }
 
 // Close closes the database connection
 func (d *DatabaseInstrumentation) Close() error {
-	// Not adding New Relic instrumentation to close as it's internal
+	// Not timing close as it's internal
 	return d.db.Close()
 }
 
+// SchemaVersion returns the applied migration version
+func (d *DatabaseInstrumentation) SchemaVersion(ctx context.Context) (int, bool, error) {
+	segment, end := d.startSegment(ctx, "SchemaVersion")
+	defer end()
+
+	version, dirty, err := d.db.SchemaVersion(ctx)
+	if segment != nil {
+		segment.Collection = "schema_migrations"
+	}
+	return version, dirty, err
+}
+
 // User methods
 
 // CreateUser creates a new user
@@ -88,6 +93,42 @@ func (d *DatabaseInstrumentation) GetUserByEmail(ctx context.Context, email stri
 	return user, err
 }
 
+// ListUsers lists every user
+func (d *DatabaseInstrumentation) ListUsers(ctx context.Context) ([]*database.User, error) {
+	segment, end := d.startSegment(ctx, "ListUsers")
+	defer end()
+
+	users, err := d.db.ListUsers(ctx)
+	if segment != nil {
+		segment.Collection = "users"
+	}
+	return users, err
+}
+
+// DisableUser disables a user
+func (d *DatabaseInstrumentation) DisableUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	segment, end := d.startSegment(ctx, "DisableUser")
+	defer end()
+
+	user, err := d.db.DisableUser(ctx, id)
+	if segment != nil {
+		segment.Collection = "users"
+	}
+	return user, err
+}
+
+// IsUserDisabled checks whether a user is disabled
+func (d *DatabaseInstrumentation) IsUserDisabled(ctx context.Context, id uuid.UUID) (bool, error) {
+	segment, end := d.startSegment(ctx, "IsUserDisabled")
+	defer end()
+
+	result, err := d.db.IsUserDisabled(ctx, id)
+	if segment != nil {
+		segment.Collection = "users"
+	}
+	return result, err
+}
+
 // Session methods
 
 // CreateSession creates a new session
@@ -102,6 +143,18 @@ func (d *DatabaseInstrumentation) CreateSession(ctx context.Context, userID uuid
 	return session, err
 }
 
+// CreateSessionWithOptions creates a new session with optional launch settings
+func (d *DatabaseInstrumentation) CreateSessionWithOptions(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string, opts database.SessionOptions) (*database.Session, error) {
+	segment, end := d.startSegment(ctx, "CreateSessionWithOptions")
+	defer end()
+
+	session, err := d.db.CreateSessionWithOptions(ctx, userID, name, browserID, browserType, cdpURL, headless, viewportW, viewportH, userAgent, opts)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return session, err
+}
+
 // GetSessionsByUserID gets sessions by user ID
 func (d *DatabaseInstrumentation) GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*database.Session, error) {
 	segment, end := d.startSegment(ctx, "GetSessionsByUserID")
@@ -114,6 +167,30 @@ func (d *DatabaseInstrumentation) GetSessionsByUserID(ctx context.Context, userI
 	return sessions, err
 }
 
+// ListSessions gets the sessions matching a filter
+func (d *DatabaseInstrumentation) ListSessions(ctx context.Context, filter database.SessionFilter) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "ListSessions")
+	defer end()
+
+	sessions, err := d.db.ListSessions(ctx, filter)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+// StreamSessions streams the sessions matching a filter
+func (d *DatabaseInstrumentation) StreamSessions(ctx context.Context, filter database.SessionFilter, fn func(*database.Session) error) error {
+	segment, end := d.startSegment(ctx, "StreamSessions")
+	defer end()
+
+	err := d.db.StreamSessions(ctx, filter, fn)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return err
+}
+
 // GetSessionByID gets a specific session
 func (d *DatabaseInstrumentation) GetSessionByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.Session, error) {
 	segment, end := d.startSegment(ctx, "GetSessionByID")
@@ -138,6 +215,18 @@ func (d *DatabaseInstrumentation) StopSession(ctx context.Context, id uuid.UUID,
 	return session, err
 }
 
+// UpdateSessionEmulation updates a session's emulation overrides
+func (d *DatabaseInstrumentation) UpdateSessionEmulation(ctx context.Context, id uuid.UUID, userID uuid.UUID, emulation database.SessionEmulation) (*database.Session, error) {
+	segment, end := d.startSegment(ctx, "UpdateSessionEmulation")
+	defer end()
+
+	session, err := d.db.UpdateSessionEmulation(ctx, id, userID, emulation)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return session, err
+}
+
 // DeleteSession deletes a session
 func (d *DatabaseInstrumentation) DeleteSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
 	segment, end := d.startSegment(ctx, "DeleteSession")
@@ -148,4 +237,502 @@ func (d *DatabaseInstrumentation) DeleteSession(ctx context.Context, id uuid.UUI
 		segment.Collection = "sessions"
 	}
 	return err
-}
\ No newline at end of file
+}
+
+// PurgeArchivedSessions permanently removes archived sessions
+func (d *DatabaseInstrumentation) PurgeArchivedSessions(ctx context.Context, archivedBefore time.Time) (int64, error) {
+	segment, end := d.startSegment(ctx, "PurgeArchivedSessions")
+	defer end()
+
+	purged, err := d.db.PurgeArchivedSessions(ctx, archivedBefore)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return purged, err
+}
+
+// ExpireSessions stops sessions past their expiry time
+func (d *DatabaseInstrumentation) ExpireSessions(ctx context.Context) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "ExpireSessions")
+	defer end()
+
+	sessions, err := d.db.ExpireSessions(ctx)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+func (d *DatabaseInstrumentation) CompletePendingSession(ctx context.Context, id uuid.UUID, launch database.SessionLaunch) (*database.Session, error) {
+	segment, end := d.startSegment(ctx, "CompletePendingSession")
+	defer end()
+
+	session, err := d.db.CompletePendingSession(ctx, id, launch)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return session, err
+}
+
+func (d *DatabaseInstrumentation) FailPendingSession(ctx context.Context, id uuid.UUID, reason string) (*database.Session, error) {
+	segment, end := d.startSegment(ctx, "FailPendingSession")
+	defer end()
+
+	session, err := d.db.FailPendingSession(ctx, id, reason)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return session, err
+}
+
+func (d *DatabaseInstrumentation) FailStalePendingSessions(ctx context.Context, startedBefore time.Time, reason string) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "FailStalePendingSessions")
+	defer end()
+
+	sessions, err := d.db.FailStalePendingSessions(ctx, startedBefore, reason)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+// CountActiveSessionsByBrowserType counts active sessions per browser type
+func (d *DatabaseInstrumentation) CountActiveSessionsByBrowserType(ctx context.Context) (map[string]int, error) {
+	segment, end := d.startSegment(ctx, "CountActiveSessionsByBrowserType")
+	defer end()
+
+	counts, err := d.db.CountActiveSessionsByBrowserType(ctx)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return counts, err
+}
+
+// ListInstanceSessions lists the active sessions owned by an instance
+func (d *DatabaseInstrumentation) ListInstanceSessions(ctx context.Context, instanceID string) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "ListInstanceSessions")
+	defer end()
+
+	sessions, err := d.db.ListInstanceSessions(ctx, instanceID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+// ListActiveSessions lists every session that hasn't stopped
+func (d *DatabaseInstrumentation) ListActiveSessions(ctx context.Context) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "ListActiveSessions")
+	defer end()
+
+	sessions, err := d.db.ListActiveSessions(ctx)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+// ReleaseInstanceSessions hands off the active sessions of an instance
+func (d *DatabaseInstrumentation) ReleaseInstanceSessions(ctx context.Context, instanceID string) (int64, error) {
+	segment, end := d.startSegment(ctx, "ReleaseInstanceSessions")
+	defer end()
+
+	released, err := d.db.ReleaseInstanceSessions(ctx, instanceID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return released, err
+}
+
+// AdoptOrphanedSessions takes ownership of sessions without an owner
+func (d *DatabaseInstrumentation) AdoptOrphanedSessions(ctx context.Context, instanceID string) (int64, error) {
+	segment, end := d.startSegment(ctx, "AdoptOrphanedSessions")
+	defer end()
+
+	adopted, err := d.db.AdoptOrphanedSessions(ctx, instanceID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return adopted, err
+}
+
+// Sharing methods
+
+// GetSessionAccess gets a session and the caller's access level
+func (d *DatabaseInstrumentation) GetSessionAccess(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.Session, database.AccessLevel, error) {
+	segment, end := d.startSegment(ctx, "GetSessionAccess")
+	defer end()
+
+	session, access, err := d.db.GetSessionAccess(ctx, id, userID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return session, access, err
+}
+
+// GetSessionsSharedWithUser gets sessions shared with a user
+func (d *DatabaseInstrumentation) GetSessionsSharedWithUser(ctx context.Context, userID uuid.UUID) ([]*database.SharedSession, error) {
+	segment, end := d.startSegment(ctx, "GetSessionsSharedWithUser")
+	defer end()
+
+	sessions, err := d.db.GetSessionsSharedWithUser(ctx, userID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return sessions, err
+}
+
+// CreateSessionShare creates a session share
+func (d *DatabaseInstrumentation) CreateSessionShare(ctx context.Context, share *database.SessionShare) error {
+	segment, end := d.startSegment(ctx, "CreateSessionShare")
+	defer end()
+
+	err := d.db.CreateSessionShare(ctx, share)
+	if segment != nil {
+		segment.Collection = "session_shares"
+	}
+	return err
+}
+
+// GetSessionShares gets the active shares of a session
+func (d *DatabaseInstrumentation) GetSessionShares(ctx context.Context, sessionID uuid.UUID) ([]*database.SessionShare, error) {
+	segment, end := d.startSegment(ctx, "GetSessionShares")
+	defer end()
+
+	shares, err := d.db.GetSessionShares(ctx, sessionID)
+	if segment != nil {
+		segment.Collection = "session_shares"
+	}
+	return shares, err
+}
+
+// RevokeSessionShare revokes a session share
+func (d *DatabaseInstrumentation) RevokeSessionShare(ctx context.Context, sessionID uuid.UUID, shareID uuid.UUID) error {
+	segment, end := d.startSegment(ctx, "RevokeSessionShare")
+	defer end()
+
+	err := d.db.RevokeSessionShare(ctx, sessionID, shareID)
+	if segment != nil {
+		segment.Collection = "session_shares"
+	}
+	return err
+}
+
+// Organization methods
+
+// CreateOrganization creates an organization
+func (d *DatabaseInstrumentation) CreateOrganization(ctx context.Context, org *database.Organization, ownerID uuid.UUID) error {
+	segment, end := d.startSegment(ctx, "CreateOrganization")
+	defer end()
+
+	err := d.db.CreateOrganization(ctx, org, ownerID)
+	if segment != nil {
+		segment.Collection = "organizations"
+	}
+	return err
+}
+
+// GetOrganizationForUser gets an organization with the user's role
+func (d *DatabaseInstrumentation) GetOrganizationForUser(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*database.Organization, error) {
+	segment, end := d.startSegment(ctx, "GetOrganizationForUser")
+	defer end()
+
+	result, err := d.db.GetOrganizationForUser(ctx, orgID, userID)
+	if segment != nil {
+		segment.Collection = "organizations"
+	}
+	return result, err
+}
+
+// GetOrganizationsByUserID gets the organizations a user belongs to
+func (d *DatabaseInstrumentation) GetOrganizationsByUserID(ctx context.Context, userID uuid.UUID) ([]*database.Organization, error) {
+	segment, end := d.startSegment(ctx, "GetOrganizationsByUserID")
+	defer end()
+
+	result, err := d.db.GetOrganizationsByUserID(ctx, userID)
+	if segment != nil {
+		segment.Collection = "organizations"
+	}
+	return result, err
+}
+
+// UpdateOrganization updates an organization
+func (d *DatabaseInstrumentation) UpdateOrganization(ctx context.Context, org *database.Organization) error {
+	segment, end := d.startSegment(ctx, "UpdateOrganization")
+	defer end()
+
+	err := d.db.UpdateOrganization(ctx, org)
+	if segment != nil {
+		segment.Collection = "organizations"
+	}
+	return err
+}
+
+// GetOrganizationMembers gets the members of an organization
+func (d *DatabaseInstrumentation) GetOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]*database.OrganizationMember, error) {
+	segment, end := d.startSegment(ctx, "GetOrganizationMembers")
+	defer end()
+
+	result, err := d.db.GetOrganizationMembers(ctx, orgID)
+	if segment != nil {
+		segment.Collection = "organization_members"
+	}
+	return result, err
+}
+
+// AddOrganizationMember adds a member to an organization
+func (d *DatabaseInstrumentation) AddOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role database.OrgRole) error {
+	segment, end := d.startSegment(ctx, "AddOrganizationMember")
+	defer end()
+
+	err := d.db.AddOrganizationMember(ctx, orgID, userID, role)
+	if segment != nil {
+		segment.Collection = "organization_members"
+	}
+	return err
+}
+
+// UpdateOrganizationMemberRole changes a member's role
+func (d *DatabaseInstrumentation) UpdateOrganizationMemberRole(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role database.OrgRole) error {
+	segment, end := d.startSegment(ctx, "UpdateOrganizationMemberRole")
+	defer end()
+
+	err := d.db.UpdateOrganizationMemberRole(ctx, orgID, userID, role)
+	if segment != nil {
+		segment.Collection = "organization_members"
+	}
+	return err
+}
+
+// RemoveOrganizationMember removes a member from an organization
+func (d *DatabaseInstrumentation) RemoveOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error {
+	segment, end := d.startSegment(ctx, "RemoveOrganizationMember")
+	defer end()
+
+	err := d.db.RemoveOrganizationMember(ctx, orgID, userID)
+	if segment != nil {
+		segment.Collection = "organization_members"
+	}
+	return err
+}
+
+// GetSessionsByOrgID gets sessions by organization ID
+func (d *DatabaseInstrumentation) GetSessionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*database.Session, error) {
+	segment, end := d.startSegment(ctx, "GetSessionsByOrgID")
+	defer end()
+
+	result, err := d.db.GetSessionsByOrgID(ctx, orgID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return result, err
+}
+
+// CountActiveOrgSessions counts an organization's active sessions
+func (d *DatabaseInstrumentation) CountActiveOrgSessions(ctx context.Context, orgID uuid.UUID) (int, error) {
+	segment, end := d.startSegment(ctx, "CountActiveOrgSessions")
+	defer end()
+
+	result, err := d.db.CountActiveOrgSessions(ctx, orgID)
+	if segment != nil {
+		segment.Collection = "sessions"
+	}
+	return result, err
+}
+
+// RecordOrgAuditEvent appends to an organization's audit log
+func (d *DatabaseInstrumentation) RecordOrgAuditEvent(ctx context.Context, e *database.OrgAuditEvent) error {
+	segment, end := d.startSegment(ctx, "RecordOrgAuditEvent")
+	defer end()
+
+	err := d.db.RecordOrgAuditEvent(ctx, e)
+	if segment != nil {
+		segment.Collection = "organization_audit_events"
+	}
+	return err
+}
+
+// GetOrgAuditEvents lists an organization's audit log
+func (d *DatabaseInstrumentation) GetOrgAuditEvents(ctx context.Context, orgID uuid.UUID, limit int) ([]*database.OrgAuditEvent, error) {
+	segment, end := d.startSegment(ctx, "GetOrgAuditEvents")
+	defer end()
+
+	result, err := d.db.GetOrgAuditEvents(ctx, orgID, limit)
+	if segment != nil {
+		segment.Collection = "organization_audit_events"
+	}
+	return result, err
+}
+
+
+// Usage methods
+
+// RollupUsage recomputes daily usage rollups
+func (d *DatabaseInstrumentation) RollupUsage(ctx context.Context, from, to time.Time) error {
+	segment, end := d.startSegment(ctx, "RollupUsage")
+	defer end()
+
+	err := d.db.RollupUsage(ctx, from, to)
+	if segment != nil {
+		segment.Collection = "usage_daily"
+	}
+	return err
+}
+
+// UsageRolledUpTo gets the end of the last usage rollup
+func (d *DatabaseInstrumentation) UsageRolledUpTo(ctx context.Context) (sql.NullTime, error) {
+	segment, end := d.startSegment(ctx, "UsageRolledUpTo")
+	defer end()
+
+	result, err := d.db.UsageRolledUpTo(ctx)
+	if segment != nil {
+		segment.Collection = "usage_rollup_state"
+	}
+	return result, err
+}
+
+// GetUsage gets daily usage rows
+func (d *DatabaseInstrumentation) GetUsage(ctx context.Context, filter database.UsageFilter) ([]*database.UsageRecord, error) {
+	segment, end := d.startSegment(ctx, "GetUsage")
+	defer end()
+
+	result, err := d.db.GetUsage(ctx, filter)
+	if segment != nil {
+		segment.Collection = "usage_daily"
+	}
+	return result, err
+}
+
+// IsUserAdmin checks whether a user is an admin
+func (d *DatabaseInstrumentation) IsUserAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	segment, end := d.startSegment(ctx, "IsUserAdmin")
+	defer end()
+
+	result, err := d.db.IsUserAdmin(ctx, userID)
+	if segment != nil {
+		segment.Collection = "users"
+	}
+	return result, err
+}
+
+// Webhook methods
+
+// CreateWebhookEndpoint registers a webhook endpoint
+func (d *DatabaseInstrumentation) CreateWebhookEndpoint(ctx context.Context, e *database.WebhookEndpoint) error {
+	segment, end := d.startSegment(ctx, "CreateWebhookEndpoint")
+	defer end()
+
+	err := d.db.CreateWebhookEndpoint(ctx, e)
+	if segment != nil {
+		segment.Collection = "webhook_endpoints"
+	}
+	return err
+}
+
+// GetWebhookEndpoints lists a user's webhook endpoints
+func (d *DatabaseInstrumentation) GetWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]*database.WebhookEndpoint, error) {
+	segment, end := d.startSegment(ctx, "GetWebhookEndpoints")
+	defer end()
+
+	result, err := d.db.GetWebhookEndpoints(ctx, userID)
+	if segment != nil {
+		segment.Collection = "webhook_endpoints"
+	}
+	return result, err
+}
+
+// GetWebhookEndpoint gets a webhook endpoint
+func (d *DatabaseInstrumentation) GetWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.WebhookEndpoint, error) {
+	segment, end := d.startSegment(ctx, "GetWebhookEndpoint")
+	defer end()
+
+	result, err := d.db.GetWebhookEndpoint(ctx, id, userID)
+	if segment != nil {
+		segment.Collection = "webhook_endpoints"
+	}
+	return result, err
+}
+
+// DeleteWebhookEndpoint removes a webhook endpoint
+func (d *DatabaseInstrumentation) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	segment, end := d.startSegment(ctx, "DeleteWebhookEndpoint")
+	defer end()
+
+	err := d.db.DeleteWebhookEndpoint(ctx, id, userID)
+	if segment != nil {
+		segment.Collection = "webhook_endpoints"
+	}
+	return err
+}
+
+// EnqueueWebhookEvent queues webhook deliveries for an event
+func (d *DatabaseInstrumentation) EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, event string, payload []byte) (int64, error) {
+	segment, end := d.startSegment(ctx, "EnqueueWebhookEvent")
+	defer end()
+
+	result, err := d.db.EnqueueWebhookEvent(ctx, userID, event, payload)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return result, err
+}
+
+// GetWebhookDeliveries lists deliveries to an endpoint
+func (d *DatabaseInstrumentation) GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*database.WebhookDelivery, error) {
+	segment, end := d.startSegment(ctx, "GetWebhookDeliveries")
+	defer end()
+
+	result, err := d.db.GetWebhookDeliveries(ctx, endpointID, limit)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return result, err
+}
+
+// ReplayWebhookDelivery queues a copy of a delivery
+func (d *DatabaseInstrumentation) ReplayWebhookDelivery(ctx context.Context, endpointID uuid.UUID, deliveryID uuid.UUID) (*database.WebhookDelivery, error) {
+	segment, end := d.startSegment(ctx, "ReplayWebhookDelivery")
+	defer end()
+
+	result, err := d.db.ReplayWebhookDelivery(ctx, endpointID, deliveryID)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return result, err
+}
+
+// ClaimWebhookDeliveries claims due deliveries for sending
+func (d *DatabaseInstrumentation) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*database.WebhookDelivery, error) {
+	segment, end := d.startSegment(ctx, "ClaimWebhookDeliveries")
+	defer end()
+
+	result, err := d.db.ClaimWebhookDeliveries(ctx, limit, lease)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return result, err
+}
+
+// CompleteWebhookDelivery records a delivery attempt
+func (d *DatabaseInstrumentation) CompleteWebhookDelivery(ctx context.Context, delivery *database.WebhookDelivery) error {
+	segment, end := d.startSegment(ctx, "CompleteWebhookDelivery")
+	defer end()
+
+	err := d.db.CompleteWebhookDelivery(ctx, delivery)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return err
+}
+
+// PurgeWebhookDeliveries removes finished deliveries past their retention
+func (d *DatabaseInstrumentation) PurgeWebhookDeliveries(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	segment, end := d.startSegment(ctx, "PurgeWebhookDeliveries")
+	defer end()
+
+	purged, err := d.db.PurgeWebhookDeliveries(ctx, finishedBefore)
+	if segment != nil {
+		segment.Collection = "webhook_deliveries"
+	}
+	return purged, err
+}
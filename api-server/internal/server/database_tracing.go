@@ -0,0 +1,526 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"api-server/internal/database"
+	"api-server/internal/logging"
+	"api-server/internal/tracing"
+)
+
+// dbLogger logs database calls, so LOG_LEVELS can enable them separately
+var dbLogger = logging.For("database")
+
+// DatabaseTracing wraps a database.Service to record an OpenTelemetry span
+// for every call
+type DatabaseTracing struct {
+	db database.Service
+}
+
+// NewDatabaseTracing wraps db with OpenTelemetry tracing
+func NewDatabaseTracing(db database.Service) database.Service {
+	return &DatabaseTracing{db: db}
+}
+
+// startDatabaseSpan starts a client span for a database.Service call, tagged
+// with the request ID, and returns a function ending it with the call's error.
+// Calls are logged at debug level.
+func startDatabaseSpan(ctx context.Context, operation, collection string) (context.Context, func(error)) {
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)}
+	if collection != "" {
+		attrs = append(attrs, semconv.DBCollectionName(collection))
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		attrs = append(attrs, attribute.String("request.id", id))
+	}
+
+	started := time.Now()
+	ctx, span := tracing.Tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		dbLogger.DebugContext(ctx, "database call", "operation", operation, "duration_ms", time.Since(started).Milliseconds(), "error", err)
+		tracing.End(span, err)
+	}
+}
+
+// DB returns the underlying sql.DB connection
+func (d *DatabaseTracing) DB() *sql.DB {
+	return d.db.DB()
+}
+
+// Health returns a map of health status information
+func (d *DatabaseTracing) Health() map[string]string {
+	// Not traced, as health checks would flood the traces
+	return d.db.Health()
+}
+
+// Close closes the database connection
+func (d *DatabaseTracing) Close() error {
+	return d.db.Close()
+}
+
+// SchemaVersion traces the wrapped SchemaVersion
+func (d *DatabaseTracing) SchemaVersion(ctx context.Context) (int, bool, error) {
+	ctx, end := startDatabaseSpan(ctx, "SchemaVersion", "schema_migrations")
+	version, dirty, err := d.db.SchemaVersion(ctx)
+	end(err)
+	return version, dirty, err
+}
+
+// User methods
+
+// CreateUser traces the wrapped CreateUser
+func (d *DatabaseTracing) CreateUser(ctx context.Context, u *database.User) (uuid.UUID, error) {
+	ctx, end := startDatabaseSpan(ctx, "CreateUser", "users")
+	id, err := d.db.CreateUser(ctx, u)
+	end(err)
+	return id, err
+}
+
+// GetUserByEmail traces the wrapped GetUserByEmail
+func (d *DatabaseTracing) GetUserByEmail(ctx context.Context, email string) (*database.User, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetUserByEmail", "users")
+	user, err := d.db.GetUserByEmail(ctx, email)
+	end(err)
+	return user, err
+}
+
+// ListUsers traces the wrapped ListUsers
+func (d *DatabaseTracing) ListUsers(ctx context.Context) ([]*database.User, error) {
+	ctx, end := startDatabaseSpan(ctx, "ListUsers", "users")
+	users, err := d.db.ListUsers(ctx)
+	end(err)
+	return users, err
+}
+
+// DisableUser traces the wrapped DisableUser
+func (d *DatabaseTracing) DisableUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	ctx, end := startDatabaseSpan(ctx, "DisableUser", "users")
+	user, err := d.db.DisableUser(ctx, id)
+	end(err)
+	return user, err
+}
+
+// IsUserDisabled traces the wrapped IsUserDisabled
+func (d *DatabaseTracing) IsUserDisabled(ctx context.Context, id uuid.UUID) (bool, error) {
+	ctx, end := startDatabaseSpan(ctx, "IsUserDisabled", "users")
+	disabled, err := d.db.IsUserDisabled(ctx, id)
+	end(err)
+	return disabled, err
+}
+
+// Session methods
+
+// CreateSession traces the wrapped CreateSession
+func (d *DatabaseTracing) CreateSession(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "CreateSession", "sessions")
+	session, err := d.db.CreateSession(ctx, userID, name, browserID, browserType, cdpURL, headless, viewportW, viewportH, userAgent)
+	end(err)
+	return session, err
+}
+
+// CreateSessionWithOptions traces the wrapped CreateSessionWithOptions
+func (d *DatabaseTracing) CreateSessionWithOptions(ctx context.Context, userID uuid.UUID, name string, browserID, browserType, cdpURL string, headless bool, viewportW, viewportH int, userAgent *string, opts database.SessionOptions) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "CreateSessionWithOptions", "sessions")
+	session, err := d.db.CreateSessionWithOptions(ctx, userID, name, browserID, browserType, cdpURL, headless, viewportW, viewportH, userAgent, opts)
+	end(err)
+	return session, err
+}
+
+// GetSessionsByUserID traces the wrapped GetSessionsByUserID
+func (d *DatabaseTracing) GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionsByUserID", "sessions")
+	sessions, err := d.db.GetSessionsByUserID(ctx, userID)
+	end(err)
+	return sessions, err
+}
+
+// ListSessions traces the wrapped ListSessions
+func (d *DatabaseTracing) ListSessions(ctx context.Context, filter database.SessionFilter) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "ListSessions", "sessions")
+	sessions, err := d.db.ListSessions(ctx, filter)
+	end(err)
+	return sessions, err
+}
+
+// StreamSessions traces the wrapped StreamSessions
+func (d *DatabaseTracing) StreamSessions(ctx context.Context, filter database.SessionFilter, fn func(*database.Session) error) error {
+	ctx, end := startDatabaseSpan(ctx, "StreamSessions", "sessions")
+	err := d.db.StreamSessions(ctx, filter, fn)
+	end(err)
+	return err
+}
+
+// GetSessionByID traces the wrapped GetSessionByID
+func (d *DatabaseTracing) GetSessionByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionByID", "sessions")
+	session, err := d.db.GetSessionByID(ctx, id, userID)
+	end(err)
+	return session, err
+}
+
+// StopSession traces the wrapped StopSession
+func (d *DatabaseTracing) StopSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "StopSession", "sessions")
+	session, err := d.db.StopSession(ctx, id, userID)
+	end(err)
+	return session, err
+}
+
+// UpdateSessionEmulation traces the wrapped UpdateSessionEmulation
+func (d *DatabaseTracing) UpdateSessionEmulation(ctx context.Context, id uuid.UUID, userID uuid.UUID, emulation database.SessionEmulation) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "UpdateSessionEmulation", "sessions")
+	session, err := d.db.UpdateSessionEmulation(ctx, id, userID, emulation)
+	end(err)
+	return session, err
+}
+
+// DeleteSession traces the wrapped DeleteSession
+func (d *DatabaseTracing) DeleteSession(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	ctx, end := startDatabaseSpan(ctx, "DeleteSession", "sessions")
+	err := d.db.DeleteSession(ctx, id, userID)
+	end(err)
+	return err
+}
+
+// PurgeArchivedSessions traces the wrapped PurgeArchivedSessions
+func (d *DatabaseTracing) PurgeArchivedSessions(ctx context.Context, archivedBefore time.Time) (int64, error) {
+	ctx, end := startDatabaseSpan(ctx, "PurgeArchivedSessions", "sessions")
+	n, err := d.db.PurgeArchivedSessions(ctx, archivedBefore)
+	end(err)
+	return n, err
+}
+
+// ExpireSessions traces the wrapped ExpireSessions
+func (d *DatabaseTracing) ExpireSessions(ctx context.Context) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "ExpireSessions", "sessions")
+	sessions, err := d.db.ExpireSessions(ctx)
+	end(err)
+	return sessions, err
+}
+
+// CompletePendingSession traces the wrapped CompletePendingSession
+func (d *DatabaseTracing) CompletePendingSession(ctx context.Context, id uuid.UUID, launch database.SessionLaunch) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "CompletePendingSession", "sessions")
+	session, err := d.db.CompletePendingSession(ctx, id, launch)
+	end(err)
+	return session, err
+}
+
+// FailPendingSession traces the wrapped FailPendingSession
+func (d *DatabaseTracing) FailPendingSession(ctx context.Context, id uuid.UUID, reason string) (*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "FailPendingSession", "sessions")
+	session, err := d.db.FailPendingSession(ctx, id, reason)
+	end(err)
+	return session, err
+}
+
+// FailStalePendingSessions traces the wrapped FailStalePendingSessions
+func (d *DatabaseTracing) FailStalePendingSessions(ctx context.Context, startedBefore time.Time, reason string) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "FailStalePendingSessions", "sessions")
+	sessions, err := d.db.FailStalePendingSessions(ctx, startedBefore, reason)
+	end(err)
+	return sessions, err
+}
+
+// CountActiveSessionsByBrowserType traces the wrapped CountActiveSessionsByBrowserType
+func (d *DatabaseTracing) CountActiveSessionsByBrowserType(ctx context.Context) (map[string]int, error) {
+	ctx, end := startDatabaseSpan(ctx, "CountActiveSessionsByBrowserType", "sessions")
+	counts, err := d.db.CountActiveSessionsByBrowserType(ctx)
+	end(err)
+	return counts, err
+}
+
+// ListInstanceSessions traces the wrapped ListInstanceSessions
+func (d *DatabaseTracing) ListInstanceSessions(ctx context.Context, instanceID string) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "ListInstanceSessions", "sessions")
+	sessions, err := d.db.ListInstanceSessions(ctx, instanceID)
+	end(err)
+	return sessions, err
+}
+
+// ListActiveSessions traces the wrapped ListActiveSessions
+func (d *DatabaseTracing) ListActiveSessions(ctx context.Context) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "ListActiveSessions", "sessions")
+	sessions, err := d.db.ListActiveSessions(ctx)
+	end(err)
+	return sessions, err
+}
+
+// ReleaseInstanceSessions traces the wrapped ReleaseInstanceSessions
+func (d *DatabaseTracing) ReleaseInstanceSessions(ctx context.Context, instanceID string) (int64, error) {
+	ctx, end := startDatabaseSpan(ctx, "ReleaseInstanceSessions", "sessions")
+	released, err := d.db.ReleaseInstanceSessions(ctx, instanceID)
+	end(err)
+	return released, err
+}
+
+// AdoptOrphanedSessions traces the wrapped AdoptOrphanedSessions
+func (d *DatabaseTracing) AdoptOrphanedSessions(ctx context.Context, instanceID string) (int64, error) {
+	ctx, end := startDatabaseSpan(ctx, "AdoptOrphanedSessions", "sessions")
+	adopted, err := d.db.AdoptOrphanedSessions(ctx, instanceID)
+	end(err)
+	return adopted, err
+}
+
+// Sharing methods
+
+// GetSessionAccess traces the wrapped GetSessionAccess
+func (d *DatabaseTracing) GetSessionAccess(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.Session, database.AccessLevel, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionAccess", "sessions")
+	session, access, err := d.db.GetSessionAccess(ctx, id, userID)
+	end(err)
+	return session, access, err
+}
+
+// GetSessionsSharedWithUser traces the wrapped GetSessionsSharedWithUser
+func (d *DatabaseTracing) GetSessionsSharedWithUser(ctx context.Context, userID uuid.UUID) ([]*database.SharedSession, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionsSharedWithUser", "sessions")
+	shared, err := d.db.GetSessionsSharedWithUser(ctx, userID)
+	end(err)
+	return shared, err
+}
+
+// CreateSessionShare traces the wrapped CreateSessionShare
+func (d *DatabaseTracing) CreateSessionShare(ctx context.Context, share *database.SessionShare) error {
+	ctx, end := startDatabaseSpan(ctx, "CreateSessionShare", "session_shares")
+	err := d.db.CreateSessionShare(ctx, share)
+	end(err)
+	return err
+}
+
+// GetSessionShares traces the wrapped GetSessionShares
+func (d *DatabaseTracing) GetSessionShares(ctx context.Context, sessionID uuid.UUID) ([]*database.SessionShare, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionShares", "session_shares")
+	shares, err := d.db.GetSessionShares(ctx, sessionID)
+	end(err)
+	return shares, err
+}
+
+// RevokeSessionShare traces the wrapped RevokeSessionShare
+func (d *DatabaseTracing) RevokeSessionShare(ctx context.Context, sessionID uuid.UUID, shareID uuid.UUID) error {
+	ctx, end := startDatabaseSpan(ctx, "RevokeSessionShare", "session_shares")
+	err := d.db.RevokeSessionShare(ctx, sessionID, shareID)
+	end(err)
+	return err
+}
+
+// Organization methods
+
+// CreateOrganization traces the wrapped CreateOrganization
+func (d *DatabaseTracing) CreateOrganization(ctx context.Context, org *database.Organization, ownerID uuid.UUID) error {
+	ctx, end := startDatabaseSpan(ctx, "CreateOrganization", "organizations")
+	err := d.db.CreateOrganization(ctx, org, ownerID)
+	end(err)
+	return err
+}
+
+// GetOrganizationForUser traces the wrapped GetOrganizationForUser
+func (d *DatabaseTracing) GetOrganizationForUser(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) (*database.Organization, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetOrganizationForUser", "organizations")
+	org, err := d.db.GetOrganizationForUser(ctx, orgID, userID)
+	end(err)
+	return org, err
+}
+
+// GetOrganizationsByUserID traces the wrapped GetOrganizationsByUserID
+func (d *DatabaseTracing) GetOrganizationsByUserID(ctx context.Context, userID uuid.UUID) ([]*database.Organization, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetOrganizationsByUserID", "organizations")
+	orgs, err := d.db.GetOrganizationsByUserID(ctx, userID)
+	end(err)
+	return orgs, err
+}
+
+// UpdateOrganization traces the wrapped UpdateOrganization
+func (d *DatabaseTracing) UpdateOrganization(ctx context.Context, org *database.Organization) error {
+	ctx, end := startDatabaseSpan(ctx, "UpdateOrganization", "organizations")
+	err := d.db.UpdateOrganization(ctx, org)
+	end(err)
+	return err
+}
+
+// GetOrganizationMembers traces the wrapped GetOrganizationMembers
+func (d *DatabaseTracing) GetOrganizationMembers(ctx context.Context, orgID uuid.UUID) ([]*database.OrganizationMember, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetOrganizationMembers", "organization_members")
+	members, err := d.db.GetOrganizationMembers(ctx, orgID)
+	end(err)
+	return members, err
+}
+
+// AddOrganizationMember traces the wrapped AddOrganizationMember
+func (d *DatabaseTracing) AddOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role database.OrgRole) error {
+	ctx, end := startDatabaseSpan(ctx, "AddOrganizationMember", "organization_members")
+	err := d.db.AddOrganizationMember(ctx, orgID, userID, role)
+	end(err)
+	return err
+}
+
+// UpdateOrganizationMemberRole traces the wrapped UpdateOrganizationMemberRole
+func (d *DatabaseTracing) UpdateOrganizationMemberRole(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, role database.OrgRole) error {
+	ctx, end := startDatabaseSpan(ctx, "UpdateOrganizationMemberRole", "organization_members")
+	err := d.db.UpdateOrganizationMemberRole(ctx, orgID, userID, role)
+	end(err)
+	return err
+}
+
+// RemoveOrganizationMember traces the wrapped RemoveOrganizationMember
+func (d *DatabaseTracing) RemoveOrganizationMember(ctx context.Context, orgID uuid.UUID, userID uuid.UUID) error {
+	ctx, end := startDatabaseSpan(ctx, "RemoveOrganizationMember", "organization_members")
+	err := d.db.RemoveOrganizationMember(ctx, orgID, userID)
+	end(err)
+	return err
+}
+
+// GetSessionsByOrgID traces the wrapped GetSessionsByOrgID
+func (d *DatabaseTracing) GetSessionsByOrgID(ctx context.Context, orgID uuid.UUID) ([]*database.Session, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetSessionsByOrgID", "sessions")
+	sessions, err := d.db.GetSessionsByOrgID(ctx, orgID)
+	end(err)
+	return sessions, err
+}
+
+// CountActiveOrgSessions traces the wrapped CountActiveOrgSessions
+func (d *DatabaseTracing) CountActiveOrgSessions(ctx context.Context, orgID uuid.UUID) (int, error) {
+	ctx, end := startDatabaseSpan(ctx, "CountActiveOrgSessions", "sessions")
+	count, err := d.db.CountActiveOrgSessions(ctx, orgID)
+	end(err)
+	return count, err
+}
+
+// RecordOrgAuditEvent traces the wrapped RecordOrgAuditEvent
+func (d *DatabaseTracing) RecordOrgAuditEvent(ctx context.Context, e *database.OrgAuditEvent) error {
+	ctx, end := startDatabaseSpan(ctx, "RecordOrgAuditEvent", "organization_audit_events")
+	err := d.db.RecordOrgAuditEvent(ctx, e)
+	end(err)
+	return err
+}
+
+// GetOrgAuditEvents traces the wrapped GetOrgAuditEvents
+func (d *DatabaseTracing) GetOrgAuditEvents(ctx context.Context, orgID uuid.UUID, limit int) ([]*database.OrgAuditEvent, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetOrgAuditEvents", "organization_audit_events")
+	events, err := d.db.GetOrgAuditEvents(ctx, orgID, limit)
+	end(err)
+	return events, err
+}
+
+// Usage methods
+
+// RollupUsage traces the wrapped RollupUsage
+func (d *DatabaseTracing) RollupUsage(ctx context.Context, from, to time.Time) error {
+	ctx, end := startDatabaseSpan(ctx, "RollupUsage", "usage_daily")
+	err := d.db.RollupUsage(ctx, from, to)
+	end(err)
+	return err
+}
+
+// UsageRolledUpTo traces the wrapped UsageRolledUpTo
+func (d *DatabaseTracing) UsageRolledUpTo(ctx context.Context) (sql.NullTime, error) {
+	ctx, end := startDatabaseSpan(ctx, "UsageRolledUpTo", "usage_rollup_state")
+	t, err := d.db.UsageRolledUpTo(ctx)
+	end(err)
+	return t, err
+}
+
+// GetUsage traces the wrapped GetUsage
+func (d *DatabaseTracing) GetUsage(ctx context.Context, filter database.UsageFilter) ([]*database.UsageRecord, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetUsage", "usage_daily")
+	records, err := d.db.GetUsage(ctx, filter)
+	end(err)
+	return records, err
+}
+
+// IsUserAdmin traces the wrapped IsUserAdmin
+func (d *DatabaseTracing) IsUserAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	ctx, end := startDatabaseSpan(ctx, "IsUserAdmin", "users")
+	ok, err := d.db.IsUserAdmin(ctx, userID)
+	end(err)
+	return ok, err
+}
+
+// Webhook methods
+
+// CreateWebhookEndpoint traces the wrapped CreateWebhookEndpoint
+func (d *DatabaseTracing) CreateWebhookEndpoint(ctx context.Context, e *database.WebhookEndpoint) error {
+	ctx, end := startDatabaseSpan(ctx, "CreateWebhookEndpoint", "webhook_endpoints")
+	err := d.db.CreateWebhookEndpoint(ctx, e)
+	end(err)
+	return err
+}
+
+// GetWebhookEndpoints traces the wrapped GetWebhookEndpoints
+func (d *DatabaseTracing) GetWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]*database.WebhookEndpoint, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetWebhookEndpoints", "webhook_endpoints")
+	endpoints, err := d.db.GetWebhookEndpoints(ctx, userID)
+	end(err)
+	return endpoints, err
+}
+
+// GetWebhookEndpoint traces the wrapped GetWebhookEndpoint
+func (d *DatabaseTracing) GetWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*database.WebhookEndpoint, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetWebhookEndpoint", "webhook_endpoints")
+	endpoint, err := d.db.GetWebhookEndpoint(ctx, id, userID)
+	end(err)
+	return endpoint, err
+}
+
+// DeleteWebhookEndpoint traces the wrapped DeleteWebhookEndpoint
+func (d *DatabaseTracing) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	ctx, end := startDatabaseSpan(ctx, "DeleteWebhookEndpoint", "webhook_endpoints")
+	err := d.db.DeleteWebhookEndpoint(ctx, id, userID)
+	end(err)
+	return err
+}
+
+// EnqueueWebhookEvent traces the wrapped EnqueueWebhookEvent
+func (d *DatabaseTracing) EnqueueWebhookEvent(ctx context.Context, userID uuid.UUID, event string, payload []byte) (int64, error) {
+	ctx, end := startDatabaseSpan(ctx, "EnqueueWebhookEvent", "webhook_deliveries")
+	n, err := d.db.EnqueueWebhookEvent(ctx, userID, event, payload)
+	end(err)
+	return n, err
+}
+
+// GetWebhookDeliveries traces the wrapped GetWebhookDeliveries
+func (d *DatabaseTracing) GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, limit int) ([]*database.WebhookDelivery, error) {
+	ctx, end := startDatabaseSpan(ctx, "GetWebhookDeliveries", "webhook_deliveries")
+	deliveries, err := d.db.GetWebhookDeliveries(ctx, endpointID, limit)
+	end(err)
+	return deliveries, err
+}
+
+// ReplayWebhookDelivery traces the wrapped ReplayWebhookDelivery
+func (d *DatabaseTracing) ReplayWebhookDelivery(ctx context.Context, endpointID uuid.UUID, deliveryID uuid.UUID) (*database.WebhookDelivery, error) {
+	ctx, end := startDatabaseSpan(ctx, "ReplayWebhookDelivery", "webhook_deliveries")
+	delivery, err := d.db.ReplayWebhookDelivery(ctx, endpointID, deliveryID)
+	end(err)
+	return delivery, err
+}
+
+// ClaimWebhookDeliveries traces the wrapped ClaimWebhookDeliveries
+func (d *DatabaseTracing) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*database.WebhookDelivery, error) {
+	ctx, end := startDatabaseSpan(ctx, "ClaimWebhookDeliveries", "webhook_deliveries")
+	deliveries, err := d.db.ClaimWebhookDeliveries(ctx, limit, lease)
+	end(err)
+	return deliveries, err
+}
+
+// CompleteWebhookDelivery traces the wrapped CompleteWebhookDelivery
+func (d *DatabaseTracing) CompleteWebhookDelivery(ctx context.Context, delivery *database.WebhookDelivery) error {
+	ctx, end := startDatabaseSpan(ctx, "CompleteWebhookDelivery", "webhook_deliveries")
+	err := d.db.CompleteWebhookDelivery(ctx, delivery)
+	end(err)
+	return err
+}
+
+// PurgeWebhookDeliveries traces the wrapped PurgeWebhookDeliveries
+func (d *DatabaseTracing) PurgeWebhookDeliveries(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	ctx, end := startDatabaseSpan(ctx, "PurgeWebhookDeliveries", "webhook_deliveries")
+	n, err := d.db.PurgeWebhookDeliveries(ctx, finishedBefore)
+	end(err)
+	return n, err
+}
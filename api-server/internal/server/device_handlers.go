@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+
+	"api-server/internal/browser"
+)
+
+// DevicesResponse lists the available device presets
+type DevicesResponse struct {
+	Devices []browser.Device `json:"devices"`
+}
+
+// ListDevicesHandler returns the built-in device presets usable with POST /sessions
+func (s *Server) ListDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, DevicesResponse{
+		Devices: browser.Devices(),
+	})
+}
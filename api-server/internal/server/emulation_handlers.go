@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"api-server/internal/browser"
+	"api-server/internal/database"
+)
+
+// toSessionEmulation converts browser emulation settings to their database form
+func toSessionEmulation(e *browser.Emulation) database.SessionEmulation {
+	if e == nil {
+		return database.SessionEmulation{}
+	}
+	emulation := database.SessionEmulation{
+		Locale:      e.Locale,
+		Timezone:    e.Timezone,
+		ColorScheme: e.ColorScheme,
+	}
+	if e.Geolocation != nil {
+		emulation.Geolocation = &database.SessionGeolocation{
+			Latitude:  e.Geolocation.Latitude,
+			Longitude: e.Geolocation.Longitude,
+			Accuracy:  e.Geolocation.Accuracy,
+		}
+	}
+	return emulation
+}
+
+// UpdateSessionEmulationHandler replaces the emulation overrides of a running
+// session. On Chromium they reach the page the browser server created, not
+// pages the client has opened over CDP.
+func (s *Server) UpdateSessionEmulationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var emulation browser.Emulation
+	if err := json.NewDecoder(r.Body).Decode(&emulation); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := emulation.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	session, access, err := s.db.GetSessionAccess(ctx, sessionID, userID)
+	if err != nil {
+		writeSessionAccessError(w, r, sessionID, err)
+		return
+	}
+	if !access.Allows(database.AccessControl) {
+		writeError(w, http.StatusForbidden, "Insufficient access to session")
+		return
+	}
+	if session.StoppedAt.Valid {
+		writeError(w, http.StatusConflict, "Session is not active")
+		return
+	}
+	// There is no browser to apply the overrides to yet
+	if waitingForLaunch(session) {
+		writeError(w, http.StatusConflict, "Session is still launching")
+		return
+	}
+
+	// Apply to the live browser first so the stored state never runs ahead of it
+	if _, err := s.browsers.NodeClient(session.BrowserNode).UpdateEmulation(ctx, session.BrowserID, emulation); err != nil {
+		logger.ErrorContext(ctx, "Failed to update emulation", "browser_id", session.BrowserID, "error", err)
+		writeBrowserError(w, err, http.StatusBadGateway, "Could not update browser emulation")
+		return
+	}
+
+	updated, err := s.db.UpdateSessionEmulation(ctx, sessionID, session.UserID, toSessionEmulation(&emulation))
+	if err != nil {
+		// The browser already has the new overrides; only recording them failed
+		logger.ErrorContext(ctx, "Failed to record emulation", "session_id", sessionID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not save session emulation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CreateSessionResponse{
+		Session: updated.ToView(),
+	})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-server/internal/database"
+)
+
+// exportFlushEvery is how many rows are written between flushes
+var exportFlushEvery = 100
+
+// sessionExportColumns is the CSV header of a session export
+var sessionExportColumns = []string{
+	"id", "name", "browser_type", "browser_id", "headless",
+	"viewport_width", "viewport_height", "user_agent", "device", "org_id",
+	"started_at", "stopped_at", "duration_seconds",
+}
+
+// csvCell neutralizes a value a spreadsheet would evaluate as a formula by
+// prefixing it with a quote
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// sessionExportRow converts a session to a CSV row matching
+// sessionExportColumns. User-controlled cells are escaped with csvCell.
+func sessionExportRow(session *database.Session) []string {
+	var stoppedAt, duration, orgID string
+	if session.StoppedAt.Valid {
+		stoppedAt = session.StoppedAt.Time.UTC().Format(time.RFC3339)
+		duration = strconv.FormatInt(int64(session.StoppedAt.Time.Sub(session.StartedAt).Seconds()), 10)
+	}
+	if session.OrgID.Valid {
+		orgID = session.OrgID.UUID.String()
+	}
+	return []string{
+		session.ID.String(),
+		csvCell(session.Name),
+		session.BrowserType,
+		session.BrowserID,
+		strconv.FormatBool(session.Headless),
+		strconv.Itoa(session.ViewportW),
+		strconv.Itoa(session.ViewportH),
+		csvCell(session.UserAgent.String),
+		session.Device,
+		orgID,
+		session.StartedAt.UTC().Format(time.RFC3339),
+		stoppedAt,
+		duration,
+	}
+}
+
+// sessionEncoder writes the sessions of an export. Output is buffered, so
+// callers must Flush at the end.
+type sessionEncoder interface {
+	Start() error
+	Encode(session *database.Session) error
+	Flush() error
+}
+
+type csvSessionEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvSessionEncoder) Start() error {
+	return e.w.Write(sessionExportColumns)
+}
+
+func (e *csvSessionEncoder) Encode(session *database.Session) error {
+	return e.w.Write(sessionExportRow(session))
+}
+
+func (e *csvSessionEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonSessionEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONSessionEncoder(w io.Writer) *ndjsonSessionEncoder {
+	bw := bufio.NewWriter(w)
+	return &ndjsonSessionEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (e *ndjsonSessionEncoder) Start() error {
+	return nil
+}
+
+func (e *ndjsonSessionEncoder) Encode(session *database.Session) error {
+	return e.enc.Encode(session.ToView())
+}
+
+func (e *ndjsonSessionEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// ExportSessionsHandler streams the caller's sessions as CSV or NDJSON. It
+// accepts the same filters as GET /sessions.
+func (s *Server) ExportSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseSessionFilter(r, userID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	// Nothing reaches the client until the encoder's buffer is first written
+	// out, so a query that fails up front still gets a proper error response
+	out := &trackingWriter{w: w}
+	var enc sessionEncoder
+	switch format {
+	case "csv":
+		enc = &csvSessionEncoder{w: csv.NewWriter(out)}
+	case "ndjson":
+		enc = newNDJSONSessionEncoder(out)
+	default:
+		writeError(w, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+	setExportHeaders(w, format)
+
+	rc := http.NewResponseController(w)
+	extendDeadline := func() {
+		if err := rc.SetWriteDeadline(time.Now().Add(s.exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.WarnContext(r.Context(), "Failed to extend export write deadline", "error", err)
+		}
+	}
+	extendDeadline()
+
+	written := 0
+	err = enc.Start()
+	if err == nil {
+		err = s.db.StreamSessions(r.Context(), filter, func(session *database.Session) error {
+			if err := enc.Encode(session); err != nil {
+				return err
+			}
+			written++
+			if written%exportFlushEvery == 0 {
+				if err := enc.Flush(); err != nil {
+					return err
+				}
+				_ = rc.Flush()
+				extendDeadline()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		if !out.wrote {
+			logger.ErrorContext(r.Context(), "Session export failed", "user_id", userID, "error", err)
+			w.Header().Del("Content-Disposition")
+			writeError(w, http.StatusInternalServerError, "Could not export sessions")
+			return
+		}
+		// The status line has already been sent; all we can do is stop
+		// writing so the client sees a truncated body
+		logger.ErrorContext(r.Context(), "Session export failed", "user_id", userID, "rows", written, "error", err)
+	}
+}
+
+// trackingWriter records whether anything has been written through it
+type trackingWriter struct {
+	w     io.Writer
+	wrote bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.wrote = true
+	return t.w.Write(p)
+}
+
+// setExportHeaders sets the content headers of a session export
+func setExportHeaders(w http.ResponseWriter, format string) {
+	contentType := "text/csv"
+	if format == "ndjson" {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sessions_%s.%s"`,
+		time.Now().UTC().Format("20060102T150405Z"), format))
+}
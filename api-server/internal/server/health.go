@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"api-server/internal/browser"
+	"api-server/internal/database"
+)
+
+// Dependency check statuses
+const (
+	checkUp   = "up"
+	checkDown = "down"
+)
+
+// dependencyCheck is the result of checking one dependency. The probes are
+// unauthenticated, so why a check failed is only logged.
+type dependencyCheck struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Details   any    `json:"details,omitempty"`
+}
+
+// checkFunc checks a dependency, returning details worth reporting
+type checkFunc func(ctx context.Context) (details any, err error)
+
+// StartDraining makes /readyz fail so load balancers stop sending new
+// requests before the server shuts down. Requests are still served.
+func (s *Server) StartDraining() {
+	if !s.draining.Swap(true) {
+		logger.Info("Draining: reporting not ready")
+	}
+}
+
+// checks returns the dependencies /readyz and /health check
+func (s *Server) checks() map[string]checkFunc {
+	return map[string]checkFunc{
+		"database":   s.checkDatabase,
+		"migrations": s.checkMigrations,
+		"browser":    s.checkBrowser,
+	}
+}
+
+// runChecks runs every check concurrently, each within healthCheckTimeout
+func (s *Server) runChecks(ctx context.Context) (map[string]dependencyCheck, bool) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]dependencyCheck)
+	healthy := true
+
+	for name, check := range s.checks() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, s.healthCheckTimeout)
+			defer cancel()
+
+			started := time.Now()
+			details, err := check(ctx)
+			result := dependencyCheck{Status: checkUp, LatencyMS: time.Since(started).Milliseconds(), Details: details}
+			if err != nil {
+				result.Status = checkDown
+				logger.WarnContext(ctx, "Health check failed", "check", name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			healthy = healthy && err == nil
+		}()
+	}
+	wg.Wait()
+	return results, healthy
+}
+
+// checkDatabase pings the database
+func (s *Server) checkDatabase(ctx context.Context) (any, error) {
+	if err := s.db.DB().PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("database unreachable: %w", err)
+	}
+	return nil, nil
+}
+
+// checkMigrations verifies the schema is at least at the version this build
+// expects and no migration failed part way through. A newer schema is fine,
+// as during a rolling deploy.
+func (s *Server) checkMigrations(ctx context.Context) (any, error) {
+	version, dirty, err := s.db.SchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	details := map[string]any{"version": version, "expected": database.LatestSchemaVersion, "dirty": dirty}
+	switch {
+	case dirty:
+		return details, fmt.Errorf("migration %d failed part way through", version)
+	case version < database.LatestSchemaVersion:
+		return details, fmt.Errorf("schema is at version %d, expected %d", version, database.LatestSchemaVersion)
+	}
+	return details, nil
+}
+
+// checkBrowser passes when at least one browser server node is healthy, and
+// reports how many are and how many nodes' circuit breakers are in each
+// state. It reads the node health kept by the background
+// health checks, only checking the nodes itself when those haven't run
+// lately. The fake backend always passes.
+func (s *Server) checkBrowser(ctx context.Context) (any, error) {
+	pool := s.browsers.Pool()
+	if pool == nil {
+		return map[string]string{"backend": s.browsers.Name()}, nil
+	}
+
+	nodes := pool.Nodes()
+	for _, node := range nodes {
+		if time.Since(node.CheckedAt) > 2*s.browserHealthInterval {
+			pool.Refresh(ctx)
+			nodes = pool.Nodes()
+			break
+		}
+	}
+
+	healthy := 0
+	breakers := map[string]int{browser.BreakerClosed: 0, browser.BreakerOpen: 0, browser.BreakerHalfOpen: 0}
+	for _, node := range nodes {
+		if node.Healthy {
+			healthy++
+		}
+		breakers[node.Breaker]++
+	}
+	details := map[string]any{"nodes": len(nodes), "healthy": healthy, "breakers": breakers}
+	if healthy == 0 {
+		return details, fmt.Errorf("none of %d browser server nodes is healthy", len(nodes))
+	}
+	return details, nil
+}
+
+// writeHealth writes a probe response, which isn't wrapped in an APIResponse
+// so probes can read it directly
+func writeHealth(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// livezHandler reports that the process is up and serving
+func (s *Server) livezHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyzHandler reports whether this instance should receive traffic: its
+// dependencies are up and it isn't draining for shutdown
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+
+	checks, healthy := s.runChecks(r.Context())
+	if !healthy {
+		writeHealth(w, http.StatusServiceUnavailable, map[string]any{"status": "not ready", "checks": checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, map[string]any{"status": "ready", "checks": checks})
+}
+
+// healthHandler reports the status and latency of every dependency, along
+// with the warm pool. It always answers 200; /readyz is the probe to act on.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := s.runChecks(r.Context())
+
+	status := "up"
+	switch {
+	case s.draining.Load():
+		status = "draining"
+	case !healthy:
+		status = "degraded"
+	}
+
+	health := map[string]any{
+		"status": status,
+		"checks": checks,
+	}
+	if s.warmPool != nil {
+		stats := s.warmPool.Stats()
+		// Launch errors can carry browser server addresses
+		for i := range stats {
+			stats[i].LastError = ""
+		}
+		health["warm_pool"] = stats
+	}
+	writeHealth(w, http.StatusOK, health)
+}
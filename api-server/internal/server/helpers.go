@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"api-server/internal/browser"
+	"api-server/internal/database"
+)
+
+// writeJSON writes data wrapped in an APIResponse with the given status code
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(database.APIResponse{
+		Error: "",
+		Data:  data,
+	})
+}
+
+// writeError writes msg wrapped in an APIResponse with the given status code
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(database.APIResponse{
+		Error: msg,
+		Data:  nil,
+	})
+}
+
+// capacityRetryAfter is the Retry-After sent when no browser capacity is
+// available and the browser backend gave no hint
+const capacityRetryAfter = 30 * time.Second
+
+// writeBrowserError maps a browser backend error to a response: 404 for
+// unknown sessions, 429 when out of capacity, 400 for rejected settings and
+// 503 when the backend is down. Other errors are written as status and msg.
+func writeBrowserError(w http.ResponseWriter, err error, status int, msg string) {
+	status, msg, retryAfter := browserErrorResponse(err, status, msg)
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	writeError(w, status, msg)
+}
+
+// browserErrorResponse returns the status, message and Retry-After (zero for
+// none) writeBrowserError responds to err with
+func browserErrorResponse(err error, status int, msg string) (int, string, time.Duration) {
+	retryAfter, hasRetryAfter := browser.RetryAfter(err)
+
+	var serverErr *browser.ServerError
+	switch {
+	case errors.Is(err, browser.ErrSessionNotFound):
+		status, msg = http.StatusNotFound, "Browser session not found"
+	case errors.Is(err, browser.ErrAtCapacity):
+		status, msg = http.StatusTooManyRequests, "No browser capacity available, try again later"
+		if !hasRetryAfter {
+			retryAfter, hasRetryAfter = capacityRetryAfter, true
+		}
+	case errors.Is(err, browser.ErrInvalidBrowserType), errors.Is(err, browser.ErrInvalidRequest):
+		status, msg = http.StatusBadRequest, err.Error()
+		if errors.As(err, &serverErr) {
+			msg = serverErr.Detail
+		}
+	case errors.Is(err, browser.ErrUnavailable):
+		status, msg = http.StatusServiceUnavailable, "Browser server unavailable, try again later"
+	default:
+		hasRetryAfter = false
+	}
+
+	if !hasRetryAfter {
+		retryAfter = 0
+	}
+	return status, msg, retryAfter
+}
+
+// parseUUIDParam reads a UUID from the named URL parameter
+func parseUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	raw := chi.URLParam(r, name)
+	if strings.TrimSpace(raw) == "" {
+		return uuid.Nil, errors.New(name + " is required")
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, errors.New("invalid " + name)
+	}
+	return id, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"api-server/internal/telemetry"
+)
+
+// StartBackgroundJobs starts the server's periodic jobs. They run until
+// StopBackgroundJobs is called.
+func (s *Server) StartBackgroundJobs() {
+	ctx := s.bgCtx
+
+	if s.metricsAddr != "" && s.metrics != nil {
+		s.goBackground(ctx, "metrics listener", s.serveMetrics)
+	}
+
+	if (s.sessionRetention > 0 || s.webhookRetention > 0) && s.sessionPurgeInterval > 0 {
+		s.goBackground(ctx, "purge", func(ctx context.Context) {
+			runEvery(ctx, s.sessionPurgeInterval, func(ctx context.Context) {
+				if s.sessionRetention > 0 {
+					s.purgeArchivedSessions(ctx)
+				}
+				if s.webhookRetention > 0 {
+					s.purgeWebhookDeliveries(ctx)
+				}
+			})
+		})
+	} else {
+		logger.Info("Purge disabled")
+	}
+
+	if pool := s.browsers.Pool(); pool != nil && s.browserHealthInterval > 0 {
+		s.goBackground(ctx, "browser health checks", func(ctx context.Context) {
+			runEvery(ctx, s.browserHealthInterval, pool.Refresh)
+		})
+	}
+
+	if s.warmPool != nil {
+		s.goBackground(ctx, "warm pool", s.warmPool.Run)
+		if s.telemetry != nil && s.telemetry.Name() != telemetry.ProviderNone {
+			s.goBackground(ctx, "warm pool metrics", func(ctx context.Context) {
+				runEvery(ctx, warmPoolMetricsInterval, s.recordWarmPoolMetrics)
+			})
+		}
+	}
+
+	if s.sessionExpiryInterval > 0 {
+		s.goBackground(ctx, "session expiry", func(ctx context.Context) {
+			runEvery(ctx, s.sessionExpiryInterval, func(ctx context.Context) {
+				s.expireSessions(ctx)
+				s.failStalePendingSessions(ctx)
+				s.adoptOrphanedSessions(ctx)
+			})
+		})
+	}
+
+	if s.webhookDispatchInterval > 0 {
+		s.goBackground(ctx, "webhook dispatch", func(ctx context.Context) {
+			runEvery(ctx, s.webhookDispatchInterval, s.dispatchWebhooks)
+		})
+	}
+
+	if s.usageRollupInterval > 0 {
+		s.goBackground(ctx, "usage rollup", func(ctx context.Context) {
+			runEvery(ctx, s.usageRollupInterval, s.rollupUsage)
+		})
+	}
+}
+
+// StopBackgroundJobs cancels the background jobs and session launches and
+// waits for them to return, or for ctx to expire
+func (s *Server) StopBackgroundJobs(ctx context.Context) error {
+	if s.bgCancel == nil {
+		return nil
+	}
+	s.bgCancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.bgWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// goBackground runs fn in a goroutine tracked by StopBackgroundJobs
+func (s *Server) goBackground(ctx context.Context, name string, fn func(ctx context.Context)) {
+	s.bgWG.Add(1)
+	go func() {
+		defer s.bgWG.Done()
+		logger.Info("Starting background job", "job", name)
+		fn(ctx)
+		logger.Info("Stopped background job", "job", name)
+	}()
+}
+
+// runEvery calls fn immediately and then on every tick until ctx is canceled
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeArchivedSessions permanently removes sessions archived longer ago than
+// the retention window and returns how many were removed
+func (s *Server) purgeArchivedSessions(ctx context.Context) (int64, error) {
+	purged, err := s.db.PurgeArchivedSessions(ctx, time.Now().Add(-s.sessionRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to purge archived sessions", "error", err)
+		}
+		return 0, err
+	}
+	if purged > 0 {
+		logger.InfoContext(ctx, "Purged archived sessions", "count", purged)
+	}
+	return purged, nil
+}
+
+// purgeWebhookDeliveries removes deliveries that finished longer ago than the
+// webhook retention window and returns how many were removed
+func (s *Server) purgeWebhookDeliveries(ctx context.Context) (int64, error) {
+	purged, err := s.db.PurgeWebhookDeliveries(ctx, time.Now().Add(-s.webhookRetention))
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to purge webhook deliveries", "error", err)
+		}
+		return 0, err
+	}
+	if purged > 0 {
+		logger.InfoContext(ctx, "Purged webhook deliveries", "count", purged)
+	}
+	return purged, nil
+}
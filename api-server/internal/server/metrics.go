@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"api-server/internal/browser"
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// metricsQueryTimeout bounds the database queries made for a scrape
+var metricsQueryTimeout = 5 * time.Second
+
+const metricsNamespace = "orchestrator"
+
+// serverMetrics are the Prometheus metrics of a Server
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	sessionsCreated *prometheus.CounterVec
+	sessionsStopped *prometheus.CounterVec
+	sessionsFailed  prometheus.Counter
+}
+
+// newServerMetrics creates the metrics of s and registers them, along with
+// the database pool, browser client, active session and warm pool metrics
+func newServerMetrics(s *Server) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests, by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		sessionsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_created_total",
+			Help:      "Sessions whose browser launched, by browser type.",
+		}, []string{"browser_type"}),
+		sessionsStopped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_stopped_total",
+			Help:      "Sessions stopped, by browser type and reason (stopped or expired).",
+		}, []string{"browser_type", "reason"}),
+		sessionsFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "sessions_failed_total",
+			Help:      "Session creations that failed.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.sessionsCreated,
+		m.sessionsStopped,
+		m.sessionsFailed,
+		&activeSessionsCollector{db: s.db},
+	)
+	m.registry.MustRegister(browser.Collectors()...)
+	if sqlDB := s.db.DB(); sqlDB != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, "postgres"))
+	}
+	if s.warmPool != nil {
+		m.registry.MustRegister(&warmPoolCollector{pool: s.warmPool})
+	}
+	return m
+}
+
+// MetricsMiddleware counts requests and measures their duration, labelled by
+// the route pattern that matched rather than the path, to bound cardinality
+func (s *Server) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.metrics.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		s.metrics.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(started).Seconds())
+	})
+}
+
+// recordSessionEvent counts a session lifecycle event
+func (m *serverMetrics) recordSessionEvent(event string, session *database.Session) {
+	if m == nil {
+		return
+	}
+
+	browserType := "unknown"
+	if session != nil {
+		browserType = session.BrowserType
+	}
+
+	switch event {
+	case webhook.EventSessionStarted:
+		m.sessionsCreated.WithLabelValues(browserType).Inc()
+	case webhook.EventSessionStopped:
+		m.sessionsStopped.WithLabelValues(browserType, "stopped").Inc()
+	case webhook.EventSessionExpired:
+		m.sessionsStopped.WithLabelValues(browserType, "expired").Inc()
+	case webhook.EventSessionFailed:
+		m.sessionsFailed.Inc()
+	}
+}
+
+// activeSessionsCollector reports the sessions currently active across all
+// instances, read from the database at scrape time
+type activeSessionsCollector struct {
+	db database.Service
+}
+
+var activeSessionsDesc = prometheus.NewDesc(
+	metricsNamespace+"_sessions_active",
+	"Sessions not yet stopped, by browser type.",
+	[]string{"browser_type"}, nil,
+)
+
+func (c *activeSessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (c *activeSessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsQueryTimeout)
+	defer cancel()
+
+	counts, err := c.db.CountActiveSessionsByBrowserType(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(activeSessionsDesc, err)
+		return
+	}
+	for browserType, count := range counts {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), browserType)
+	}
+}
+
+// warmPoolCollector reports the warm pool's unclaimed browsers and claims
+type warmPoolCollector struct {
+	pool *browser.WarmPool
+}
+
+var (
+	warmPoolUnclaimedDesc = prometheus.NewDesc(
+		metricsNamespace+"_warm_pool_unclaimed",
+		"Pre-launched browsers waiting to be claimed.",
+		[]string{"browser_type", "headless"}, nil,
+	)
+	warmPoolClaimedDesc = prometheus.NewDesc(
+		metricsNamespace+"_warm_pool_claimed_total",
+		"Pre-launched browsers claimed by new sessions.",
+		[]string{"browser_type", "headless"}, nil,
+	)
+)
+
+func (c *warmPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- warmPoolUnclaimedDesc
+	ch <- warmPoolClaimedDesc
+}
+
+func (c *warmPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range c.pool.Stats() {
+		headless := strconv.FormatBool(stats.Headless)
+		ch <- prometheus.MustNewConstMetric(warmPoolUnclaimedDesc, prometheus.GaugeValue, float64(stats.Unclaimed), stats.BrowserType, headless)
+		ch <- prometheus.MustNewConstMetric(warmPoolClaimedDesc, prometheus.CounterValue, float64(stats.Claimed), stats.BrowserType, headless)
+	}
+}
+
+// metricsHandler serves the metrics in Prometheus text format, requiring the
+// bearer token if one is configured
+func (s *Server) metricsHandler() http.Handler {
+	handler := promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+	if s.metricsToken == "" {
+		return handler
+	}
+
+	want := []byte("Bearer " + s.metricsToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serveMetrics serves /metrics on metricsAddr until ctx is canceled
+func (s *Server) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metricsHandler())
+	srv := &http.Server{
+		Addr:              s.metricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving metrics", "addr", s.metricsAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Metrics listener failed", "addr", s.metricsAddr, "error", err)
+	}
+}
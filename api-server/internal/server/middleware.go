@@ -1,7 +1,7 @@
 package server
 
 import (
-	"api-server/internal/auth"
+	"api-server/internal/database"
 	"context"
 	"errors"
 	"fmt"
@@ -15,7 +15,8 @@ type contextKey string
 
 const userIDContextKey contextKey = "userID"
 
-// AuthMiddleware ensures the request is authenticated with a valid JWT
+// AuthMiddleware ensures the request is authenticated with a valid JWT of a
+// user that exists and hasn't been disabled
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Get token from Authorization header
@@ -35,7 +36,7 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 		tokenString := parts[1]
 
 		// Validate the token
-		claims, err := auth.ValidateToken(tokenString)
+		claims, err := s.tokens.Validate(tokenString)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
 			return
@@ -48,6 +49,21 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Tokens outlive a disable, so the user is checked on every request
+		disabled, err := s.db.IsUserDisabled(r.Context(), userID)
+		switch {
+		case errors.Is(err, database.ErrUserNotFound):
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		case err != nil:
+			logger.ErrorContext(r.Context(), "Failed to check user", "user_id", userID, "error", err)
+			http.Error(w, "Could not verify user", http.StatusInternalServerError)
+			return
+		case disabled:
+			http.Error(w, "Account disabled", http.StatusForbidden)
+			return
+		}
+
 		// Add user ID to request context
 		ctx := context.WithValue(r.Context(), userIDContextKey, userID)
 
@@ -56,6 +72,25 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AdminMiddleware only lets admins through. It must run after AuthMiddleware.
+func (s *Server) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		isAdmin, err := s.db.IsUserAdmin(r.Context(), userID)
+		if err != nil || !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // GetUserIDFromContext extracts the userID from the request context
 // Returns an error if userID is not present (which should not happen if AuthMiddleware is used)
 func GetUserIDFromContext(ctx context.Context) (uuid.UUID, error) {
@@ -0,0 +1,460 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/database"
+)
+
+// OrganizationRequest creates or updates an organization
+type OrganizationRequest struct {
+	Name              string `json:"name"`
+	MaxActiveSessions *int64 `json:"max_active_sessions,omitempty"`
+}
+
+// AddMemberRequest adds a registered user to an organization
+type AddMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// UpdateMemberRequest changes a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type OrganizationResponse struct {
+	Organization *database.OrganizationView `json:"organization"`
+}
+
+type OrganizationsResponse struct {
+	Organizations []*database.OrganizationView `json:"organizations"`
+}
+
+type MembersResponse struct {
+	Members []*database.OrganizationMemberView `json:"members"`
+}
+
+type AuditEventsResponse struct {
+	Events []*database.OrgAuditEventView `json:"events"`
+}
+
+// validate checks the request and converts the quota to its column form
+func (req OrganizationRequest) validate() (sql.NullInt64, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return sql.NullInt64{}, errors.New("name is required")
+	}
+	if req.MaxActiveSessions == nil {
+		return sql.NullInt64{}, nil
+	}
+	if *req.MaxActiveSessions < 0 {
+		return sql.NullInt64{}, errors.New("max_active_sessions must not be negative")
+	}
+	return sql.NullInt64{Int64: *req.MaxActiveSessions, Valid: true}, nil
+}
+
+// auditOrg records an event in an organization's audit log. target and
+// session are uuid.Nil when the event has none. Failures are logged and don't
+// fail the request that caused the event.
+func (s *Server) auditOrg(ctx context.Context, orgID, actorID uuid.UUID, action string, target, session uuid.UUID, detail string) {
+	e := &database.OrgAuditEvent{
+		OrgID:        orgID,
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: uuid.NullUUID{UUID: target, Valid: target != uuid.Nil},
+		SessionID:    uuid.NullUUID{UUID: session, Valid: session != uuid.Nil},
+		Detail:       detail,
+	}
+	// Record the event even if the client has already gone away
+	if err := s.db.RecordOrgAuditEvent(context.WithoutCancel(ctx), e); err != nil {
+		logger.ErrorContext(ctx, "Failed to record organization audit event", "org_id", orgID, "action", action, "error", err)
+	}
+}
+
+// loadOrganization writes an error response and returns nil unless userID is a
+// member of the organization named by the orgID URL parameter
+func (s *Server) loadOrganization(w http.ResponseWriter, r *http.Request, userID uuid.UUID) *database.Organization {
+	orgID, err := parseUUIDParam(r, "orgID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	org, err := s.db.GetOrganizationForUser(r.Context(), orgID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrOrganizationNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "Could not retrieve organization")
+		return nil
+	}
+	return org
+}
+
+// CreateOrganizationHandler creates an organization owned by the caller
+func (s *Server) CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	quota, err := req.validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	org := &database.Organization{
+		Name:              strings.TrimSpace(req.Name),
+		MaxActiveSessions: quota,
+	}
+	if err := s.db.CreateOrganization(r.Context(), org, userID); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to create organization", "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not create organization")
+		return
+	}
+	s.auditOrg(r.Context(), org.ID, userID, database.AuditOrgCreated, uuid.Nil, uuid.Nil, org.Name)
+
+	writeJSON(w, http.StatusOK, OrganizationResponse{
+		Organization: org.ToView(),
+	})
+}
+
+// GetOrganizationsHandler lists the organizations the caller belongs to
+func (s *Server) GetOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := s.db.GetOrganizationsByUserID(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve organizations")
+		return
+	}
+
+	orgViews := make([]*database.OrganizationView, 0, len(orgs))
+	for _, org := range orgs {
+		orgViews = append(orgViews, org.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, OrganizationsResponse{
+		Organizations: orgViews,
+	})
+}
+
+// UpdateOrganizationHandler renames an organization and sets its session quota
+func (s *Server) UpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+	if org.Role != database.OrgRoleOwner {
+		writeError(w, http.StatusForbidden, "Only organization owners can update it")
+		return
+	}
+
+	var req OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	quota, err := req.validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	org.Name = strings.TrimSpace(req.Name)
+	org.MaxActiveSessions = quota
+	if err := s.db.UpdateOrganization(r.Context(), org); err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not update organization")
+		return
+	}
+	s.auditOrg(r.Context(), org.ID, userID, database.AuditOrgUpdated, uuid.Nil, uuid.Nil, org.Name)
+
+	writeJSON(w, http.StatusOK, OrganizationResponse{
+		Organization: org.ToView(),
+	})
+}
+
+// GetOrganizationMembersHandler lists the members of an organization
+func (s *Server) GetOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+
+	members, err := s.db.GetOrganizationMembers(r.Context(), org.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve members")
+		return
+	}
+
+	memberViews := make([]*database.OrganizationMemberView, 0, len(members))
+	for _, m := range members {
+		memberViews = append(memberViews, m.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, MembersResponse{
+		Members: memberViews,
+	})
+}
+
+// AddOrganizationMemberHandler adds a user to an organization. Existing
+// members' roles are changed with UpdateOrganizationMemberHandler.
+func (s *Server) AddOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+	if !org.Role.CanManageMembers() {
+		writeError(w, http.StatusForbidden, "Only organization owners and admins can manage members")
+		return
+	}
+
+	var req AddMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role := database.OrgRole(req.Role)
+	if req.Role == "" {
+		role = database.OrgRoleMember
+	}
+	if !role.Valid() {
+		writeError(w, http.StatusBadRequest, "role must be owner, admin or member")
+		return
+	}
+	// Admins can't hand out ownership
+	if role == database.OrgRoleOwner && org.Role != database.OrgRoleOwner {
+		writeError(w, http.StatusForbidden, "Only organization owners can add owners")
+		return
+	}
+
+	ctx := r.Context()
+	user, err := s.db.GetUserByEmail(ctx, strings.TrimSpace(req.Email))
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Could not look up user")
+		return
+	}
+
+	if err := s.db.AddOrganizationMember(ctx, org.ID, user.ID, role); err != nil {
+		if errors.Is(err, database.ErrMemberExists) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		logger.ErrorContext(ctx, "Failed to add organization member", "org_id", org.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not add member")
+		return
+	}
+	s.auditOrg(ctx, org.ID, userID, database.AuditMemberAdded, user.ID, uuid.Nil, string(role))
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// UpdateOrganizationMemberHandler changes a member's role. Only owners may
+// change roles, and the last owner can't be demoted.
+func (s *Server) UpdateOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+	if org.Role != database.OrgRoleOwner {
+		writeError(w, http.StatusForbidden, "Only organization owners can change roles")
+		return
+	}
+
+	memberID, err := parseUUIDParam(r, "userID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role := database.OrgRole(req.Role)
+	if !role.Valid() {
+		writeError(w, http.StatusBadRequest, "role must be owner, admin or member")
+		return
+	}
+
+	ctx := r.Context()
+	if err := s.db.UpdateOrganizationMemberRole(ctx, org.ID, memberID, role); err != nil {
+		switch {
+		case errors.Is(err, database.ErrMemberNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, database.ErrLastOwner):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			logger.ErrorContext(ctx, "Failed to change organization member role", "org_id", org.ID, "error", err)
+			writeError(w, http.StatusInternalServerError, "Could not change role")
+		}
+		return
+	}
+	s.auditOrg(ctx, org.ID, userID, database.AuditMemberRoleChanged, memberID, uuid.Nil, string(role))
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// RemoveOrganizationMemberHandler removes a user from an organization
+func (s *Server) RemoveOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+
+	memberID, err := parseUUIDParam(r, "userID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Members may leave; removing someone else requires owner or admin
+	if memberID != userID && !org.Role.CanManageMembers() {
+		writeError(w, http.StatusForbidden, "Only organization owners and admins can manage members")
+		return
+	}
+
+	// Owners can't be removed so an organization is never left without one
+	ctx := r.Context()
+	if target, err := s.db.GetOrganizationForUser(ctx, org.ID, memberID); err == nil && target.Role == database.OrgRoleOwner {
+		writeError(w, http.StatusBadRequest, "Organization owners cannot be removed")
+		return
+	}
+
+	if err := s.db.RemoveOrganizationMember(ctx, org.ID, memberID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.auditOrg(ctx, org.ID, userID, database.AuditMemberRemoved, memberID, uuid.Nil, "")
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// GetOrganizationSessionsHandler lists the sessions owned by an organization
+func (s *Server) GetOrganizationSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+
+	sessions, err := s.db.GetSessionsByOrgID(r.Context(), org.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve sessions")
+		return
+	}
+
+	sessionViews := make([]*database.SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		sessionViews = append(sessionViews, session.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, SessionsResponse{
+		Sessions: sessionViews,
+	})
+}
+
+// GetOrganizationAuditHandler returns an organization's audit log, newest
+// first, to its owners and admins. The limit query parameter defaults to 100
+// and is capped at 500.
+func (s *Server) GetOrganizationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	org := s.loadOrganization(w, r, userID)
+	if org == nil {
+		return
+	}
+	if !org.Role.CanManageMembers() {
+		writeError(w, http.StatusForbidden, "Only organization owners and admins can view the audit log")
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 500)
+	}
+
+	events, err := s.db.GetOrgAuditEvents(r.Context(), org.ID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve audit log")
+		return
+	}
+
+	views := make([]*database.OrgAuditEventView, 0, len(events))
+	for _, e := range events {
+		views = append(views, e.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, AuditEventsResponse{
+		Events: views,
+	})
+}
@@ -2,21 +2,25 @@ package server
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(RequestIDMiddleware)
+	r.Use(TracingMiddleware)
+	if s.metrics != nil {
+		r.Use(s.MetricsMiddleware)
+	}
+	r.Use(RequestLoggerMiddleware)
+	r.Use(RecoverMiddleware)
 
-	// Add New Relic middleware if available
-	if s.nrApp != nil {
-		r.Use(s.NewRelicMiddleware)
+	// Record a transaction per request with the telemetry provider
+	if s.telemetry != nil {
+		r.Use(s.telemetry.Middleware)
 	}
 
 	r.Use(cors.Handler(cors.Options{
@@ -30,6 +34,9 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// miscellaneous
 	r.Get("/", s.HelloWorldHandler)
 	r.Get("/health", s.healthHandler)
+	r.Get("/livez", s.livezHandler)
+	r.Get("/readyz", s.readyzHandler)
+	r.Get("/devices", s.ListDevicesHandler)
 
 	// public
 	r.Post("/register", s.RegisterHandler)
@@ -43,8 +50,47 @@ func (s *Server) RegisterRoutes() http.Handler {
 		// Session routes
 		r.Post("/sessions", s.CreateSessionHandler)
 		r.Get("/sessions", s.GetUserSessionsHandler)
+		r.Get("/sessions/shared", s.GetSharedSessionsHandler)
+		r.Get("/sessions/export", s.ExportSessionsHandler)
+		r.Get("/sessions/{id}", s.GetSessionHandler)
+		r.Get("/sessions/{id}/events", s.SessionEventsHandler)
 		r.Post("/sessions/{id}/stop", s.StopSessionHandler)
+		r.Put("/sessions/{id}/emulation", s.UpdateSessionEmulationHandler)
 		r.Delete("/sessions/{id}", s.DeleteSessionHandler)
+
+		// Sharing routes
+		r.Post("/sessions/{id}/shares", s.CreateSessionShareHandler)
+		r.Get("/sessions/{id}/shares", s.ListSessionSharesHandler)
+		r.Delete("/sessions/{id}/shares/{shareID}", s.RevokeSessionShareHandler)
+
+		// Organization routes
+		r.Post("/orgs", s.CreateOrganizationHandler)
+		r.Get("/orgs", s.GetOrganizationsHandler)
+		r.Put("/orgs/{orgID}", s.UpdateOrganizationHandler)
+		r.Get("/orgs/{orgID}/members", s.GetOrganizationMembersHandler)
+		r.Post("/orgs/{orgID}/members", s.AddOrganizationMemberHandler)
+		r.Put("/orgs/{orgID}/members/{userID}", s.UpdateOrganizationMemberHandler)
+		r.Delete("/orgs/{orgID}/members/{userID}", s.RemoveOrganizationMemberHandler)
+		r.Get("/orgs/{orgID}/sessions", s.GetOrganizationSessionsHandler)
+		r.Get("/orgs/{orgID}/audit", s.GetOrganizationAuditHandler)
+
+		// Webhook routes
+		r.Post("/webhooks", s.CreateWebhookHandler)
+		r.Get("/webhooks", s.ListWebhooksHandler)
+		r.Delete("/webhooks/{webhookID}", s.DeleteWebhookHandler)
+		r.Get("/webhooks/{webhookID}/deliveries", s.ListWebhookDeliveriesHandler)
+		r.Post("/webhooks/{webhookID}/deliveries/{deliveryID}/replay", s.ReplayWebhookDeliveryHandler)
+
+		// Usage routes
+		r.Get("/usage", s.GetUsageHandler)
+
+		// Admin routes
+		r.Group(func(r chi.Router) {
+			r.Use(s.AdminMiddleware)
+
+			r.Get("/admin/usage", s.GetAdminUsageHandler)
+			r.Get("/admin/browser-nodes", s.GetBrowserNodesHandler)
+		})
 	})
 
 	return r
@@ -56,13 +102,10 @@ func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		log.Fatalf("error handling JSON marshal. Err: %v", err)
+		logger.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
 	}
 
 	_, _ = w.Write(jsonResp)
 }
-
-func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	jsonResp, _ := json.Marshal(s.db.Health())
-	_, _ = w.Write(jsonResp)
-}
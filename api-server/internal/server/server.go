@@ -1,76 +1,157 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
-	"github.com/newrelic/go-agent/v3/newrelic"
-
+	"api-server/internal/auth"
+	"api-server/internal/browser"
+	"api-server/internal/config"
 	"api-server/internal/database"
+	"api-server/internal/secrets"
+	"api-server/internal/telemetry"
+	"api-server/internal/webhook"
 )
 
 type Server struct {
 	port int
 	db   database.Service
-	nrApp *newrelic.Application // New Relic application
+	// telemetry reports transactions and custom metrics to the configured
+	// APM backend
+	telemetry telemetry.Provider
+
+	// tokens issues and validates user tokens
+	tokens *auth.Tokens
+	// secrets encrypts the credentials stored in the database
+	secrets *secrets.Box
+	// browsers is the browser backend sessions are launched on
+	browsers *browser.Backend
+	// warmPool hands out pre-launched browsers, nil when none are kept warm
+	warmPool *browser.WarmPool
+
+	// Prometheus metrics, served by StartBackgroundJobs on METRICS_ADDR
+	metrics *serverMetrics
+
+	// instanceID identifies this instance as the owner of the sessions it
+	// creates; shutdownPolicy says what happens to them when it exits
+	instanceID     string
+	shutdownPolicy string
+
+	// draining is set by StartDraining once shutdown begins
+	draining atomic.Bool
+
+	// healthCheckTimeout bounds each dependency check made by /readyz and /health
+	healthCheckTimeout time.Duration
+	// exportWriteTimeout is extended on every flush so long exports aren't cut
+	// off by the server's WriteTimeout
+	exportWriteTimeout time.Duration
+
+	// Browser settings for sessions created without them
+	defaultBrowserType string
+	defaultHeadless    bool
+	defaultViewportW   int
+	defaultViewportH   int
+	defaultTimeout     int
+	// browserHealthInterval is how often the browser server nodes are checked
+	browserHealthInterval time.Duration
+	// warmPoolMaxIdle is how long a pre-launched browser may wait to be
+	// claimed before it is replaced
+	warmPoolMaxIdle time.Duration
+
+	// sessionRetention is how long archived sessions are kept before being
+	// purged. Zero or a negative value disables purging.
+	sessionRetention time.Duration
+	// sessionPurgeInterval is how often the purge job runs
+	sessionPurgeInterval time.Duration
+	// sessionExpiryInterval is how often expired sessions are looked for
+	sessionExpiryInterval time.Duration
+	// pendingSessionTimeout is how long a session may stay pending before it
+	// is failed, e.g. because the instance launching it exited
+	pendingSessionTimeout time.Duration
+	// asyncCreateSlots bounds how many browsers are launched in the background
+	// at once; further launches queue for a slot
+	asyncCreateSlots chan struct{}
+	// sessionUpdates wakes requests waiting on sessions this instance changes
+	sessionUpdates *sessionNotifier
+	// usageRollupInterval is how often session usage is rolled up into usage_daily
+	usageRollupInterval time.Duration
+
+	// webhookDispatchInterval is how often the dispatcher looks for due deliveries
+	webhookDispatchInterval time.Duration
+	// webhookTimeout bounds a single delivery request
+	webhookTimeout time.Duration
+	// webhookAllowPrivate lets endpoints point at private addresses, for
+	// local development
+	webhookAllowPrivate bool
+	webhookSender       *webhook.Sender
+	// webhookRetention is how long finished deliveries are kept before the
+	// purge job removes them. Zero or a negative value keeps them.
+	webhookRetention time.Duration
+
+	// metricsAddr is where /metrics is served, separately from the API. Empty
+	// disables the listener.
+	metricsAddr string
+	// metricsToken, when set, must be sent as a bearer token to read /metrics
+	metricsToken string
+
+	// bgCtx is canceled by StopBackgroundJobs, ending the jobs started by
+	// StartBackgroundJobs and the launches of asynchronous sessions
+	bgCtx    context.Context
+	bgCancel context.CancelFunc
+	bgWG     sync.WaitGroup
+
 	*http.Server
 }
 
 // NewServerFunc defines function type for server creation
 type NewServerFunc func() *http.Server
 
-// getEnvOrDefaultString gets environment string variables with default values
-func getEnvOrDefaultString(key, defaultVal string) string {
-	if val, exists := os.LookupEnv(key); exists && val != "" {
-		return val
-	}
-	return defaultVal
-}
-
-// NewServer creates a new HTTP server with the given database service
-func NewServer(db database.Service) (*Server, error) {
+// NewServer creates a new HTTP server with the given database service and
+// configuration
+func NewServer(db database.Service, cfg *config.Config) (*Server, error) {
 	if db == nil {
 		var err error
-		db, err = database.New()
+		db, err = database.New(cfg.Database)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize database for server: %w", err)
 		}
 	}
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	port := cfg.Server.Port
 
-	// Initialize New Relic
-	nrApp, err := newrelic.NewApplication(
-		newrelic.ConfigAppName(getEnvOrDefaultString("NEW_RELIC_APP_NAME", "Orchestrator API")),
-		newrelic.ConfigLicense("eu01xxe1e5cc9a5442065e9bc419758bFFFFNRAL"),
-		newrelic.ConfigDistributedTracerEnabled(true),
-		newrelic.ConfigAppLogForwardingEnabled(true),
-	)
+	browsers, err := browser.New(cfg.Browser)
+	if err != nil {
+		return nil, err
+	}
 
+	provider, err := newTelemetry(cfg.Telemetry)
 	if err != nil {
-		log.Printf("Warning: failed to initialize New Relic: %v", err)
-		// Decide if this should be a fatal error or just a warning
-		// For now, continuing without New Relic if it fails
-		nrApp = nil // Ensure nrApp is nil if initialization failed
+		return nil, err
 	}
 
-	// Wrap database service with New Relic instrumentation if available
-	if nrApp != nil {
-		db = &DatabaseInstrumentation{
-			db:    db,
-			nrApp: nrApp,
-		}
+	// Record an OpenTelemetry span for every database call
+	db = NewDatabaseTracing(db)
+	// and time it within the telemetry provider's transaction
+	db = NewDatabaseInstrumentation(db, provider)
+
+	s := newServer(db, cfg, browsers)
+	s.port = port
+	s.telemetry = provider
+	s.instanceID = cfg.Server.InstanceID
+	s.shutdownPolicy = cfg.Server.SessionPolicy
+	if s.instanceID == "" {
+		s.instanceID = defaultInstanceID()
 	}
+	logger.Info("Starting instance", "instance_id", s.instanceID, "shutdown_session_policy", s.shutdownPolicy)
 
-	s := &Server{
-		port:  port,
-		db:    db,
-		nrApp: nrApp,
+	s.warmPool, err = s.newWarmPool(cfg.Browser.WarmPool)
+	if err != nil {
+		return nil, err
 	}
+	s.metrics = newServerMetrics(s)
 
 	// Set up the HTTP server
 	s.Server = &http.Server{
@@ -83,3 +164,44 @@ func NewServer(db database.Service) (*Server, error) {
 
 	return s, nil
 }
+
+// newServer returns a Server working on db and browsers with the settings of
+// cfg, without the telemetry, warm pool and HTTP server NewServer adds
+func newServer(db database.Service, cfg *config.Config, browsers *browser.Backend) *Server {
+	s := &Server{
+		db:       db,
+		tokens:   auth.New(cfg.Auth),
+		secrets:  secrets.New(cfg.Auth.SecretsKey),
+		browsers: browsers,
+
+		healthCheckTimeout: cfg.Server.HealthCheckTimeout,
+		exportWriteTimeout: cfg.Server.ExportWriteTimeout,
+
+		defaultBrowserType:    cfg.Browser.DefaultType,
+		defaultHeadless:       cfg.Browser.DefaultHeadless,
+		defaultViewportW:      cfg.Browser.ViewportWidth,
+		defaultViewportH:      cfg.Browser.ViewportHeight,
+		defaultTimeout:        cfg.Browser.DefaultTimeout,
+		browserHealthInterval: cfg.Browser.HealthInterval,
+		warmPoolMaxIdle:       cfg.Browser.WarmPoolMaxIdle,
+
+		sessionRetention:      cfg.Sessions.Retention,
+		sessionPurgeInterval:  cfg.Sessions.PurgeInterval,
+		sessionExpiryInterval: cfg.Sessions.ExpiryInterval,
+		pendingSessionTimeout: cfg.Sessions.PendingTimeout,
+		asyncCreateSlots:      make(chan struct{}, max(cfg.Sessions.AsyncCreateWorkers, 1)),
+		sessionUpdates:        newSessionNotifier(),
+		usageRollupInterval:   cfg.Sessions.UsageRollupInterval,
+
+		webhookDispatchInterval: cfg.Webhooks.DispatchInterval,
+		webhookTimeout:          cfg.Webhooks.Timeout,
+		webhookAllowPrivate:     cfg.Webhooks.AllowPrivateAddresses,
+		webhookSender:           webhook.NewSender(cfg.Webhooks.Timeout, cfg.Webhooks.AllowPrivateAddresses),
+		webhookRetention:        cfg.Webhooks.Retention,
+
+		metricsAddr:  cfg.Metrics.Addr,
+		metricsToken: cfg.Metrics.Token,
+	}
+	s.bgCtx, s.bgCancel = context.WithCancel(context.Background())
+	return s
+}
@@ -8,20 +8,19 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"path/filepath"
-	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
@@ -29,7 +28,10 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 
 	"api-server/internal/browser"
+	"api-server/internal/config"
 	"api-server/internal/database"
+	"api-server/internal/logging"
+	"api-server/internal/webhook"
 )
 
 var (
@@ -37,7 +39,8 @@ var (
 	apiServerStop     context.CancelFunc
 
 	// dynamically set in TestMain
-	apiBaseURL string
+	apiBaseURL   string
+	testBrowsers *browser.Backend
 
 	jwtSecret = []byte("test-secret")
 )
@@ -55,7 +58,7 @@ func TestMain(m *testing.M) {
 	}
 
 	// 2. Apply DB migrations
-	dbSvc, err := database.New()
+	dbSvc, err := database.New(testDatabaseConfig())
 	if err != nil {
 		log.Fatalf("failed to create database service: %v", err)
 	}
@@ -63,8 +66,8 @@ func TestMain(m *testing.M) {
 		log.Fatalf("failed to apply migrations: %v", err)
 	}
 
-	// Determine Browser server availability or create stub
-	ensureBrowserServer()
+	// Determine Browser server availability or fall back to the fake backend
+	testBrowsers = ensureBrowserServer()
 
 	// Determine API server base URL. If external server running (env TEST_API_BASE_URL or localhost default), use it. Otherwise start our own.
 	apiBaseURL = ensureAPIServer(dbSvc)
@@ -85,8 +88,18 @@ func TestMain(m *testing.M) {
 
 /******************************* Helpers ********************************/
 
+// testDatabaseConfig returns the database configuration from the DB_* env
+// vars, as set by startPostgresContainer
+func testDatabaseConfig() config.Database {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatalf("invalid test configuration: %v", err)
+	}
+	return cfg.Database
+}
+
 // startPostgresContainer starts a temporary Postgres container and populates the
-// DB_* env vars used by database.New().
+// DB_* env vars used by testDatabaseConfig.
 func startPostgresContainer() (func(context.Context, ...testcontainers.TerminateOption) error, error) {
 	const (
 		dbName = "api"
@@ -126,30 +139,10 @@ func startPostgresContainer() (func(context.Context, ...testcontainers.Terminate
 	return pgC.Terminate, nil
 }
 
-// applyMigrations runs all *.up.sql scripts under migrations/.
+// applyMigrations brings the schema up to date with the embedded migrations.
 func applyMigrations(db *sql.DB) error {
-	migrationsDir := filepath.Join("..", "..", "migrations") // relative to internal/server/
-	entries, err := os.ReadDir(migrationsDir)
-	if err != nil {
-		return err
-	}
-	var files []string
-	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(e.Name(), ".up.sql") {
-			files = append(files, filepath.Join(migrationsDir, e.Name()))
-		}
-	}
-	sort.Strings(files)
-	for _, f := range files {
-		content, err := os.ReadFile(f)
-		if err != nil {
-			return err
-		}
-		if _, err := db.Exec(string(content)); err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := database.NewMigrator(db).Up(context.Background(), 0)
+	return err
 }
 
 // jwtSign signs claims using test secret.
@@ -267,9 +260,543 @@ func TestAuthAndSessionFlow(t *testing.T) {
 	require.Contains(t, string(delRaw), "success")
 }
 
+func TestSessionSharingFlow(t *testing.T) {
+	ownerToken, _ := registerUser(t, "share-owner@example.com")
+	granteeToken, _ := registerUser(t, "share-grantee@example.com")
+
+	var sessData sessionData
+	decodeData(t, mustRequest(t, http.MethodPost, "/sessions", nil, ownerToken), &sessData)
+	sessPath := "/sessions/" + sessData.Session.ID
+
+	var got struct {
+		Session database.SessionView `json:"session"`
+	}
+	decodeData(t, mustRequest(t, http.MethodGet, sessPath, nil, ownerToken), &got)
+	require.NotEmpty(t, got.Session.CdpURL)
+
+	// The session is hidden until it is shared
+	status, _ := doRequest(t, http.MethodGet, sessPath, nil, granteeToken)
+	require.Equal(t, http.StatusNotFound, status)
+
+	var share ShareResponse
+	decodeData(t, mustRequest(t, http.MethodPost, sessPath+"/shares", jsonBody(t, CreateShareRequest{Email: "share-grantee@example.com", Access: "view"}), ownerToken), &share)
+
+	// View access hides the CDP URL and allows no changes
+	decodeData(t, mustRequest(t, http.MethodGet, sessPath, nil, granteeToken), &got)
+	require.Equal(t, sessData.Session.ID, got.Session.ID)
+	require.Empty(t, got.Session.CdpURL)
+	require.Contains(t, string(mustRequest(t, http.MethodGet, "/sessions/shared", nil, granteeToken)), sessData.Session.ID)
+	for _, tc := range []struct {
+		method, path string
+		body         io.Reader
+	}{
+		{http.MethodPost, sessPath + "/stop", nil},
+		{http.MethodPut, sessPath + "/emulation", jsonBody(t, browser.Emulation{Locale: "fr-FR"})},
+		{http.MethodDelete, sessPath, nil},
+		{http.MethodGet, sessPath + "/shares", nil},
+	} {
+		status, out := doRequest(t, tc.method, tc.path, tc.body, granteeToken)
+		require.Equal(t, http.StatusForbidden, status, "%s %s: %s", tc.method, tc.path, out)
+	}
+
+	// Revoking the share removes access
+	mustRequest(t, http.MethodDelete, sessPath+"/shares/"+share.Share.ID, nil, ownerToken)
+	status, _ = doRequest(t, http.MethodGet, sessPath, nil, granteeToken)
+	require.Equal(t, http.StatusNotFound, status)
+
+	// Control access shows the CDP URL until the share expires
+	expiresAt := time.Now().Add(time.Hour)
+	decodeData(t, mustRequest(t, http.MethodPost, sessPath+"/shares", jsonBody(t, CreateShareRequest{Email: "share-grantee@example.com", Access: "control", ExpiresAt: &expiresAt}), ownerToken), &share)
+	decodeData(t, mustRequest(t, http.MethodGet, sessPath, nil, granteeToken), &got)
+	require.NotEmpty(t, got.Session.CdpURL)
+
+	dbSvc, err := database.New(testDatabaseConfig())
+	require.NoError(t, err)
+	_, err = dbSvc.DB().Exec(`UPDATE session_shares SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, share.Share.ID)
+	require.NoError(t, err)
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, sessPath},
+		{http.MethodPost, sessPath + "/stop"},
+	} {
+		status, out := doRequest(t, tc.method, tc.path, nil, granteeToken)
+		require.Equal(t, http.StatusNotFound, status, "%s %s: %s", tc.method, tc.path, out)
+	}
+}
+
+func TestOrganizationFlow(t *testing.T) {
+	ownerToken, _ := registerUser(t, "org-owner@example.com")
+	memberToken, memberID := registerUser(t, "org-member@example.com")
+	outsiderToken, _ := registerUser(t, "org-outsider@example.com")
+
+	quota := int64(1)
+	var org OrganizationResponse
+	decodeData(t, mustRequest(t, http.MethodPost, "/orgs", jsonBody(t, OrganizationRequest{Name: "Acme", MaxActiveSessions: &quota}), ownerToken), &org)
+	orgPath := "/orgs/" + org.Organization.ID
+	mustRequest(t, http.MethodPost, orgPath+"/members", jsonBody(t, AddMemberRequest{Email: "org-member@example.com", Role: "member"}), ownerToken)
+
+	// Members can't manage members or read the audit log; outsiders can't
+	// see the organization at all
+	status, _ := doRequest(t, http.MethodPost, orgPath+"/members", jsonBody(t, AddMemberRequest{Email: "org-outsider@example.com", Role: "member"}), memberToken)
+	require.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, http.MethodGet, orgPath+"/audit", nil, memberToken)
+	require.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, http.MethodGet, orgPath+"/members", nil, outsiderToken)
+	require.Equal(t, http.StatusNotFound, status)
+
+	// A member's organization session counts against the quota and can be
+	// stopped by the owner
+	orgID := uuid.MustParse(org.Organization.ID)
+	var sessData sessionData
+	decodeData(t, mustRequest(t, http.MethodPost, "/sessions", jsonBody(t, CreateSessionRequest{OrgID: &orgID}), memberToken), &sessData)
+	require.Contains(t, string(mustRequest(t, http.MethodGet, orgPath+"/sessions", nil, memberToken)), sessData.Session.ID)
+	status, _ = doRequest(t, http.MethodPost, "/sessions", jsonBody(t, CreateSessionRequest{OrgID: &orgID}), memberToken)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	status, _ = doRequest(t, http.MethodPost, "/sessions", jsonBody(t, CreateSessionRequest{OrgID: &orgID}), outsiderToken)
+	require.Equal(t, http.StatusBadRequest, status)
+	mustRequest(t, http.MethodPost, "/sessions/"+sessData.Session.ID+"/stop", nil, ownerToken)
+
+	var audit AuditEventsResponse
+	decodeData(t, mustRequest(t, http.MethodGet, orgPath+"/audit", nil, ownerToken), &audit)
+	var actions []string
+	for _, e := range audit.Events {
+		actions = append(actions, e.Action)
+	}
+	require.Contains(t, actions, database.AuditOrgSessionCreated)
+	require.Contains(t, actions, database.AuditOrgSessionStopped)
+
+	// Removed members lose access
+	mustRequest(t, http.MethodDelete, orgPath+"/members/"+memberID, nil, ownerToken)
+	status, _ = doRequest(t, http.MethodGet, orgPath+"/sessions", nil, memberToken)
+	require.Equal(t, http.StatusNotFound, status)
+}
+
+func TestWebhookFlow(t *testing.T) {
+	token, _ := registerUser(t, "webhooks@example.com")
+	otherToken, _ := registerUser(t, "webhooks-other@example.com")
+
+	// Private addresses are refused
+	status, _ := doRequest(t, http.MethodPost, "/webhooks", jsonBody(t, CreateWebhookRequest{URL: "http://127.0.0.1/hook"}), token)
+	require.Equal(t, http.StatusBadRequest, status)
+	status, _ = doRequest(t, http.MethodPost, "/webhooks", jsonBody(t, CreateWebhookRequest{URL: "https://203.0.113.10/hook", Events: []string{"session.exploded"}}), token)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	// The secret is only returned on creation
+	var created WebhookResponse
+	decodeData(t, mustRequest(t, http.MethodPost, "/webhooks", jsonBody(t, CreateWebhookRequest{URL: "https://203.0.113.10/hook", Events: []string{webhook.EventSessionStarted}}), token), &created)
+	require.NotEmpty(t, created.Webhook.Secret)
+	var list WebhooksResponse
+	decodeData(t, mustRequest(t, http.MethodGet, "/webhooks", nil, token), &list)
+	require.Len(t, list.Webhooks, 1)
+	require.Equal(t, created.Webhook.ID, list.Webhooks[0].ID)
+	require.Empty(t, list.Webhooks[0].Secret)
+	hookPath := "/webhooks/" + created.Webhook.ID
+
+	// Starting a session queues a delivery to the subscribed endpoint
+	mustRequest(t, http.MethodPost, "/sessions", nil, token)
+	var deliveries WebhookDeliveriesResponse
+	decodeData(t, mustRequest(t, http.MethodGet, hookPath+"/deliveries", nil, token), &deliveries)
+	require.Len(t, deliveries.Deliveries, 1)
+	require.Equal(t, webhook.EventSessionStarted, deliveries.Deliveries[0].Event)
+	status, _ = doRequest(t, http.MethodPost, hookPath+"/deliveries/"+uuid.NewString()+"/replay", nil, token)
+	require.Equal(t, http.StatusNotFound, status)
+
+	// Other users can't see or remove the endpoint
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, hookPath + "/deliveries"},
+		{http.MethodPost, hookPath + "/deliveries/" + deliveries.Deliveries[0].ID + "/replay"},
+		{http.MethodDelete, hookPath},
+	} {
+		status, out := doRequest(t, tc.method, tc.path, nil, otherToken)
+		require.Equal(t, http.StatusNotFound, status, "%s %s: %s", tc.method, tc.path, out)
+	}
+
+	mustRequest(t, http.MethodDelete, hookPath, nil, token)
+	status, _ = doRequest(t, http.MethodGet, hookPath+"/deliveries", nil, token)
+	require.Equal(t, http.StatusNotFound, status)
+}
+
+func TestSessionListFiltersAndExport(t *testing.T) {
+	regJSON, _ := json.Marshal(database.AuthRequest{Email: "export@example.com", Password: "secret", FirstName: "E", LastName: "X"})
+	var regEnv apiResp
+	require.NoError(t, json.Unmarshal(mustRequest(t, http.MethodPost, "/register", bytes.NewReader(regJSON), ""), &regEnv))
+	var regData authData
+	require.NoError(t, json.Unmarshal(regEnv.Data, &regData))
+	token := regData.Token
+
+	var sessEnv apiResp
+	require.NoError(t, json.Unmarshal(mustRequest(t, http.MethodPost, "/sessions", nil, token), &sessEnv))
+	var sessData sessionData
+	require.NoError(t, json.Unmarshal(sessEnv.Data, &sessData))
+	sessID := sessData.Session.ID
+
+	// Filters apply to the list
+	require.Contains(t, string(mustRequest(t, http.MethodGet, "/sessions?status=active", nil, token)), sessID)
+	require.NotContains(t, string(mustRequest(t, http.MethodGet, "/sessions?status=stopped", nil, token)), sessID)
+
+	// And to the export
+	csvOut := string(mustRequest(t, http.MethodGet, "/sessions/export?format=csv&status=active", nil, token))
+	require.True(t, strings.HasPrefix(csvOut, "id,name,browser_type"), csvOut)
+	require.Contains(t, csvOut, sessID)
+
+	ndjsonOut := mustRequest(t, http.MethodGet, "/sessions/export?format=ndjson", nil, token)
+	var view database.SessionView
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(ndjsonOut), &view))
+	require.Equal(t, sessID, view.ID)
+
+	emptyOut := string(mustRequest(t, http.MethodGet, "/sessions/export?status=stopped", nil, token))
+	require.NotContains(t, emptyOut, sessID)
+}
+
+func TestSessionExportRowEscapesFormulas(t *testing.T) {
+	session := &database.Session{
+		ID:        uuid.New(),
+		Name:      "=HYPERLINK(\"https://example.com\")",
+		UserAgent: sql.NullString{String: "@SUM(A1)", Valid: true},
+		Device:    "Pixel 7",
+		StartedAt: time.Now(),
+	}
+	row := sessionExportRow(session)
+	require.Equal(t, "'=HYPERLINK(\"https://example.com\")", row[1])
+	require.Equal(t, "'@SUM(A1)", row[7])
+	require.Equal(t, "Pixel 7", row[8])
+
+	// NDJSON is data, not a spreadsheet, and is left as is
+	require.Equal(t, session.Name, session.ToView().Name)
+}
+
+func TestParseSessionFilterDates(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/sessions?from=2024-03-01&to=2024-03-31", nil)
+	filter, err := parseSessionFilter(r, uuid.New())
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), filter.StartedAfter)
+	// A date to includes the whole day, as in usage reports
+	require.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), filter.StartedBefore)
+
+	r = httptest.NewRequest(http.MethodGet, "/sessions?to=2024-03-31T12:00:00Z", nil)
+	filter, err = parseSessionFilter(r, uuid.New())
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), filter.StartedBefore)
+}
+
+func TestAsyncSessionCreation(t *testing.T) {
+	regJSON, _ := json.Marshal(database.AuthRequest{Email: "async@example.com", Password: "secret", FirstName: "A", LastName: "S"})
+	var regEnv apiResp
+	require.NoError(t, json.Unmarshal(mustRequest(t, http.MethodPost, "/register", bytes.NewReader(regJSON), ""), &regEnv))
+	var regData authData
+	require.NoError(t, json.Unmarshal(regEnv.Data, &regData))
+	token := regData.Token
+
+	req, err := http.NewRequest(http.MethodPost, apiBaseURL+"/sessions?async=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	out, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, string(out))
+
+	var env apiResp
+	require.NoError(t, json.Unmarshal(out, &env))
+	var created struct {
+		Session database.SessionView `json:"session"`
+	}
+	require.NoError(t, json.Unmarshal(env.Data, &created))
+	require.Equal(t, database.SessionPending, created.Session.State)
+	require.Equal(t, "/sessions/"+created.Session.ID, resp.Header.Get("Location"))
+
+	// Long-polling returns once the browser is up
+	var got struct {
+		Session database.SessionView `json:"session"`
+	}
+	require.NoError(t, json.Unmarshal(mustRequest(t, http.MethodGet, "/sessions/"+created.Session.ID+"?wait=10s", nil, token), &env))
+	require.NoError(t, json.Unmarshal(env.Data, &got))
+	require.Equal(t, database.SessionRunning, got.Session.State)
+	require.NotEmpty(t, got.Session.CdpURL)
+
+	// The event stream reports the current state and ends once stopped
+	mustRequest(t, http.MethodPost, "/sessions/"+created.Session.ID+"/stop", nil, token)
+	events := string(mustRequest(t, http.MethodGet, "/sessions/"+created.Session.ID+"/events", nil, token))
+	require.True(t, strings.HasPrefix(events, "event: session\ndata: "), events)
+	require.Contains(t, events, `"state":"stopped"`)
+}
+
+func TestQueuedLaunchFailsOnShutdown(t *testing.T) {
+	dbSvc, err := database.New(testDatabaseConfig())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	userID, err := dbSvc.CreateUser(ctx, &database.User{Email: "queued@example.com", FirstName: "Q", LastName: "L", PasswordHash: "hashed"})
+	require.NoError(t, err)
+	session, err := dbSvc.CreateSessionWithOptions(ctx, userID, "queued", "", "firefox", "", true, 800, 600, nil, database.SessionOptions{State: database.SessionPending})
+	require.NoError(t, err)
+
+	// Every launch slot is taken, so the launch queues
+	s := newServer(dbSvc, config.Default(), testBrowsers)
+	for range cap(s.asyncCreateSlots) {
+		s.asyncCreateSlots <- struct{}{}
+	}
+	s.bgWG.Add(1)
+	go func() {
+		defer s.bgWG.Done()
+		s.launchSession(ctx, session, browser.CreateSessionRequest{BrowserType: "firefox", Headless: true})
+	}()
+
+	// Shutdown fails it rather than waiting for a slot
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.StopBackgroundJobs(stopCtx))
+	session, err = dbSvc.GetSessionByID(ctx, session.ID, userID)
+	require.NoError(t, err)
+	require.Equal(t, database.SessionFailed, session.State)
+}
+
+func TestWriteBrowserError(t *testing.T) {
+	cases := []struct {
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{browser.ErrSessionNotFound, http.StatusNotFound, ""},
+		{fmt.Errorf("placing session: %w", browser.ErrAtCapacity), http.StatusTooManyRequests, "30"},
+		{&browser.ServerError{StatusCode: http.StatusTooManyRequests, Code: "capacity_exhausted", Detail: "full", RetryAfter: 90 * time.Second}, http.StatusTooManyRequests, "90"},
+		{&browser.ServerError{StatusCode: http.StatusBadRequest, Code: "invalid_browser_type", Detail: "Unsupported browser type: opera"}, http.StatusBadRequest, ""},
+		{&browser.CircuitOpenError{URL: "http://browser:8000", RetryAfter: 1500 * time.Millisecond}, http.StatusServiceUnavailable, "2"},
+		{errors.New("boom"), http.StatusInternalServerError, ""},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		writeBrowserError(rec, tc.err, http.StatusInternalServerError, "Could not create browser session")
+		require.Equal(t, tc.status, rec.Code, tc.err.Error())
+		require.Equal(t, tc.retryAfter, rec.Header().Get("Retry-After"), tc.err.Error())
+	}
+}
+
+func TestProbes(t *testing.T) {
+	resp, err := http.Get(apiBaseURL + "/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(apiBaseURL + "/readyz")
+	require.NoError(t, err)
+	var ready struct {
+		Status string                     `json:"status"`
+		Checks map[string]dependencyCheck `json:"checks"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ready))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, ready)
+	require.Equal(t, "ready", ready.Status)
+	for _, name := range []string{"database", "migrations", "browser"} {
+		require.Equal(t, checkUp, ready.Checks[name].Status, name)
+	}
+
+	resp, err = http.Get(apiBaseURL + "/health")
+	require.NoError(t, err)
+	var health map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	resp.Body.Close()
+	require.Equal(t, "up", health["status"])
+	require.Contains(t, health["checks"], "database")
+	// The probes are public, so they don't describe the deployment
+	out, err := json.Marshal(health)
+	require.NoError(t, err)
+	require.NotContains(t, string(out), "open_connections")
+	require.NotContains(t, string(out), "http://")
+
+	// Node pools report their breaker states as counts
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "healthy", "active_sessions": 0, "max_sessions": 10}`))
+	}))
+	defer node.Close()
+	browserCfg := config.Default().Browser
+	browserCfg.ServerURLs = []string{node.URL}
+	pool, err := browser.New(browserCfg)
+	require.NoError(t, err)
+	details, err := (&Server{browsers: pool, browserHealthInterval: time.Minute}).checkBrowser(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{browser.BreakerClosed: 1, browser.BreakerOpen: 0, browser.BreakerHalfOpen: 0}, details.(map[string]any)["breakers"])
+
+	// A draining server fails readiness but stays live
+	s := &Server{}
+	s.StartDraining()
+	handler := s.RegisterRoutes()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "draining")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestShutdownPolicy(t *testing.T) {
+	dbSvc, err := database.New(testDatabaseConfig())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	userID, err := dbSvc.CreateUser(ctx, &database.User{Email: "shutdown@example.com", FirstName: "S", LastName: "D", PasswordHash: "hashed"})
+	require.NoError(t, err)
+	create := func(instanceID string) *database.Session {
+		session, err := dbSvc.CreateSessionWithOptions(ctx, userID, "shutdown", "", "firefox", "", true, 800, 600, nil, database.SessionOptions{InstanceID: instanceID})
+		require.NoError(t, err)
+		return session
+	}
+
+	// handoff releases this instance's sessions for another to adopt
+	handedOff := create("instance-handoff")
+	s := &Server{db: dbSvc, browsers: testBrowsers, instanceID: "instance-handoff", shutdownPolicy: ShutdownHandoff}
+	require.NoError(t, s.applyShutdownPolicy(ctx))
+	sessions, err := dbSvc.ListInstanceSessions(ctx, "instance-handoff")
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+
+	// stop stops only this instance's sessions
+	owned := create("instance-stop")
+	other := create("instance-other")
+	s = &Server{db: dbSvc, browsers: testBrowsers, sessionUpdates: newSessionNotifier(), instanceID: "instance-stop", shutdownPolicy: ShutdownStop}
+	require.NoError(t, s.applyShutdownPolicy(ctx))
+	for _, tc := range []struct {
+		session *database.Session
+		stopped bool
+	}{{owned, true}, {other, false}, {handedOff, false}} {
+		session, err := dbSvc.GetSessionByID(ctx, tc.session.ID, userID)
+		require.NoError(t, err)
+		require.Equal(t, tc.stopped, session.StoppedAt.Valid, session.InstanceID)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	dbSvc, err := database.New(testDatabaseConfig())
+	require.NoError(t, err)
+	ctx := context.Background()
+	a, err := NewAdmin(dbSvc, config.Default())
+	require.NoError(t, err)
+
+	const email = "admin-cli@example.com"
+	u, err := a.CreateUser(ctx, email, "A", "C", "secret")
+	require.NoError(t, err)
+	_, err = a.CreateUser(ctx, email, "A", "C", "secret")
+	require.ErrorContains(t, err, "already exists")
+
+	login := func() int {
+		body, _ := json.Marshal(database.AuthRequest{Email: email, Password: "secret"})
+		rec := httptest.NewRecorder()
+		a.s.LoginHandler(rec, httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body)))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, login())
+
+	// authenticated runs a request with a token issued before the disable
+	token, err := a.s.tokens.Generate(u.ID.String())
+	require.NoError(t, err)
+	authenticated := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		a.s.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, authenticated())
+
+	session, err := dbSvc.CreateSession(ctx, u.ID, "admin", "", "firefox", "", true, 800, 600, nil)
+	require.NoError(t, err)
+	sessions, err := a.ListSessions(ctx, email, false)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	// Disabling stops the user's sessions and blocks login
+	disabled, stopped, err := a.DisableUser(ctx, email, true)
+	require.NoError(t, err)
+	require.True(t, disabled.DisabledAt.Valid)
+	require.Len(t, stopped, 1)
+	require.Equal(t, session.ID, stopped[0].ID)
+	require.Equal(t, http.StatusForbidden, login())
+	require.Equal(t, http.StatusForbidden, authenticated())
+
+	sessions, err = a.ListSessions(ctx, email, false)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+	sessions, err = a.ListSessions(ctx, email, true)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.True(t, sessions[0].StoppedAt.Valid)
+
+	_, err = a.StopSessions(ctx, email, []uuid.UUID{uuid.New()})
+	require.ErrorIs(t, err, database.ErrSessionNotFound)
+	_, err = a.Reap(ctx)
+	require.NoError(t, err)
+}
+
+func TestRequestIDAndRecover(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	// A valid incoming ID is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "client-id.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, "client-id.1", rec.Header().Get(RequestIDHeader))
+	require.Equal(t, "client-id.1", seen)
+
+	// An invalid one is replaced, and a panic becomes a 500
+	req = httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	_, err := uuid.Parse(rec.Header().Get(RequestIDHeader))
+	require.NoError(t, err)
+	require.Equal(t, rec.Header().Get(RequestIDHeader), seen)
+}
+
+func TestMetrics(t *testing.T) {
+	dbSvc, err := database.New(testDatabaseConfig())
+	require.NoError(t, err)
+	cfg := config.Default()
+	cfg.Metrics.Token = "scrape-token"
+	s := newServer(dbSvc, cfg, testBrowsers)
+	s.metrics = newServerMetrics(s)
+
+	s.RegisterRoutes().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/devices", nil))
+	s.metrics.recordSessionEvent(webhook.EventSessionStarted, &database.Session{BrowserType: "firefox"})
+
+	rec := httptest.NewRecorder()
+	s.metricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	rec = httptest.NewRecorder()
+	s.metricsHandler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	require.Contains(t, body, `orchestrator_http_requests_total{method="GET",route="/devices",status="200"} 1`)
+	require.Contains(t, body, `orchestrator_sessions_created_total{browser_type="firefox"} 1`)
+	require.Contains(t, body, "go_sql_open_connections")
+}
+
 /******************************* Request util ***************************/
 
 func mustRequest(t *testing.T, method, path string, body io.Reader, token string) []byte {
+	t.Helper()
+	status, out := doRequest(t, method, path, body, token)
+	require.Equal(t, http.StatusOK, status, string(out))
+	return out
+}
+
+// doRequest sends a request to the API and returns the status and body,
+// whatever the status
+func doRequest(t *testing.T, method, path string, body io.Reader, token string) (int, []byte) {
 	t.Helper()
 	req, err := http.NewRequest(method, apiBaseURL+path, body)
 	require.NoError(t, err)
@@ -283,75 +810,53 @@ func mustRequest(t *testing.T, method, path string, body io.Reader, token string
 	require.NoError(t, err)
 	defer resp.Body.Close()
 	out, _ := io.ReadAll(resp.Body)
-	require.Equal(t, http.StatusOK, resp.StatusCode, string(out))
-	return out
+	return resp.StatusCode, out
 }
 
-// newBrowserStubOnPort spins up an http.Server listening on desired port that
-// implements minimal subset of the Browser service contract needed for tests.
-func newBrowserStubOnPort(portStr string) *http.Server {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		var req browser.CreateSessionRequest
-		_ = json.NewDecoder(r.Body).Decode(&req)
-		now := time.Now()
-		resp := browser.SessionResponse{
-			ID:          "stub-session-" + req.BrowserType,
-			BrowserType: req.BrowserType,
-			Headless:    req.Headless,
-			CreatedAt:   browser.FlexibleTime(now),
-			ExpiresAt:   browser.FlexibleTime(now.Add(1 * time.Hour)),
-			CdpURL:      "ws://stub",
-			ViewportSize: browser.ViewportSize{
-				Width:  req.ViewportSize.Width,
-				Height: req.ViewportSize.Height,
-			},
-		}
-		_ = json.NewEncoder(w).Encode(resp)
-	})
+// jsonBody encodes v as a request body
+func jsonBody(t *testing.T, v any) io.Reader {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return bytes.NewReader(b)
+}
 
-	mux.HandleFunc("/sessions/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
-	})
+// decodeData decodes the data of an API response into v
+func decodeData(t *testing.T, out []byte, v any) {
+	t.Helper()
+	var env apiResp
+	require.NoError(t, json.Unmarshal(out, &env))
+	require.NoError(t, json.Unmarshal(env.Data, v), string(out))
+}
 
-	srv := &http.Server{Addr: ":" + portStr, Handler: mux}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("browser stub failed: %v", err)
-		}
-	}()
-	return srv
+// registerUser registers a user with email and returns their token and ID
+func registerUser(t *testing.T, email string) (string, string) {
+	t.Helper()
+	var data authData
+	out := mustRequest(t, http.MethodPost, "/register", jsonBody(t, database.AuthRequest{Email: email, Password: "secret", FirstName: "T", LastName: "U"}), "")
+	decodeData(t, out, &data)
+	return data.Token, data.User.ID
 }
 
-// ensureBrowserServer verifies if a browser server is already running; if not, spins a stub and sets env.
-func ensureBrowserServer() {
+// ensureBrowserServer uses a running browser server if one is reachable and
+// otherwise the in-memory fake backend.
+func ensureBrowserServer() *browser.Backend {
 	browserURL := os.Getenv("BROWSER_SERVER_URL")
 	if browserURL == "" {
 		browserURL = "http://localhost:8000"
 	}
 
 	if serverResponds(browserURL+"/sessions", http.MethodGet) { // simple reachability check
-		return
-	}
-
-	// need to start stub on random free port
-	l, err := net.Listen("tcp", ":0")
-	if err != nil {
-		log.Fatalf("failed to find free port for browser stub: %v", err)
+		cfg := config.Default().Browser
+		cfg.ServerURL = browserURL
+		browsers, err := browser.New(cfg)
+		if err != nil {
+			log.Fatalf("failed to create browser backend: %v", err)
+		}
+		return browsers
 	}
-	portStr := fmt.Sprintf("%d", l.Addr().(*net.TCPAddr).Port)
-	_ = l.Close()
 
-	stub := newBrowserStubOnPort(portStr)
-	// store cancel via apiServerStop if needed later
-	apiServerStop = func() { _ = stub.Close() }
-	os.Setenv("BROWSER_SERVER_URL", "http://localhost:"+portStr)
+	return browser.NewFakeBackend(browser.NewFakeClient(0))
 }
 
 // ensureAPIServer returns base URL; may start internal server if external not reachable
@@ -365,7 +870,7 @@ func ensureAPIServer(dbSvc database.Service) string {
 	}
 
 	// Start internal HTTP test server on random port
-	srv := httptest.NewServer((&Server{db: dbSvc}).RegisterRoutes())
+	srv := httptest.NewServer(newServer(dbSvc, config.Default(), testBrowsers).RegisterRoutes())
 	apiServerStop = srv.Close
 	return srv.URL
 }
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/browser"
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// Asynchronous session creation settings
+var (
+	// maxSessionWait caps the wait query parameter of GET /sessions/{id}
+	maxSessionWait = 60 * time.Second
+	// sessionPollInterval is how often a long-poll re-reads the session, which
+	// catches launches finished by other instances
+	sessionPollInterval = time.Second
+	// sessionEventsPollInterval is how often an event stream re-reads the session
+	sessionEventsPollInterval = 5 * time.Second
+	// sessionEventsHeartbeat is how often an idle event stream sends a comment
+	// to keep the connection open
+	sessionEventsHeartbeat = 15 * time.Second
+)
+
+// shutdownLaunchReason is the failure reason of sessions whose launch was cut
+// short by shutdown
+const shutdownLaunchReason = "Server shut down before the browser launched"
+
+// sessionNotifier wakes requests waiting on a session when this instance
+// changes it. Other instances' changes are picked up by polling.
+type sessionNotifier struct {
+	mu      sync.Mutex
+	watches map[uuid.UUID]*sessionWatch
+}
+
+type sessionWatch struct {
+	ch       chan struct{}
+	watchers int
+}
+
+func newSessionNotifier() *sessionNotifier {
+	return &sessionNotifier{watches: make(map[uuid.UUID]*sessionWatch)}
+}
+
+// watch returns a channel closed by the next notify for id, and a function to
+// call once the caller stops waiting on it
+func (n *sessionNotifier) watch(id uuid.UUID) (<-chan struct{}, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	w := n.watches[id]
+	if w == nil {
+		w = &sessionWatch{ch: make(chan struct{})}
+		n.watches[id] = w
+	}
+	w.watchers++
+
+	return w.ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		w.watchers--
+		if w.watchers == 0 && n.watches[id] == w {
+			delete(n.watches, id)
+		}
+	}
+}
+
+// notify wakes everything watching id
+func (n *sessionNotifier) notify(id uuid.UUID) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if w := n.watches[id]; w != nil {
+		close(w.ch)
+		delete(n.watches, id)
+	}
+}
+
+// waitingForLaunch reports whether a session's browser is still launching
+func waitingForLaunch(session *database.Session) bool {
+	return session.State == database.SessionPending && !session.StoppedAt.Valid
+}
+
+// createSessionAsync records a pending session, responds 202 with it and
+// launches its browser in the background
+func (s *Server) createSessionAsync(w http.ResponseWriter, r *http.Request, userID uuid.UUID, name string, req browser.CreateSessionRequest, opts database.SessionOptions) {
+	ctx := r.Context()
+	opts.State = database.SessionPending
+
+	session, err := s.db.CreateSessionWithOptions(
+		ctx,
+		userID,
+		name,
+		"",
+		req.BrowserType,
+		"",
+		req.Headless,
+		req.ViewportSize.Width,
+		req.ViewportSize.Height,
+		req.UserAgent,
+		opts,
+	)
+	if err != nil {
+		if errors.Is(err, database.ErrOrgQuotaReached) {
+			writeError(w, http.StatusTooManyRequests, "Organization active session quota reached")
+			return
+		}
+		logger.ErrorContext(ctx, "Failed to record pending session", "user_id", userID, "error", err)
+		s.emitSessionEvent(ctx, userID, webhook.EventSessionFailed, nil, "Could not create session")
+		writeError(w, http.StatusInternalServerError, "Could not create session")
+		return
+	}
+
+	if session.OrgID.Valid {
+		s.auditOrg(ctx, session.OrgID.UUID, userID, database.AuditOrgSessionCreated, uuid.Nil, session.ID, "")
+	}
+
+	// The launch outlives the request; StopBackgroundJobs cancels it and
+	// waits for it
+	s.bgWG.Add(1)
+	go func() {
+		defer s.bgWG.Done()
+		s.launchSession(context.WithoutCancel(ctx), session, req)
+	}()
+
+	w.Header().Set("Location", "/sessions/"+session.ID.String())
+	writeJSON(w, http.StatusAccepted, CreateSessionResponse{
+		Session: session.ToView(),
+	})
+}
+
+// launchSession starts the browser of a pending session and marks the
+// session running, or failed if the launch fails. Launches still waiting for
+// a slot when the background jobs stop are failed without being started.
+func (s *Server) launchSession(ctx context.Context, session *database.Session, req browser.CreateSessionRequest) {
+	defer s.sessionUpdates.notify(session.ID)
+
+	// The launch keeps the request's values but ends with the background jobs
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(s.bgCtx, cancel)()
+
+	select {
+	case s.asyncCreateSlots <- struct{}{}:
+		defer func() { <-s.asyncCreateSlots }()
+	case <-ctx.Done():
+		s.failLaunch(context.WithoutCancel(ctx), session, shutdownLaunchReason)
+		return
+	}
+
+	browserSession, err := s.browserClient().CreateSession(ctx, req)
+	if err != nil {
+		reason := shutdownLaunchReason
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to create browser session", "session_id", session.ID, "error", err)
+			_, reason, _ = browserErrorResponse(err, http.StatusInternalServerError, "Could not create browser session")
+		}
+		s.failLaunch(context.WithoutCancel(ctx), session, reason)
+		return
+	}
+	// A browser that launched is recorded even if shutdown has begun
+	ctx = context.WithoutCancel(ctx)
+
+	launch := database.SessionLaunch{
+		BrowserID:   browserSession.ID,
+		BrowserType: browserSession.BrowserType,
+		CdpURL:      browserSession.CdpURL,
+		Headless:    browserSession.Headless,
+		ViewportW:   browserSession.ViewportSize.Width,
+		ViewportH:   browserSession.ViewportSize.Height,
+		UserAgent:   browserSession.UserAgent,
+		BrowserNode: browserSession.Node,
+	}
+	if expiresAt := browserSession.ExpiresAt.Time(); !expiresAt.IsZero() {
+		launch.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	running, err := s.db.CompletePendingSession(ctx, session.ID, launch)
+	if err != nil {
+		// Stopped or deleted while launching; don't leave the browser running
+		_ = s.browsers.NodeClient(browserSession.Node).DeleteSession(ctx, browserSession.ID)
+
+		if !errors.Is(err, database.ErrSessionNotFound) {
+			logger.ErrorContext(ctx, "Failed to record launched session", "session_id", session.ID, "error", err)
+			if failed, err := s.db.FailPendingSession(ctx, session.ID, "Could not create session"); err == nil {
+				s.emitSessionEvent(ctx, failed.UserID, webhook.EventSessionFailed, failed, "Could not create session")
+			}
+		}
+		return
+	}
+
+	s.emitSessionEvent(ctx, running.UserID, webhook.EventSessionStarted, running, "")
+}
+
+// failLaunch marks a pending session failed with reason and emits its failed
+// event
+func (s *Server) failLaunch(ctx context.Context, session *database.Session, reason string) {
+	failed, err := s.db.FailPendingSession(ctx, session.ID, reason)
+	if err != nil {
+		if !errors.Is(err, database.ErrSessionNotFound) {
+			logger.ErrorContext(ctx, "Failed to mark session failed", "session_id", session.ID, "error", err)
+		}
+		return
+	}
+	s.emitSessionEvent(ctx, failed.UserID, webhook.EventSessionFailed, failed, reason)
+}
+
+// failStalePendingSessions fails sessions that have been pending for longer
+// than any launch takes and returns how many were failed
+func (s *Server) failStalePendingSessions(ctx context.Context) (int, error) {
+	const reason = "Browser launch did not complete"
+	stale, err := s.db.FailStalePendingSessions(ctx, time.Now().Add(-s.pendingSessionTimeout), reason)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to fail stale pending sessions", "error", err)
+		}
+		return 0, err
+	}
+
+	for _, session := range stale {
+		s.sessionUpdates.notify(session.ID)
+		s.emitSessionEvent(ctx, session.UserID, webhook.EventSessionFailed, session, reason)
+	}
+	return len(stale), nil
+}
+
+// parseWait reads the wait query parameter, given as a duration such as 30s
+// or a number of seconds, capped at maxSessionWait
+func parseWait(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("wait")
+	if v == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(v)
+	if err != nil {
+		secs, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			return 0, errors.New("wait must be a duration such as 30s")
+		}
+		wait = time.Duration(secs) * time.Second
+	}
+	if wait < 0 {
+		return 0, errors.New("wait must not be negative")
+	}
+	return min(wait, maxSessionWait), nil
+}
+
+// waitForLaunch long-polls a pending session until its browser has launched
+// or failed, wait has passed, or the client goes away, and returns the latest
+// state of the session
+func (s *Server) waitForLaunch(w http.ResponseWriter, r *http.Request, session *database.Session, access database.AccessLevel, wait time.Duration) (*database.Session, database.AccessLevel, error) {
+	ctx := r.Context()
+
+	// Keep the server's WriteTimeout from cutting the response off
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Now().Add(wait + 10*time.Second)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.WarnContext(ctx, "Failed to extend write deadline", "error", err)
+	}
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	poll := time.NewTicker(sessionPollInterval)
+	defer poll.Stop()
+
+	userID, _ := GetUserIDFromContext(ctx)
+	for waitingForLaunch(session) {
+		updated, release := s.sessionUpdates.watch(session.ID)
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, access, ctx.Err()
+		case <-deadline.C:
+			release()
+			return session, access, nil
+		case <-updated:
+		case <-poll.C:
+		}
+		release()
+
+		var err error
+		session, access, err = s.db.GetSessionAccess(ctx, session.ID, userID)
+		if err != nil {
+			return nil, access, err
+		}
+	}
+	return session, access, nil
+}
+
+// SessionEventsHandler streams a session's state as server-sent events. A
+// session event carrying the session is sent on connect and whenever its
+// state changes; the stream ends once the session has stopped or failed.
+func (s *Server) SessionEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	session, access, err := s.db.GetSessionAccess(ctx, sessionID, userID)
+	if err != nil {
+		writeSessionAccessError(w, r, sessionID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(2 * sessionEventsHeartbeat)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	poll := time.NewTicker(sessionEventsPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(sessionEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	lastState := ""
+	for {
+		view := sessionViewFor(session, access)
+		if view.State != lastState {
+			data, err := json.Marshal(view)
+			if err != nil {
+				logger.ErrorContext(ctx, "Failed to encode session event", "session_id", sessionID, "error", err)
+				return
+			}
+			if err := write("event: session\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			lastState = view.State
+		}
+		if view.State == database.SessionStopped || view.State == database.SessionFailed {
+			return
+		}
+
+		updated, release := s.sessionUpdates.watch(sessionID)
+		select {
+		case <-ctx.Done():
+			release()
+			return
+		case <-heartbeat.C:
+			release()
+			if err := write(": heartbeat\n\n"); err != nil {
+				return
+			}
+			continue
+		case <-updated:
+		case <-poll.C:
+		}
+		release()
+
+		// A session that can't be read any more has been deleted
+		session, access, err = s.db.GetSessionAccess(ctx, sessionID, userID)
+		if err != nil {
+			return
+		}
+	}
+}
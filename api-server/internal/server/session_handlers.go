@@ -3,14 +3,16 @@ package server
 import (
 	"api-server/internal/browser"
 	"api-server/internal/database"
+	"api-server/internal/webhook"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"crypto/rand"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math/big"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -62,6 +64,18 @@ func RandomSessionName() string {
 }
 
 // Request and response structures
+
+// CreateSessionRequest holds the optional settings a caller may supply when
+// creating a session. An empty body creates a session with the defaults.
+type CreateSessionRequest struct {
+	Proxy     *browser.ProxySettings `json:"proxy,omitempty"`
+	Emulation *browser.Emulation     `json:"emulation,omitempty"`
+	// Device selects a preset from GET /devices, e.g. "Pixel 7"
+	Device string `json:"device,omitempty"`
+	// OrgID makes the session owned by an organization the caller belongs to
+	OrgID *uuid.UUID `json:"org_id,omitempty"`
+}
+
 type CreateSessionResponse struct {
 	Session *database.SessionView `json:"session"`
 }
@@ -70,106 +84,183 @@ type SessionsResponse struct {
 	Sessions []*database.SessionView `json:"sessions"`
 }
 
-// Default browser settings from environment or hardcoded defaults
-var (
-	defaultBrowserType = getEnvOrDefault("DEFAULT_BROWSER_TYPE", "firefox")
-	defaultHeadless    = getEnvBoolOrDefault("DEFAULT_BROWSER_HEADLESS", false)
-	defaultViewportW   = getEnvIntOrDefault("DEFAULT_BROWSER_VIEWPORT_WIDTH", 1280)
-	defaultViewportH   = getEnvIntOrDefault("DEFAULT_BROWSER_VIEWPORT_HEIGHT", 720)
-	defaultTimeout     = getEnvIntOrDefault("DEFAULT_BROWSER_TIMEOUT", 3600) // Default 1 hour
-)
+// CreateSessionHandler creates a new session for the authenticated user
+func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-// Helper functions to get environment variables with defaults
-func getEnvOrDefault(key, defaultVal string) string {
-	if val, exists := os.LookupEnv(key); exists {
-		return val
+	// Get user ID from context (set by AuthMiddleware)
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
-	return defaultVal
-}
 
-func getEnvBoolOrDefault(key string, defaultVal bool) bool {
-	if val, exists := os.LookupEnv(key); exists {
-		return val == "true" || val == "1" || val == "yes"
+	// Decode optional request body
+	var req CreateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(database.APIResponse{
+			Error: "Invalid request body",
+			Data:  nil,
+		})
+		return
 	}
-	return defaultVal
-}
 
-func getEnvIntOrDefault(key string, defaultVal int) int {
-	if val, exists := os.LookupEnv(key); exists {
-		if intVal, err := parseInt(val); err == nil {
-			return intVal
+	ctx := r.Context()
+	var opts database.SessionOptions
+	// The session belongs to this instance for its shutdown policy
+	opts.InstanceID = s.instanceID
+
+	// Validate the proxy. The browser server checks that it is reachable when
+	// it launches the browser.
+	if req.Proxy != nil {
+		if err := req.Proxy.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(database.APIResponse{
+				Error: err.Error(),
+				Data:  nil,
+			})
+			return
+		}
+
+		opts.Proxy = &database.SessionProxy{
+			Server:   req.Proxy.Server,
+			Bypass:   req.Proxy.Bypass,
+			Username: req.Proxy.Username,
+		}
+		if req.Proxy.Password != "" {
+			encrypted, err := s.secrets.Encrypt(req.Proxy.Password)
+			if err != nil {
+				logger.ErrorContext(ctx, "Failed to encrypt proxy password", "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(database.APIResponse{
+					Error: "Could not store proxy credentials",
+					Data:  nil,
+				})
+				return
+			}
+			opts.Proxy.PasswordEncrypted = encrypted
 		}
 	}
-	return defaultVal
-}
 
-func parseInt(s string) (int, error) {
-	var i int
-	_, err := fmt.Sscanf(s, "%d", &i)
-	return i, err
-}
+	// Validate emulation overrides
+	if req.Emulation != nil {
+		if err := req.Emulation.Validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(database.APIResponse{
+				Error: err.Error(),
+				Data:  nil,
+			})
+			return
+		}
+		if req.Emulation.IsZero() {
+			req.Emulation = nil
+		}
+		opts.Emulation = toSessionEmulation(req.Emulation)
+	}
 
-// CreateSessionHandler creates a new session for the authenticated user
-func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	// Check organization membership and its active session quota. The quota
+	// is enforced again when the session is recorded, which concurrent creates
+	// can't race past; checking first avoids launching a browser for nothing.
+	if req.OrgID != nil {
+		org, err := s.db.GetOrganizationForUser(ctx, *req.OrgID, userID)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(database.APIResponse{
+				Error: err.Error(),
+				Data:  nil,
+			})
+			return
+		}
+		if org.MaxActiveSessions.Valid {
+			active, err := s.db.CountActiveOrgSessions(ctx, org.ID)
+			if err != nil {
+				logger.ErrorContext(ctx, "Failed to count active organization sessions", "org_id", org.ID, "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(database.APIResponse{
+					Error: "Could not create session",
+					Data:  nil,
+				})
+				return
+			}
+			if int64(active) >= org.MaxActiveSessions.Int64 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(database.APIResponse{
+					Error: "Organization active session quota reached",
+					Data:  nil,
+				})
+				return
+			}
+		}
+		opts.OrgID = uuid.NullUUID{UUID: org.ID, Valid: true}
+	}
 
-	// Get user ID from context (set by AuthMiddleware)
-	userID, err := GetUserIDFromContext(r.Context())
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+	// Resolve the device preset
+	var device *browser.Device
+	if req.Device != "" {
+		d, ok := browser.LookupDevice(req.Device)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(database.APIResponse{
+				Error: fmt.Sprintf("Unknown device %q, see GET /devices", req.Device),
+				Data:  nil,
+			})
+			return
+		}
+		device = &d
+		opts.Device = d.Name
 	}
 
 	// Generate a random session name
 	sessionName := RandomSessionName()
 
 	// Create browser client
-	browserClient := browser.NewClient()
+	browserClient := s.browserClient()
 
 	// Create browser session request
 	browserReq := browser.CreateSessionRequest{
-		BrowserType: defaultBrowserType,
-		Headless:    defaultHeadless,
+		BrowserType: s.defaultBrowserType,
+		Headless:    s.defaultHeadless,
 		ViewportSize: &browser.ViewportSize{
-			Width:  defaultViewportW,
-			Height: defaultViewportH,
+			Width:  s.defaultViewportW,
+			Height: s.defaultViewportH,
 		},
-		Timeout: &defaultTimeout,
+		Timeout: &s.defaultTimeout,
+		Proxy:     req.Proxy,
+		Emulation: req.Emulation,
+	}
+
+	// A device preset overrides the default viewport and user agent
+	if device != nil {
+		viewport := device.Viewport
+		userAgent := device.UserAgent
+		browserReq.ViewportSize = &viewport
+		browserReq.UserAgent = &userAgent
+		browserReq.DeviceMetrics = device.Metrics()
+	}
+
+	// With async=true the browser is launched in the background and the
+	// pending session returned straight away
+	if r.URL.Query().Get("async") == "true" {
+		s.createSessionAsync(w, r, userID, sessionName, browserReq, opts)
+		return
 	}
 
 	// Create browser session
-	ctx := r.Context()
 	browserSession, err := browserClient.CreateSession(ctx, browserReq)
 	if err != nil {
-		log.Printf("Failed to create browser session: %v", err)
-		
-		// Check if we should use a fallback mock session
-		if os.Getenv("BROWSER_SERVER_FALLBACK") == "true" {
-			log.Printf("Using fallback mock session")
-			// Create a mock browser session for fallback
-			now := time.Now()
-			expireTime := now.Add(time.Duration(defaultTimeout) * time.Second)
-			browserSession = &browser.SessionResponse{
-				ID:          "mock-" + uuid.New().String(),
-				BrowserType: browserReq.BrowserType,
-				Headless:    browserReq.Headless,
-				CreatedAt:   browser.FlexibleTime(now),
-				ExpiresAt:   browser.FlexibleTime(expireTime),
-				CdpURL:      "mock://browser-session/not-available",
-				ViewportSize: browser.ViewportSize{
-					Width:  browserReq.ViewportSize.Width,
-					Height: browserReq.ViewportSize.Height,
-				},
-				UserAgent: browserReq.UserAgent,
-			}
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(database.APIResponse{
-				Error: "Could not create browser session",
-				Data:  nil,
-			})
-			return
-		}
+		logger.ErrorContext(ctx, "Failed to create browser session", "user_id", userID, "error", err)
+		s.emitSessionEvent(ctx, userID, webhook.EventSessionFailed, nil, "Could not create browser session")
+		writeBrowserError(w, err, http.StatusInternalServerError, "Could not create browser session")
+		return
+	}
+
+	// Record the node hosting the session so later calls are routed to it
+	opts.BrowserNode = browserSession.Node
+
+	// Record when the browser server will expire the session
+	if expiresAt := browserSession.ExpiresAt.Time(); !expiresAt.IsZero() {
+		opts.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
 	}
 
 	// Create database session using browser session details
@@ -178,7 +269,7 @@ func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
 		userAgentPtr = browserSession.UserAgent
 	}
 
-	dbSession, err := s.db.CreateSession(
+	dbSession, err := s.db.CreateSessionWithOptions(
 		ctx, 
 		userID, 
 		sessionName,
@@ -189,12 +280,22 @@ func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
 		browserSession.ViewportSize.Width,
 		browserSession.ViewportSize.Height,
 		userAgentPtr,
+		opts,
 	)
 	if err != nil {
 		// Try to cleanup the browser session
-		_ = browserClient.DeleteSession(ctx, browserSession.ID)
+		_ = s.browsers.NodeClient(browserSession.Node).DeleteSession(ctx, browserSession.ID)
 
-		log.Printf("Failed to record session in database: %v", err)
+		if errors.Is(err, database.ErrOrgQuotaReached) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(database.APIResponse{
+				Error: "Organization active session quota reached",
+				Data:  nil,
+			})
+			return
+		}
+		logger.ErrorContext(ctx, "Failed to record session", "user_id", userID, "error", err)
+		s.emitSessionEvent(ctx, userID, webhook.EventSessionFailed, nil, "Could not create session")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(database.APIResponse{
 			Error: "Could not create session",
@@ -203,6 +304,11 @@ func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.emitSessionEvent(ctx, userID, webhook.EventSessionStarted, dbSession, "")
+	if dbSession.OrgID.Valid {
+		s.auditOrg(ctx, dbSession.OrgID.UUID, userID, database.AuditOrgSessionCreated, uuid.Nil, dbSession.ID, "")
+	}
+
 	// Return success response
 	json.NewEncoder(w).Encode(database.APIResponse{
 		Error: "",
@@ -212,7 +318,56 @@ func (s *Server) CreateSessionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetUserSessionsHandler retrieves all sessions for the authenticated user
+// parseSessionFilter reads the session list filters from the query string:
+// status (active or stopped), browser_type, and from/to bounds on the start
+// time given as RFC 3339 timestamps or YYYY-MM-DD dates. A timestamp to is
+// exclusive, while a date to includes that whole day (UTC), as it does in
+// usage reports: from=2024-03-01&to=2024-03-31 covers all of March.
+func parseSessionFilter(r *http.Request, userID uuid.UUID) (database.SessionFilter, error) {
+	query := r.URL.Query()
+	filter := database.SessionFilter{
+		UserID:      userID,
+		Status:      database.SessionStatus(query.Get("status")),
+		BrowserType: query.Get("browser_type"),
+	}
+
+	switch filter.Status {
+	case database.SessionStatusAny, database.SessionStatusActive, database.SessionStatusStopped:
+	default:
+		return filter, errors.New("status must be active or stopped")
+	}
+
+	var err error
+	if filter.StartedAfter, err = parseTimeParam(query.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("from: %w", err)
+	}
+	if filter.StartedBefore, err = parseTimeParam(query.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("to: %w", err)
+	}
+	return filter, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date, returning
+// the zero time for an empty value. A date is the start of that day (UTC), or
+// the start of the next day when endOfDay is set so the date is included.
+func parseTimeParam(v string, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.New("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+// GetUserSessionsHandler retrieves the authenticated user's sessions matching
+// the optional filters
 func (s *Server) GetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -223,9 +378,19 @@ func (s *Server) GetUserSessionsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	filter, err := parseSessionFilter(r, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(database.APIResponse{
+			Error: err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+
 	// Get sessions from database
 	ctx := context.Background()
-	sessions, err := s.db.GetSessionsByUserID(ctx, userID)
+	sessions, err := s.db.ListSessions(ctx, filter)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(database.APIResponse{
@@ -285,27 +450,25 @@ func (s *Server) StopSessionHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get session first to get browser ID
 	ctx := r.Context()
-	session, err := s.db.GetSessionByID(ctx, sessionID, userID)
+	session, access, err := s.db.GetSessionAccess(ctx, sessionID, userID)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(database.APIResponse{
-			Error: err.Error(),
-			Data:  nil,
-		})
+		writeSessionAccessError(w, r, sessionID, err)
 		return
 	}
 
-	// Stop session in browser server if it's active
-	if !session.StoppedAt.Valid && session.BrowserID != "" {
-		browserClient := browser.NewClient()
-		if err := browserClient.DeleteSession(ctx, session.BrowserID); err != nil {
-			// Log but continue - we still want to mark the session as stopped
-			log.Printf("Failed to stop browser session %s: %v", session.BrowserID, err)
-		}
+	// Owners and users with control access may stop a session
+	if !access.Allows(database.AccessControl) {
+		writeError(w, http.StatusForbidden, "Insufficient access to session")
+		return
+	}
+	// The browser isn't known until the launch completes
+	if waitingForLaunch(session) {
+		writeError(w, http.StatusConflict, "Session is still launching")
+		return
 	}
 
-	// Stop session in database
-	stoppedSession, err := s.db.StopSession(ctx, sessionID, userID)
+	// Stop the browser and the session on behalf of the owner
+	stoppedSession, err := s.stopSession(ctx, session)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(database.APIResponse{
@@ -314,6 +477,9 @@ func (s *Server) StopSessionHandler(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if session.OrgID.Valid {
+		s.auditOrg(ctx, session.OrgID.UUID, userID, database.AuditOrgSessionStopped, uuid.Nil, session.ID, "")
+	}
 
 	// Return success response
 	json.NewEncoder(w).Encode(database.APIResponse{
@@ -324,7 +490,8 @@ func (s *Server) StopSessionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// DeleteSessionHandler permanently deletes a session
+// DeleteSessionHandler archives a session; the purge job removes it once the
+// retention window has passed
 func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -359,26 +526,28 @@ func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get session first to get browser ID
 	ctx := r.Context()
-	session, err := s.db.GetSessionByID(ctx, sessionID, userID)
+	session, access, err := s.db.GetSessionAccess(ctx, sessionID, userID)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(database.APIResponse{
-			Error: err.Error(),
-			Data:  nil,
-		})
+		writeSessionAccessError(w, r, sessionID, err)
+		return
+	}
+
+	// Only the owner may delete a session
+	if access != database.AccessOwner {
+		writeError(w, http.StatusForbidden, "Only the session owner can delete it")
 		return
 	}
 
 	// Delete session in browser server if it exists
 	if session.BrowserID != "" {
-		browserClient := browser.NewClient()
+		browserClient := s.browsers.NodeClient(session.BrowserNode)
 		if err := browserClient.DeleteSession(ctx, session.BrowserID); err != nil {
-			// Log but continue - we still want to delete the database record
-			log.Printf("Failed to delete browser session %s: %v", session.BrowserID, err)
+			// Log but continue - we still want to archive the database record
+			logger.ErrorContext(ctx, "Failed to delete browser session", "session_id", session.ID, "browser_id", session.BrowserID, "error", err)
 		}
 	}
 
-	// Delete session from database
+	// Archive session in database
 	err = s.db.DeleteSession(ctx, sessionID, userID)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -389,6 +558,14 @@ func (s *Server) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.sessionUpdates.notify(sessionID)
+
+	// Deleting an active session stops it
+	if !session.StoppedAt.Valid {
+		session.StoppedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		s.emitSessionEvent(ctx, userID, webhook.EventSessionStopped, session, "")
+	}
+
 	// Return success response
 	json.NewEncoder(w).Encode(database.APIResponse{
 		Error: "",
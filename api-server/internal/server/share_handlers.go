@@ -0,0 +1,274 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/database"
+)
+
+// CreateShareRequest grants another registered user access to a session
+type CreateShareRequest struct {
+	Email     string     `json:"email"`
+	Access    string     `json:"access"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ShareResponse struct {
+	Share *database.SessionShareView `json:"share"`
+}
+
+type SharesResponse struct {
+	Shares []*database.SessionShareView `json:"shares"`
+}
+
+// sessionViewFor converts a session to its public view for a caller with the
+// given access. View-only users don't get the CDP URL since it grants control.
+func sessionViewFor(session *database.Session, access database.AccessLevel) *database.SessionView {
+	view := session.ToView()
+	if !access.Allows(database.AccessControl) {
+		view.CdpURL = ""
+	}
+	return view
+}
+
+// GetSessionHandler returns a single session the caller owns or has been
+// granted. The wait query parameter long-polls a pending session for up to
+// that long until its browser has launched or failed.
+func (s *Server) GetSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	wait, err := parseWait(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session, access, err := s.db.GetSessionAccess(r.Context(), sessionID, userID)
+	if err != nil {
+		writeSessionAccessError(w, r, sessionID, err)
+		return
+	}
+
+	// With wait, a pending session is held until its browser has launched
+	if wait > 0 && waitingForLaunch(session) {
+		session, access, err = s.waitForLaunch(w, r, session, access, wait)
+		if err != nil {
+			if r.Context().Err() == nil {
+				writeSessionAccessError(w, r, sessionID, err)
+			}
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, CreateSessionResponse{
+		Session: sessionViewFor(session, access),
+	})
+}
+
+// GetSharedSessionsHandler lists sessions other users have shared with the caller
+func (s *Server) GetSharedSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shared, err := s.db.GetSessionsSharedWithUser(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve sessions")
+		return
+	}
+
+	sessionViews := make([]*database.SessionView, 0, len(shared))
+	for _, sh := range shared {
+		sessionViews = append(sessionViews, sessionViewFor(sh.Session, sh.Access))
+	}
+
+	writeJSON(w, http.StatusOK, SessionsResponse{
+		Sessions: sessionViews,
+	})
+}
+
+// CreateSessionShareHandler grants another user view or control access to a session
+func (s *Server) CreateSessionShareHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	access := database.AccessLevel(req.Access)
+	if access != database.AccessView && access != database.AccessControl {
+		writeError(w, http.StatusBadRequest, "access must be view or control")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	ctx := r.Context()
+	if !s.requireSessionOwner(w, r, sessionID, userID) {
+		return
+	}
+
+	grantee, err := s.db.GetUserByEmail(ctx, strings.TrimSpace(req.Email))
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Could not look up user")
+		return
+	}
+	if grantee.ID == userID {
+		writeError(w, http.StatusBadRequest, "cannot share a session with yourself")
+		return
+	}
+
+	share := &database.SessionShare{
+		SessionID: sessionID,
+		UserID:    grantee.ID,
+		Access:    access,
+		CreatedBy: userID,
+	}
+	if req.ExpiresAt != nil {
+		share.ExpiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	if err := s.db.CreateSessionShare(ctx, share); err != nil {
+		logger.ErrorContext(ctx, "Failed to share session", "session_id", sessionID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not share session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ShareResponse{
+		Share: share.ToView(),
+	})
+}
+
+// ListSessionSharesHandler lists the active grants on a session the caller owns
+func (s *Server) ListSessionSharesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.requireSessionOwner(w, r, sessionID, userID) {
+		return
+	}
+
+	shares, err := s.db.GetSessionShares(r.Context(), sessionID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve shares")
+		return
+	}
+
+	shareViews := make([]*database.SessionShareView, 0, len(shares))
+	for _, share := range shares {
+		shareViews = append(shareViews, share.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, SharesResponse{
+		Shares: shareViews,
+	})
+}
+
+// RevokeSessionShareHandler revokes a grant on a session the caller owns
+func (s *Server) RevokeSessionShareHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := parseUUIDParam(r, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	shareID, err := parseUUIDParam(r, "shareID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.requireSessionOwner(w, r, sessionID, userID) {
+		return
+	}
+
+	if err := s.db.RevokeSessionShare(r.Context(), sessionID, shareID); err != nil {
+		if errors.Is(err, database.ErrShareNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logger.ErrorContext(r.Context(), "Failed to revoke share", "session_id", sessionID, "share_id", shareID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not revoke share")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// requireSessionOwner writes an error response and returns false unless
+// userID owns the session
+func (s *Server) requireSessionOwner(w http.ResponseWriter, r *http.Request, sessionID, userID uuid.UUID) bool {
+	_, access, err := s.db.GetSessionAccess(r.Context(), sessionID, userID)
+	if err != nil {
+		writeSessionAccessError(w, r, sessionID, err)
+		return false
+	}
+	if access != database.AccessOwner {
+		writeError(w, http.StatusForbidden, "Only the session owner can manage shares")
+		return false
+	}
+	return true
+}
+
+// writeSessionAccessError writes the response for a failed GetSessionAccess:
+// 404 when the caller has no access to the session, and a logged 500 when it
+// couldn't be read
+func writeSessionAccessError(w http.ResponseWriter, r *http.Request, sessionID uuid.UUID, err error) {
+	if errors.Is(err, database.ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	logger.ErrorContext(r.Context(), "Failed to retrieve session", "session_id", sessionID, "error", err)
+	writeError(w, http.StatusInternalServerError, "Could not retrieve session")
+}
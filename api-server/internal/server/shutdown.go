@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// Shutdown policies for the sessions an instance owns, selected with
+// SHUTDOWN_SESSION_POLICY
+const (
+	// ShutdownLeave leaves sessions running and owned by the exiting
+	// instance, to be picked up again when it restarts with the same
+	// INSTANCE_ID
+	ShutdownLeave = "leave"
+	// ShutdownStop stops the sessions the instance created
+	ShutdownStop = "stop"
+	// ShutdownHandoff leaves sessions running without an owner, for another
+	// instance to adopt
+	ShutdownHandoff = "handoff"
+)
+
+// shutdownStopWorkers bounds how many sessions the stop policy stops at once
+const shutdownStopWorkers = 8
+
+// defaultInstanceID is the instance ID used when INSTANCE_ID isn't set: the
+// hostname, which is stable across restarts of a container or pod, or a
+// random ID
+func defaultInstanceID() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return uuid.NewString()
+}
+
+// Stop winds the server down once it has stopped serving HTTP: it stops the
+// background jobs, applies the shutdown policy to this instance's sessions,
+// flushes telemetry and closes the database, giving up on whatever is left
+// when ctx expires
+func (s *Server) Stop(ctx context.Context) error {
+	var errs []error
+	if err := s.StopBackgroundJobs(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("background jobs did not stop: %w", err))
+	}
+	if err := s.applyShutdownPolicy(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.flushTelemetry(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// applyShutdownPolicy stops or hands off the sessions owned by this instance,
+// as configured
+func (s *Server) applyShutdownPolicy(ctx context.Context) error {
+	switch s.shutdownPolicy {
+	case ShutdownStop:
+		return s.stopInstanceSessions(ctx)
+	case ShutdownHandoff:
+		released, err := s.db.ReleaseInstanceSessions(ctx, s.instanceID)
+		if err != nil {
+			return fmt.Errorf("failed to hand off sessions: %w", err)
+		}
+		logger.InfoContext(ctx, "Handed off sessions", "instance_id", s.instanceID, "count", released)
+	}
+	return nil
+}
+
+// stopInstanceSessions stops every active session owned by this instance
+func (s *Server) stopInstanceSessions(ctx context.Context) error {
+	sessions, err := s.db.ListInstanceSessions(ctx, s.instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions to stop: %w", err)
+	}
+
+	var mu sync.Mutex
+	var failed int
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, shutdownStopWorkers)
+	for _, session := range sessions {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if _, err := s.stopSession(ctx, session); err != nil {
+				logger.ErrorContext(ctx, "Failed to stop session on shutdown", "session_id", session.ID, "error", err)
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	logger.InfoContext(ctx, "Stopped sessions", "instance_id", s.instanceID, "count", len(sessions)-failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d of %d sessions", failed, len(sessions))
+	}
+	return nil
+}
+
+// stopSession shuts down an active session's browser, marks the session
+// stopped and emits its stopped event. A browser that can't be shut down is
+// logged and left to expire on the browser server.
+func (s *Server) stopSession(ctx context.Context, session *database.Session) (*database.Session, error) {
+	if !session.StoppedAt.Valid && session.BrowserID != "" {
+		browserClient := s.browsers.NodeClient(session.BrowserNode)
+		if err := browserClient.DeleteSession(ctx, session.BrowserID); err != nil {
+			// Log but continue - we still want to mark the session as stopped
+			logger.ErrorContext(ctx, "Failed to stop browser session", "session_id", session.ID, "browser_id", session.BrowserID, "error", err)
+		}
+	}
+
+	// Stop session in database on behalf of the owner
+	stopped, err := s.db.StopSession(ctx, session.ID, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sessionUpdates.notify(session.ID)
+	s.emitSessionEvent(ctx, session.UserID, webhook.EventSessionStopped, stopped, "")
+	return stopped, nil
+}
+
+// adoptOrphanedSessions takes ownership of sessions handed off by instances
+// that shut down
+func (s *Server) adoptOrphanedSessions(ctx context.Context) {
+	adopted, err := s.db.AdoptOrphanedSessions(ctx, s.instanceID)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to adopt orphaned sessions", "error", err)
+		}
+		return
+	}
+	if adopted > 0 {
+		logger.InfoContext(ctx, "Adopted orphaned sessions", "instance_id", s.instanceID, "count", adopted)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"api-server/internal/config"
+	"api-server/internal/telemetry"
+)
+
+// newTelemetry builds the configured telemetry provider. A provider that
+// fails to start is logged and replaced by a no-op one, so a monitoring
+// outage never keeps the API down; an unknown provider is an error.
+func newTelemetry(cfg config.Telemetry) (telemetry.Provider, error) {
+	provider, err := telemetry.New(cfg)
+	if err != nil {
+		if cfg.Provider != telemetry.ProviderNewRelic {
+			return nil, err
+		}
+		logger.Warn("Failed to start telemetry provider, continuing without it", "provider", cfg.Provider, "error", err)
+		return telemetry.Noop{}, nil
+	}
+
+	logger.Info("Reporting telemetry", "provider", provider.Name())
+	return provider, nil
+}
+
+// flushTelemetry sends telemetry still buffered by the provider
+func (s *Server) flushTelemetry(ctx context.Context) error {
+	if s.telemetry == nil {
+		return nil
+	}
+	if err := s.telemetry.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to flush telemetry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/database"
+)
+
+// Usage report settings
+var (
+	// defaultUsageDays is the report range when from isn't given
+	defaultUsageDays = 30
+	// maxUsageDays caps the range of a single report
+	maxUsageDays = 366
+)
+
+type UsageResponse struct {
+	From                string                `json:"from"`
+	To                  string                `json:"to"`
+	TotalBrowserMinutes float64               `json:"total_browser_minutes"`
+	Usage               []*database.UsageView `json:"usage"`
+}
+
+// parseUsageRange reads the inclusive from/to days (YYYY-MM-DD) of a usage
+// report, matching a date to in the session filters. To defaults to today and
+// from to defaultUsageDays before it.
+func parseUsageRange(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -(defaultUsageDays - 1))
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) >= time.Duration(maxUsageDays)*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range must not exceed %d days", maxUsageDays)
+	}
+	return from, to, nil
+}
+
+// GetUsageHandler reports the caller's daily browser usage per browser type
+func (s *Server) GetUsageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.writeUsageReport(w, r, uuid.NullUUID{UUID: userID, Valid: true}, false)
+}
+
+// GetAdminUsageHandler reports daily browser usage for every user, or for the
+// user given by the user_id query parameter
+func (s *Server) GetAdminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	var userID uuid.NullUUID
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		userID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	s.writeUsageReport(w, r, userID, true)
+}
+
+// writeUsageReport writes the usage matching userID as JSON, or as CSV when
+// the format query parameter is csv
+func (s *Server) writeUsageReport(w http.ResponseWriter, r *http.Request, userID uuid.NullUUID, withUser bool) {
+	from, to, err := parseUsageRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	records, err := s.db.GetUsage(r.Context(), database.UsageFilter{
+		UserID: userID,
+		From:   from,
+		To:     to,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve usage")
+		return
+	}
+
+	views := make([]*database.UsageView, 0, len(records))
+	var total float64
+	for _, rec := range records {
+		view := rec.ToView(withUser)
+		total += view.BrowserMinutes
+		views = append(views, view)
+	}
+
+	if format == "csv" {
+		writeUsageCSV(w, from, to, views, withUser)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, UsageResponse{
+		From:                from.Format(time.DateOnly),
+		To:                  to.Format(time.DateOnly),
+		TotalBrowserMinutes: total,
+		Usage:               views,
+	})
+}
+
+// writeUsageCSV writes usage rows as a CSV attachment
+func writeUsageCSV(w http.ResponseWriter, from, to time.Time, views []*database.UsageView, withUser bool) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="usage_%s_%s.csv"`,
+		from.Format(time.DateOnly), to.Format(time.DateOnly)))
+
+	cw := csv.NewWriter(w)
+	header := []string{"day", "browser_type", "sessions", "browser_minutes"}
+	if withUser {
+		header = append([]string{"day", "user_id", "user_email"}, header[1:]...)
+	}
+	_ = cw.Write(header)
+
+	for _, v := range views {
+		row := []string{
+			v.Day,
+			v.BrowserType,
+			strconv.Itoa(v.Sessions),
+			strconv.FormatFloat(v.BrowserMinutes, 'f', 2, 64),
+		}
+		if withUser {
+			row = append([]string{v.Day, v.UserID, v.UserEmail}, row[1:]...)
+		}
+		_ = cw.Write(row)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logger.Error("Failed to write usage CSV", "error", err)
+	}
+}
+
+// rollupUsage refreshes the usage rollups (UTC) from the day before the last
+// rollup ended to today, which catches up on days no instance rolled up; the
+// first rollup starts from the earliest session. At least yesterday is
+// included so sessions that ran past midnight get their final totals.
+func (s *Server) rollupUsage(ctx context.Context) {
+	now := time.Now().UTC()
+	from := now.Truncate(24*time.Hour).AddDate(0, 0, -1)
+
+	last, err := s.db.UsageRolledUpTo(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to read usage rollup progress", "error", err)
+		}
+		return
+	}
+	if start := last.Time.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1); last.Valid && start.Before(from) {
+		from = start
+	}
+
+	if err := s.db.RollupUsage(ctx, from, now); err != nil && ctx.Err() == nil {
+		logger.ErrorContext(ctx, "Failed to roll up usage", "error", err)
+	}
+}
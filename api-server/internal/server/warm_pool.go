@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-server/internal/browser"
+)
+
+// warmPoolMetricsInterval is how often warm pool counts are reported to the
+// telemetry provider
+var warmPoolMetricsInterval = time.Minute
+
+// newWarmPool builds the warm pool described by spec, e.g.
+// "firefox:headed=2,chromium:headless=1". It returns nil when no browsers are
+// to be kept warm.
+func (s *Server) newWarmPool(spec string) (*browser.WarmPool, error) {
+	specs, err := browser.ParseWarmSpecs(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WARM_POOL: %w", err)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	logger.Info("Keeping warm browsers", "warm_pool", spec, "max_idle", s.warmPoolMaxIdle.String())
+	viewport := browser.ViewportSize{Width: s.defaultViewportW, Height: s.defaultViewportH}
+	return browser.NewWarmPool(s.browsers.Client(), specs, viewport, s.defaultTimeout, s.warmPoolMaxIdle), nil
+}
+
+// browserClient returns the client new sessions are launched with, which
+// claims a pre-launched browser when the warm pool has a compatible one
+func (s *Server) browserClient() browser.BrowserClient {
+	if s.warmPool != nil {
+		return s.warmPool
+	}
+	return s.browsers.Client()
+}
+
+// recordWarmPoolMetrics reports the unclaimed and claimed counts of each kind
+// of warm browser as custom metrics of the telemetry provider
+func (s *Server) recordWarmPoolMetrics(ctx context.Context) {
+	for _, stats := range s.warmPool.Stats() {
+		mode := "headed"
+		if stats.Headless {
+			mode = "headless"
+		}
+		prefix := fmt.Sprintf("WarmPool/%s/%s/", stats.BrowserType, mode)
+		s.telemetry.RecordMetric(prefix+"Unclaimed", float64(stats.Unclaimed))
+		s.telemetry.RecordMetric(prefix+"Claimed", float64(stats.Claimed))
+	}
+}
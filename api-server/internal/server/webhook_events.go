@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// webhookBatchSize is how many deliveries are claimed at once
+var webhookBatchSize = 20
+
+// WebhookPayload is the JSON body of every webhook delivery
+type WebhookPayload struct {
+	ID        string           `json:"id"`
+	Event     string           `json:"event"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookEventData describes the session an event is about. Session is nil
+// when a session failed before it was recorded.
+type WebhookEventData struct {
+	Session *database.SessionView `json:"session"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// emitSessionEvent queues an event for the user's webhook endpoints. Failures
+// are logged rather than returned so they never fail the request that caused
+// the event.
+func (s *Server) emitSessionEvent(ctx context.Context, userID uuid.UUID, event string, session *database.Session, errMsg string) {
+	s.metrics.recordSessionEvent(event, session)
+
+	payload := WebhookPayload{
+		ID:        uuid.New().String(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      WebhookEventData{Error: errMsg},
+	}
+	if session != nil {
+		// The CDP URL grants control of the browser so it is never sent out
+		payload.Data.Session = sessionViewFor(session, database.AccessView)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to encode webhook", "event", event, "error", err)
+		return
+	}
+
+	// Queue the event even if the client has already gone away
+	if _, err := s.db.EnqueueWebhookEvent(context.WithoutCancel(ctx), userID, event, body); err != nil {
+		logger.ErrorContext(ctx, "Failed to queue webhook", "event", event, "user_id", userID, "error", err)
+	}
+}
+
+// dispatchWebhooks sends every due delivery, a batch at a time
+func (s *Server) dispatchWebhooks(ctx context.Context) {
+	// Claimed deliveries are hidden from other dispatchers for longer than a
+	// whole batch can take to send
+	lease := time.Duration(webhookBatchSize+1) * s.webhookTimeout
+
+	for ctx.Err() == nil {
+		deliveries, err := s.db.ClaimWebhookDeliveries(ctx, webhookBatchSize, lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.ErrorContext(ctx, "Failed to claim webhook deliveries", "error", err)
+			}
+			return
+		}
+
+		for _, d := range deliveries {
+			s.deliverWebhook(ctx, d)
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliverWebhook makes one delivery attempt and records the outcome,
+// scheduling a retry with exponential backoff on failure
+func (s *Server) deliverWebhook(ctx context.Context, d *database.WebhookDelivery) {
+	// lastError is what the endpoint's owner sees in the delivery log, so the
+	// full error is only logged
+	var status int
+	var lastError string
+	secret, err := s.secrets.Decrypt(d.SecretEncrypted)
+	if err != nil {
+		lastError = "Could not sign delivery"
+	} else {
+		status, err = s.webhookSender.Send(ctx, webhook.Delivery{
+			ID:     d.ID.String(),
+			Event:  d.Event,
+			URL:    d.EndpointURL,
+			Secret: secret,
+			Body:   d.Payload,
+		})
+		if err != nil {
+			lastError = webhook.ErrorMessage(err)
+		}
+	}
+
+	// Shutting down; the lease runs out and the delivery is retried later
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.WarnContext(ctx, "Webhook delivery failed", "delivery_id", d.ID, "endpoint_id", d.EndpointID, "error", err)
+	}
+
+	d.Attempts++
+	d.ResponseStatus = sql.NullInt64{Int64: int64(status), Valid: status != 0}
+	switch {
+	case err == nil:
+		d.Status = database.DeliverySucceeded
+		d.LastError = sql.NullString{}
+	case d.Attempts >= webhook.MaxAttempts:
+		d.Status = database.DeliveryFailed
+		d.LastError = sql.NullString{String: lastError, Valid: true}
+	default:
+		d.Status = database.DeliveryPending
+		d.NextAttemptAt = time.Now().Add(webhook.Backoff(d.Attempts))
+		d.LastError = sql.NullString{String: lastError, Valid: true}
+	}
+
+	if err := s.db.CompleteWebhookDelivery(ctx, d); err != nil {
+		logger.ErrorContext(ctx, "Failed to record webhook delivery", "delivery_id", d.ID, "error", err)
+	}
+}
+
+// expireSessions marks sessions the browser server has expired as stopped,
+// emits session.expired for each and returns how many expired
+func (s *Server) expireSessions(ctx context.Context) (int, error) {
+	expired, err := s.db.ExpireSessions(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.ErrorContext(ctx, "Failed to expire sessions", "error", err)
+		}
+		return 0, err
+	}
+
+	for _, session := range expired {
+		s.sessionUpdates.notify(session.ID)
+		s.emitSessionEvent(ctx, session.UserID, webhook.EventSessionExpired, session, "")
+	}
+	return len(expired), nil
+}
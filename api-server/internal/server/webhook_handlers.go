@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-server/internal/database"
+	"api-server/internal/webhook"
+)
+
+// CreateWebhookRequest registers a webhook endpoint
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// Events to subscribe to; empty subscribes to every event
+	Events []string `json:"events,omitempty"`
+}
+
+type WebhookResponse struct {
+	Webhook *database.WebhookEndpointView `json:"webhook"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []*database.WebhookEndpointView `json:"webhooks"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []*database.WebhookDeliveryView `json:"deliveries"`
+}
+
+type WebhookDeliveryResponse struct {
+	Delivery *database.WebhookDeliveryView `json:"delivery"`
+}
+
+// validate checks the request and returns its de-duplicated event list
+func (req CreateWebhookRequest) validate(ctx context.Context, allowPrivate bool) ([]string, error) {
+	if err := webhook.ValidateURL(ctx, strings.TrimSpace(req.URL), allowPrivate); err != nil {
+		return nil, err
+	}
+
+	events := []string{}
+	seen := map[string]bool{}
+	for _, e := range req.Events {
+		if !webhook.ValidEvent(e) {
+			return nil, fmt.Errorf("unknown event %q, must be one of %s", e, strings.Join(webhook.Events, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// loadWebhook writes an error response and returns nil unless the endpoint
+// named by the webhookID URL parameter belongs to the caller
+func (s *Server) loadWebhook(w http.ResponseWriter, r *http.Request) *database.WebhookEndpoint {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	webhookID, err := parseUUIDParam(r, "webhookID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	endpoint, err := s.db.GetWebhookEndpoint(r.Context(), webhookID, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "Could not retrieve webhook")
+		return nil
+	}
+	return endpoint
+}
+
+// CreateWebhookHandler registers a webhook endpoint for the caller. The
+// signing secret is only returned in this response.
+func (s *Server) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	events, err := req.validate(r.Context(), s.webhookAllowPrivate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not create webhook")
+		return
+	}
+	encrypted, err := s.secrets.Encrypt(secret)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encrypt webhook secret", "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not store webhook secret")
+		return
+	}
+
+	endpoint := &database.WebhookEndpoint{
+		UserID:          userID,
+		URL:             strings.TrimSpace(req.URL),
+		SecretEncrypted: encrypted,
+		Events:          events,
+	}
+	if err := s.db.CreateWebhookEndpoint(r.Context(), endpoint); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to create webhook", "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not create webhook")
+		return
+	}
+
+	view := endpoint.ToView()
+	view.Secret = secret
+	writeJSON(w, http.StatusOK, WebhookResponse{
+		Webhook: view,
+	})
+}
+
+// ListWebhooksHandler lists the caller's webhook endpoints
+func (s *Server) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := GetUserIDFromContext(r.Context())
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	endpoints, err := s.db.GetWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve webhooks")
+		return
+	}
+
+	views := make([]*database.WebhookEndpointView, 0, len(endpoints))
+	for _, e := range endpoints {
+		views = append(views, e.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, WebhooksResponse{
+		Webhooks: views,
+	})
+}
+
+// DeleteWebhookHandler removes one of the caller's webhook endpoints
+func (s *Server) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.loadWebhook(w, r)
+	if endpoint == nil {
+		return
+	}
+
+	if err := s.db.DeleteWebhookEndpoint(r.Context(), endpoint.ID, endpoint.UserID); err != nil {
+		if errors.Is(err, database.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		logger.ErrorContext(r.Context(), "Failed to delete webhook", "webhook_id", endpoint.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Could not delete webhook")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+// ListWebhookDeliveriesHandler returns the delivery log of a webhook endpoint,
+// newest first. The limit query parameter defaults to 50 and is capped at 200.
+func (s *Server) ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.loadWebhook(w, r)
+	if endpoint == nil {
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, 200)
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveries(r.Context(), endpoint.ID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Could not retrieve deliveries")
+		return
+	}
+
+	views := make([]*database.WebhookDeliveryView, 0, len(deliveries))
+	for _, d := range deliveries {
+		views = append(views, d.ToView())
+	}
+
+	writeJSON(w, http.StatusOK, WebhookDeliveriesResponse{
+		Deliveries: views,
+	})
+}
+
+// ReplayWebhookDeliveryHandler queues a delivery to be sent again
+func (s *Server) ReplayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.loadWebhook(w, r)
+	if endpoint == nil {
+		return
+	}
+
+	deliveryID, err := parseUUIDParam(r, "deliveryID")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	delivery, err := s.db.ReplayWebhookDelivery(r.Context(), endpoint.ID, deliveryID)
+	if err != nil {
+		if errors.Is(err, database.ErrDeliveryNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Could not replay delivery")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, WebhookDeliveryResponse{
+		Delivery: delivery.ToView(),
+	})
+}
@@ -0,0 +1,86 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+
+	"api-server/internal/config"
+)
+
+// newRelic reports transactions, datastore segments and custom metrics to New
+// Relic
+type newRelic struct {
+	app *newrelic.Application
+}
+
+func newNewRelic(cfg config.Telemetry) (*newRelic, error) {
+	if cfg.NewRelicLicense == "" {
+		return nil, errors.New("the newrelic telemetry provider needs NEW_RELIC_LICENSE_KEY or NEW_RELIC_LICENSE_KEY_FILE")
+	}
+	app, err := newrelic.NewApplication(
+		newrelic.ConfigAppName(cfg.NewRelicAppName),
+		newrelic.ConfigLicense(cfg.NewRelicLicense),
+		newrelic.ConfigDistributedTracerEnabled(true),
+		newrelic.ConfigAppLogForwardingEnabled(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize New Relic: %w", err)
+	}
+	return &newRelic{app: app}, nil
+}
+
+func (p *newRelic) Name() string { return ProviderNewRelic }
+
+// Middleware starts a transaction for every request and stores it in the
+// request context, where database segments find it
+func (p *newRelic) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		txn := p.app.StartTransaction(r.URL.Path)
+		defer txn.End()
+
+		r = newrelic.RequestWithTransactionContext(r, txn)
+		// Use a wrapped response writer that reports to New Relic
+		w = txn.SetWebResponse(w)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *newRelic) StartSegment(ctx context.Context, operation string) *Segment {
+	txn := newrelic.FromContext(ctx)
+	if txn == nil {
+		return nil
+	}
+
+	started := txn.StartSegmentNow()
+	return &Segment{
+		Operation: operation,
+		end: func(s *Segment) {
+			segment := &newrelic.DatastoreSegment{
+				Product:    newrelic.DatastorePostgres,
+				Collection: s.Collection,
+				Operation:  s.Operation,
+				StartTime:  started,
+			}
+			segment.End()
+		},
+	}
+}
+
+// RecordMetric records a custom metric, which New Relic names Custom/<name>
+func (p *newRelic) RecordMetric(name string, value float64) {
+	p.app.RecordCustomMetric(name, value)
+}
+
+func (p *newRelic) Shutdown(ctx context.Context) error {
+	timeout := 10 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	p.app.Shutdown(timeout)
+	return nil
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// openTelemetry records custom metrics as OpenTelemetry gauges on a meter
+// provider, the global one installed by tracing.Setup in the server. Requests and database calls are already traced as
+// OpenTelemetry spans whatever the provider, so it adds no transactions or
+// segments of its own.
+type openTelemetry struct {
+	provider metric.MeterProvider
+	meter    metric.Meter
+
+	mu     sync.Mutex
+	gauges map[string]metric.Float64Gauge
+}
+
+func newOTel(provider metric.MeterProvider) *openTelemetry {
+	return &openTelemetry{
+		provider: provider,
+		meter:    provider.Meter("api-server"),
+		gauges:   make(map[string]metric.Float64Gauge),
+	}
+}
+
+func (p *openTelemetry) Name() string { return ProviderOTel }
+
+func (p *openTelemetry) Middleware(next http.Handler) http.Handler { return next }
+
+func (p *openTelemetry) StartSegment(context.Context, string) *Segment { return nil }
+
+func (p *openTelemetry) RecordMetric(name string, value float64) {
+	p.mu.Lock()
+	gauge, ok := p.gauges[name]
+	if !ok {
+		var err error
+		if gauge, err = p.meter.Float64Gauge(name); err != nil {
+			p.mu.Unlock()
+			return
+		}
+		p.gauges[name] = gauge
+	}
+	p.mu.Unlock()
+
+	gauge.Record(context.Background(), value)
+}
+
+// Shutdown exports the gauges recorded since the last export. The meter
+// provider itself is stopped by whoever installed it.
+func (p *openTelemetry) Shutdown(ctx context.Context) error {
+	if flusher, ok := p.provider.(interface{ ForceFlush(context.Context) error }); ok {
+		return flusher.ForceFlush(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package telemetry reports request transactions, database segments and
+// custom metrics to the APM backend chosen by configuration
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+
+	"api-server/internal/config"
+)
+
+// Providers selectable with TELEMETRY_PROVIDER
+const (
+	ProviderNewRelic = "newrelic"
+	ProviderOTel     = "otel"
+	ProviderNone     = "none"
+)
+
+// Provider reports telemetry to an APM backend
+type Provider interface {
+	// Name is the provider's TELEMETRY_PROVIDER value
+	Name() string
+	// Middleware records a transaction for every request it handles
+	Middleware(next http.Handler) http.Handler
+	// StartSegment starts timing a database call made within the transaction
+	// carried by ctx. It returns nil when there is nothing to record into.
+	StartSegment(ctx context.Context, operation string) *Segment
+	// RecordMetric records a value of a custom metric such as
+	// "WarmPool/chromium/headless/Unclaimed"
+	RecordMetric(name string, value float64)
+	// Shutdown flushes buffered data, waiting at most until ctx expires
+	Shutdown(ctx context.Context) error
+}
+
+// Segment times one database call. Collection may be set until End is
+// called.
+type Segment struct {
+	Operation  string
+	Collection string
+
+	end func(*Segment)
+}
+
+// End records the segment
+func (s *Segment) End() {
+	if s != nil && s.end != nil {
+		s.end(s)
+	}
+}
+
+// New returns the provider selected by cfg
+func New(cfg config.Telemetry) (Provider, error) {
+	switch cfg.Provider {
+	case ProviderNewRelic:
+		return newNewRelic(cfg)
+	case ProviderOTel:
+		return newOTel(otel.GetMeterProvider()), nil
+	case ProviderNone, "":
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown TELEMETRY_PROVIDER %q: expected newrelic, otel or none", cfg.Provider)
+	}
+}
+
+// Noop is a Provider that records nothing
+type Noop struct{}
+
+func (Noop) Name() string { return ProviderNone }
+
+func (Noop) Middleware(next http.Handler) http.Handler { return next }
+
+func (Noop) StartSegment(context.Context, string) *Segment { return nil }
+
+func (Noop) RecordMetric(string, float64) {}
+
+func (Noop) Shutdown(context.Context) error { return nil }
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"api-server/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(config.Telemetry{Provider: "datadog"})
+	require.Error(t, err)
+
+	_, err = New(config.Telemetry{Provider: ProviderNewRelic})
+	require.ErrorContains(t, err, "NEW_RELIC_LICENSE_KEY")
+
+	for _, name := range []string{ProviderNone, ProviderOTel} {
+		provider, err := New(config.Telemetry{Provider: name})
+		require.NoError(t, err)
+		require.Equal(t, name, provider.Name())
+
+		// Neither records transactions or segments of its own
+		rec := httptest.NewRecorder()
+		provider.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusTeapot, rec.Code)
+
+		segment := provider.StartSegment(context.Background(), "CreateUser")
+		require.Nil(t, segment)
+		segment.End()
+
+		provider.RecordMetric("WarmPool/chromium/headless/Unclaimed", 1)
+		require.NoError(t, provider.Shutdown(context.Background()))
+	}
+}
+
+func TestOTelRecordMetric(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := newOTel(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	provider.RecordMetric("WarmPool/chromium/headless/Unclaimed", 1)
+	provider.RecordMetric("WarmPool/chromium/headless/Unclaimed", 3)
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+
+	recorded := rm.ScopeMetrics[0].Metrics[0]
+	require.Equal(t, "WarmPool/chromium/headless/Unclaimed", recorded.Name)
+	gauge, ok := recorded.Data.(metricdata.Gauge[float64])
+	require.True(t, ok)
+	require.Len(t, gauge.DataPoints, 1)
+	// A gauge keeps the last value recorded
+	require.Equal(t, 3.0, gauge.DataPoints[0].Value)
+}
@@ -0,0 +1,146 @@
+// Package tracing sets up OpenTelemetry tracing and metric export and
+// provides helpers for recording spans
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters selectable with OTEL_TRACES_EXPORTER and OTEL_METRICS_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Tracer is the tracer spans of this service are recorded with
+var Tracer = otel.Tracer("api-server")
+
+// Setup installs the global tracer and meter providers and the W3C trace
+// context propagator. tracesExporter and metricsExporter select where spans
+// and metrics go: "otlp" sends them over OTLP/HTTP to
+// OTEL_EXPORTER_OTLP_ENDPOINT (http://localhost:4318 by default), "stdout"
+// prints them, and "none" records nothing. The returned function flushes and
+// stops both exporters.
+func Setup(ctx context.Context, tracesExporter, metricsExporter string) (func(context.Context) error, error) {
+	// Propagate trace context even when not exporting, so traces started
+	// upstream continue through to the browser server
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if isNone(tracesExporter) && isNone(metricsExporter) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("orchestrator-api")),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create telemetry resource: %w", err)
+	}
+
+	var shutdowns []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for _, fn := range shutdowns {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	if !isNone(tracesExporter) {
+		exporter, err := newSpanExporter(ctx, tracesExporter)
+		if err != nil {
+			return nil, err
+		}
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+		)
+		otel.SetTracerProvider(provider)
+		shutdowns = append(shutdowns, provider.Shutdown)
+		slog.Info("Exporting traces", "exporter", tracesExporter)
+	}
+
+	if !isNone(metricsExporter) {
+		exporter, err := newMetricExporter(ctx, metricsExporter)
+		if err != nil {
+			_ = shutdown(ctx)
+			return nil, err
+		}
+		provider := sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+			sdkmetric.WithResource(res),
+		)
+		otel.SetMeterProvider(provider)
+		shutdowns = append(shutdowns, provider.Shutdown)
+		slog.Info("Exporting metrics", "exporter", metricsExporter)
+	}
+
+	return shutdown, nil
+}
+
+func isNone(exporterName string) bool {
+	return exporterName == "" || exporterName == ExporterNone
+}
+
+func newSpanExporter(ctx context.Context, exporterName string) (sdktrace.SpanExporter, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch exporterName {
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func newMetricExporter(ctx context.Context, exporterName string) (sdkmetric.Exporter, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+	switch exporterName {
+	case ExporterOTLP:
+		exporter, err = otlpmetrichttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdoutmetric.New(stdoutmetric.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_METRICS_EXPORTER %q", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
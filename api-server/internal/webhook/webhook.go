@@ -0,0 +1,290 @@
+// Package webhook signs and sends webhook deliveries.
+//
+// Each request carries a signature header of the form
+//
+//	t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// keyed with the endpoint's secret. Receivers should recompute the HMAC and
+// reject requests whose timestamp is too old to prevent replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Session lifecycle events
+const (
+	EventSessionStarted = "session.started"
+	EventSessionStopped = "session.stopped"
+	EventSessionExpired = "session.expired"
+	EventSessionFailed  = "session.failed"
+)
+
+// Events lists every event an endpoint can subscribe to
+var Events = []string{
+	EventSessionStarted,
+	EventSessionStopped,
+	EventSessionExpired,
+	EventSessionFailed,
+}
+
+// Request headers set on every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is marked failed
+const MaxAttempts = 8
+
+var (
+	// ErrInvalidSignature is returned by Verify when the signature doesn't match
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrSignatureExpired is returned by Verify when the timestamp is outside the tolerance
+	ErrSignatureExpired = errors.New("webhook signature timestamp outside tolerance")
+	// ErrPrivateAddress is returned for endpoints on loopback, private or
+	// link-local addresses, which would let webhooks reach internal services
+	ErrPrivateAddress = errors.New("url must not point to a private, loopback or link-local address")
+)
+
+// StatusError is returned by Send when the endpoint responds with a non-2xx
+// status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("endpoint responded with status %d", e.StatusCode)
+}
+
+// ValidEvent reports whether event is a known event type
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL checks that an endpoint URL is an absolute http or https URL.
+// Unless allowPrivate is set, its host must also resolve only to public
+// addresses; Send checks the address again when it connects.
+func ValidateURL(ctx context.Context, raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("url scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return errors.New("url must include a host")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("url host %s could not be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if privateIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// privateIP reports whether ip is an address webhooks may not be sent to
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// checkDialAddress rejects connections to private addresses. It runs once the
+// host has been resolved, so a name that resolves differently than it did at
+// registration is still caught.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body sent at ts
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + computeMAC(secret, t, body)
+}
+
+// Verify checks a signature header against body. Signatures older or newer
+// than tolerance relative to now are rejected.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sig = v
+		}
+	}
+	if t == "" || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(computeMAC(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func computeMAC(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before retrying after the given number of
+// failed attempts: 30s doubling each time, capped at 6h
+func Backoff(attempts int) time.Duration {
+	const (
+		base = 30 * time.Second
+		max  = 6 * time.Hour
+	)
+	if attempts < 1 {
+		return base
+	}
+	d := time.Duration(float64(base) * math.Pow(2, float64(attempts-1)))
+	if d > max || d <= 0 {
+		return max
+	}
+	return d
+}
+
+// Delivery is a single webhook request
+type Delivery struct {
+	ID     string
+	Event  string
+	URL    string
+	Secret string
+	Body   []byte
+}
+
+// Sender posts signed deliveries
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender returns a Sender with a bounded request timeout. Redirects aren't
+// followed, and unless allowPrivate is set, connections to private addresses
+// are refused.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = checkDialAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialed address the proxy's
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Sender{Client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect is reported as the endpoint's response
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Send posts the delivery and returns the response status code. Any non-2xx
+// response is reported as an error.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "orchestrator-webhooks/1")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), d.Body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+// ErrorMessage describes an error returned by Send for the endpoint's owner.
+// Transport errors are reduced to their kind so they don't reveal anything
+// about the network the sender runs in.
+func ErrorMessage(err error) string {
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Error()
+	case errors.Is(err, ErrPrivateAddress):
+		return ErrPrivateAddress.Error()
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out"
+	default:
+		return "request failed"
+	}
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"session.started"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign("secret", now, body)
+
+	require.NoError(t, Verify("secret", header, body, 5*time.Minute, now.Add(time.Minute)))
+	require.ErrorIs(t, Verify("other", header, body, 5*time.Minute, now), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("secret", header, []byte(`{}`), 5*time.Minute, now), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("secret", header, body, 5*time.Minute, now.Add(time.Hour)), ErrSignatureExpired)
+	require.ErrorIs(t, Verify("secret", "garbage", body, 5*time.Minute, now), ErrInvalidSignature)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, Backoff(0))
+	require.Equal(t, 30*time.Second, Backoff(1))
+	require.Equal(t, time.Minute, Backoff(2))
+	require.Equal(t, 8*time.Minute, Backoff(5))
+	require.Equal(t, 6*time.Hour, Backoff(20))
+	require.Equal(t, 6*time.Hour, Backoff(200))
+}
+
+func TestValidateURL(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, ValidateURL(ctx, "https://8.8.8.8/hooks", false))
+	require.NoError(t, ValidateURL(ctx, "http://localhost:9000/x", true))
+
+	for _, raw := range []string{"", "ftp://example.com", "https://", "not a url"} {
+		require.Error(t, ValidateURL(ctx, raw, true), raw)
+	}
+
+	// Internal addresses are refused unless allowed
+	for _, raw := range []string{
+		"http://localhost:9000/x",
+		"http://127.0.0.1/x",
+		"http://10.0.0.5/x",
+		"http://192.168.1.1/x",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/x",
+		"http://0.0.0.0/x",
+	} {
+		require.ErrorIs(t, ValidateURL(ctx, raw, false), ErrPrivateAddress, raw)
+	}
+}
+
+func TestSenderSend(t *testing.T) {
+	body := []byte(`{"event":"session.stopped"}`)
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := io.ReadAll(r.Body)
+		require.NoError(t, Verify("secret", r.Header.Get(SignatureHeader), got, time.Minute, time.Now()))
+		require.Equal(t, EventSessionStopped, r.Header.Get(EventHeader))
+		require.Equal(t, "d-1", r.Header.Get(DeliveryHeader))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sender := NewSender(5*time.Second, true)
+	d := Delivery{ID: "d-1", Event: EventSessionStopped, URL: srv.URL, Secret: "secret", Body: body}
+
+	code, err := sender.Send(context.Background(), d)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, code)
+
+	// Non-2xx responses are failures
+	status = http.StatusInternalServerError
+	code, err = sender.Send(context.Background(), d)
+	require.Error(t, err)
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "endpoint responded with status 500", ErrorMessage(err))
+}
+
+func TestSenderRefusesPrivateAddresses(t *testing.T) {
+	reached := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer srv.Close()
+
+	d := Delivery{ID: "d-1", Event: EventSessionStopped, URL: srv.URL, Secret: "secret", Body: []byte(`{}`)}
+	_, err := NewSender(5*time.Second, false).Send(context.Background(), d)
+	require.ErrorIs(t, err, ErrPrivateAddress)
+	require.False(t, reached)
+	require.Equal(t, ErrPrivateAddress.Error(), ErrorMessage(err))
+}
+
+func TestSenderDoesNotFollowRedirects(t *testing.T) {
+	followed := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	d := Delivery{ID: "d-1", Event: EventSessionStopped, URL: srv.URL, Secret: "secret", Body: []byte(`{}`)}
+	code, err := NewSender(5*time.Second, true).Send(context.Background(), d)
+	require.Error(t, err)
+	require.Equal(t, http.StatusTemporaryRedirect, code)
+	require.False(t, followed)
+}
+
+func TestErrorMessageHidesTransportErrors(t *testing.T) {
+	d := Delivery{ID: "d-1", Event: EventSessionStopped, URL: "http://127.0.0.1:1/hooks", Secret: "secret", Body: []byte(`{}`)}
+	_, err := NewSender(5*time.Second, true).Send(context.Background(), d)
+	require.Error(t, err)
+	require.Equal(t, "request failed", ErrorMessage(err))
+}
@@ -0,0 +1,6 @@
+-- Remove upstream proxy columns from the sessions table
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS proxy_server,
+DROP COLUMN IF EXISTS proxy_bypass,
+DROP COLUMN IF EXISTS proxy_username,
+DROP COLUMN IF EXISTS proxy_password;
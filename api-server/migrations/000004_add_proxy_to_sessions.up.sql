@@ -0,0 +1,7 @@
+-- Add upstream proxy columns to the sessions table.
+-- proxy_password holds ciphertext produced by the secrets package, never plaintext.
+ALTER TABLE sessions
+ADD COLUMN proxy_server TEXT DEFAULT NULL,
+ADD COLUMN proxy_bypass TEXT DEFAULT NULL,
+ADD COLUMN proxy_username TEXT DEFAULT NULL,
+ADD COLUMN proxy_password TEXT DEFAULT NULL;
@@ -0,0 +1,8 @@
+-- Remove emulation columns from the sessions table
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS locale,
+DROP COLUMN IF EXISTS timezone,
+DROP COLUMN IF EXISTS latitude,
+DROP COLUMN IF EXISTS longitude,
+DROP COLUMN IF EXISTS geo_accuracy,
+DROP COLUMN IF EXISTS color_scheme;
@@ -0,0 +1,8 @@
+-- Add locale, timezone, geolocation and color-scheme emulation columns to the sessions table
+ALTER TABLE sessions
+ADD COLUMN locale TEXT DEFAULT NULL,
+ADD COLUMN timezone TEXT DEFAULT NULL,
+ADD COLUMN latitude DOUBLE PRECISION DEFAULT NULL,
+ADD COLUMN longitude DOUBLE PRECISION DEFAULT NULL,
+ADD COLUMN geo_accuracy DOUBLE PRECISION DEFAULT NULL,
+ADD COLUMN color_scheme VARCHAR(20) DEFAULT NULL;
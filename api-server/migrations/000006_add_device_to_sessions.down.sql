@@ -0,0 +1,3 @@
+-- Remove the device preset column from the sessions table
+ALTER TABLE sessions
+DROP COLUMN IF EXISTS device;
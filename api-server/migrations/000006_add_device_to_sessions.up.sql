@@ -0,0 +1,3 @@
+-- Record the device preset a session was created with
+ALTER TABLE sessions
+ADD COLUMN device TEXT DEFAULT NULL;
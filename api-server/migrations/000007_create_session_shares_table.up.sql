@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS session_shares (
+    id          UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id  UUID        NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    user_id     UUID        NOT NULL REFERENCES users(id),
+    access      VARCHAR(20) NOT NULL CHECK (access IN ('view', 'control')),
+    created_by  UUID        NOT NULL REFERENCES users(id),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ
+);
+
+-- Lookups by session (owner managing grants) and by grantee (access checks)
+CREATE INDEX session_shares_session_id_idx ON session_shares(session_id);
+CREATE INDEX session_shares_user_id_idx ON session_shares(user_id);
+
+-- At most one unrevoked grant per session and user
+CREATE UNIQUE INDEX session_shares_active_idx ON session_shares(session_id, user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS sessions_org_id_idx;
+ALTER TABLE sessions DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
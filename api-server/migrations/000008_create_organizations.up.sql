@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id                  UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name                TEXT        NOT NULL,
+    -- Maximum number of concurrently active sessions owned by the org, NULL for unlimited
+    max_active_sessions INTEGER     DEFAULT NULL CHECK (max_active_sessions IS NULL OR max_active_sessions >= 0),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    org_id      UUID        NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id     UUID        NOT NULL REFERENCES users(id),
+    role        VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX organization_members_user_id_idx ON organization_members(user_id);
+
+-- Sessions may optionally be owned by an organization
+ALTER TABLE sessions
+ADD COLUMN org_id UUID DEFAULT NULL REFERENCES organizations(id);
+
+CREATE INDEX sessions_org_id_idx ON sessions(org_id);
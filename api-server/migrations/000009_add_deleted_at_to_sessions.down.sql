@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS sessions_deleted_at_idx;
+ALTER TABLE sessions DROP COLUMN IF EXISTS deleted_at;
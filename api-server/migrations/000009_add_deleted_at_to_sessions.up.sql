@@ -0,0 +1,6 @@
+-- Archive sessions instead of deleting them so usage history is kept until purged
+ALTER TABLE sessions
+ADD COLUMN deleted_at TIMESTAMPTZ DEFAULT NULL;
+
+-- The purge job only looks at archived rows
+CREATE INDEX sessions_deleted_at_idx ON sessions(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS usage_daily;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS is_admin;
@@ -0,0 +1,17 @@
+-- Admins can read usage reports for every user
+ALTER TABLE users
+ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Browser usage rolled up per user, day (UTC) and browser type. Rows are kept
+-- after the sessions they were computed from are purged.
+CREATE TABLE IF NOT EXISTS usage_daily (
+    user_id         UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day             DATE        NOT NULL,
+    browser_type    VARCHAR(50) NOT NULL,
+    session_count   INTEGER     NOT NULL DEFAULT 0,
+    browser_seconds BIGINT      NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, day, browser_type)
+);
+
+CREATE INDEX usage_daily_day_idx ON usage_daily(day);
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id         UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url        TEXT        NOT NULL,
+    -- Signing secret, encrypted with SECRETS_KEY
+    secret     TEXT        NOT NULL,
+    -- JSON array of subscribed event types, empty for every event
+    events     JSONB       NOT NULL DEFAULT '[]',
+    active     BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_endpoints_user_id_idx ON webhook_endpoints(user_id);
+
+-- Delivery queue and log. Pending rows are picked up by the dispatcher once
+-- next_attempt_at has passed.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    endpoint_id     UUID        NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event           VARCHAR(50) NOT NULL,
+    payload         JSONB       NOT NULL,
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMPTZ DEFAULT NULL,
+    response_status INTEGER     DEFAULT NULL,
+    last_error      TEXT        DEFAULT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_endpoint_id_idx ON webhook_deliveries(endpoint_id, created_at DESC);
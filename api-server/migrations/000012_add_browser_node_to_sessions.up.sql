@@ -0,0 +1,4 @@
+-- Base URL of the browser server node hosting the session, so later calls
+-- reach the same node. NULL for sessions created before node pools.
+ALTER TABLE sessions
+ADD COLUMN browser_node TEXT DEFAULT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS sessions_pending_idx;
+ALTER TABLE sessions DROP COLUMN IF EXISTS error_message;
+ALTER TABLE sessions DROP COLUMN IF EXISTS state;
@@ -0,0 +1,7 @@
+-- Launch state of a session. Asynchronously created sessions start out
+-- pending until the browser is up; failed sessions never got a browser.
+ALTER TABLE sessions
+ADD COLUMN state VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (state IN ('pending', 'running', 'failed')),
+ADD COLUMN error_message TEXT DEFAULT NULL;
+
+CREATE INDEX sessions_pending_idx ON sessions(started_at) WHERE state = 'pending';
@@ -0,0 +1,6 @@
+-- API server instance that owns a session, whose shutdown policy applies to
+-- it. NULL once handed off, until another instance adopts it.
+ALTER TABLE sessions
+ADD COLUMN instance_id TEXT DEFAULT NULL;
+
+CREATE INDEX sessions_instance_idx ON sessions(instance_id) WHERE stopped_at IS NULL AND deleted_at IS NULL;
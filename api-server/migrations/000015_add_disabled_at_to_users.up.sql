@@ -0,0 +1,4 @@
+-- When an operator disabled the user, who can no longer log in. NULL while
+-- the user is enabled.
+ALTER TABLE users
+ADD COLUMN disabled_at TIMESTAMPTZ DEFAULT NULL;
@@ -0,0 +1,17 @@
+-- Who did what within an organization: membership and settings changes and
+-- the lifecycle of sessions it owns
+CREATE TABLE IF NOT EXISTS organization_audit_events (
+    id             UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    org_id         UUID        NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    actor_id       UUID        NOT NULL REFERENCES users(id),
+    action         VARCHAR(50) NOT NULL,
+    -- Member the action applied to, if any
+    target_user_id UUID        DEFAULT NULL REFERENCES users(id),
+    -- Session the action applied to, if any. Not a foreign key so events
+    -- outlive purged sessions.
+    session_id     UUID        DEFAULT NULL,
+    detail         TEXT        DEFAULT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX organization_audit_events_org_id_idx ON organization_audit_events(org_id, created_at DESC);
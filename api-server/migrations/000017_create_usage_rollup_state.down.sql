@@ -0,0 +1 @@
+DROP TABLE IF EXISTS usage_rollup_state;
@@ -0,0 +1,6 @@
+-- How far usage has been rolled up: the single row holds the end of the last
+-- rollup, so the next one can catch up on days no instance rolled up
+CREATE TABLE IF NOT EXISTS usage_rollup_state (
+    id           BOOLEAN     PRIMARY KEY DEFAULT TRUE CHECK (id),
+    rolled_up_to TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Finished deliveries are purged once their last attempt is older than the
+-- retention window
+CREATE INDEX IF NOT EXISTS webhook_deliveries_finished_idx ON webhook_deliveries(last_attempt_at) WHERE status <> 'pending';
@@ -0,0 +1,6 @@
+-- When the browser server will expire the session, so expiry can be detected.
+-- IF NOT EXISTS because the column was first added with the webhook tables.
+ALTER TABLE sessions
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions(expires_at) WHERE stopped_at IS NULL;
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the database schema, named
+// as the migrate tool expects: NNNNNN_description.up.sql and .down.sql
+package migrations
+
+import "embed"
+
+// FS holds every migration file
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,138 @@
+import hashlib
+import hmac
+import json
+import ssl
+import time
+
+from config import settings
+
+
+class NonceCache:
+    """Remembers recently seen request nonces so signed requests can't be replayed"""
+
+    def __init__(self, prune_interval: int):
+        self._seen = {}
+        self._prune_interval = prune_interval
+        self._next_prune = time.time() + prune_interval
+
+    def add(self, nonce: str, expires_at: float) -> bool:
+        """Record a nonce until expires_at, returning False if it has already been seen"""
+        now = time.time()
+        if now >= self._next_prune:
+            self._seen = {n: exp for n, exp in self._seen.items() if exp > now}
+            self._next_prune = now + self._prune_interval
+
+        if self._seen.get(nonce, 0) > now:
+            return False
+        self._seen[nonce] = expires_at
+        return True
+
+
+def signature(secret: str, method: str, request_uri: str, timestamp: str, nonce: str, body: bytes) -> str:
+    """HMAC-SHA256 over the request, computed the same way as the API server's browser.Client"""
+    body_hash = hashlib.sha256(body).hexdigest()
+    message = f"{method}\n{request_uri}\n{timestamp}\n{nonce}\n{body_hash}"
+    return hmac.new(secret.encode(), message.encode(), hashlib.sha256).hexdigest()
+
+
+class RequestSignatureMiddleware:
+    """ASGI middleware rejecting requests without a valid signature from the API server.
+
+    Requests must carry X-Browser-Timestamp, X-Browser-Nonce and X-Browser-Signature
+    headers. The timestamp must be within SIGNATURE_MAX_AGE seconds of now and each
+    nonce is accepted once. GET /health is left open for health checks.
+    """
+
+    def __init__(self, app, secret: str, max_age: int):
+        self.app = app
+        self.secret = secret
+        self.max_age = max_age
+        self.nonces = NonceCache(max_age)
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http" or scope["path"] == "/health":
+            await self.app(scope, receive, send)
+            return
+
+        # Read the whole body so it can be hashed, then replay it to the app
+        body = b""
+        more_body = True
+        while more_body:
+            message = await receive()
+            if message["type"] == "http.disconnect":
+                return
+            body += message.get("body", b"")
+            more_body = message.get("more_body", False)
+
+        error = self.verify(scope, body)
+        if error:
+            await self.reject(send, error)
+            return
+
+        sent = False
+
+        async def replay():
+            nonlocal sent
+            if sent:
+                return await receive()
+            sent = True
+            return {"type": "http.request", "body": body, "more_body": False}
+
+        await self.app(scope, replay, send)
+
+    def verify(self, scope, body: bytes):
+        """Return why the request's signature is unacceptable, or None"""
+        headers = {k.decode("latin-1").lower(): v.decode("latin-1") for k, v in scope["headers"]}
+        timestamp = headers.get("x-browser-timestamp")
+        nonce = headers.get("x-browser-nonce")
+        provided = headers.get("x-browser-signature")
+        if not timestamp or not nonce or not provided:
+            return "Missing request signature"
+
+        try:
+            signed_at = int(timestamp)
+        except ValueError:
+            return "Invalid request timestamp"
+        now = time.time()
+        if abs(now - signed_at) > self.max_age:
+            return "Request timestamp outside the allowed window"
+
+        request_uri = scope.get("raw_path") or scope["path"].encode()
+        request_uri = request_uri.decode("latin-1")
+        if scope.get("query_string"):
+            request_uri += "?" + scope["query_string"].decode("latin-1")
+
+        expected = signature(self.secret, scope["method"], request_uri, timestamp, nonce, body)
+        if not hmac.compare_digest(expected, provided):
+            return "Invalid request signature"
+
+        # A nonce only needs remembering while its timestamp would be accepted
+        if not self.nonces.add(nonce, signed_at + self.max_age):
+            return "Request already received"
+        return None
+
+    async def reject(self, send, detail: str):
+        body = json.dumps({"detail": detail, "code": "unauthorized"}).encode()
+        await send({
+            "type": "http.response.start",
+            "status": 401,
+            "headers": [(b"content-type", b"application/json"),
+                        (b"content-length", str(len(body)).encode())],
+        })
+        await send({"type": "http.response.body", "body": body})
+
+
+def tls_options() -> dict:
+    """uvicorn arguments serving HTTPS when TLS_CERT_FILE is set, requiring client
+    certificates signed by TLS_CLIENT_CA_FILE when that is set too"""
+    if not settings.TLS_CERT_FILE:
+        return {}
+
+    options = {
+        "ssl_certfile": settings.TLS_CERT_FILE,
+        "ssl_keyfile": settings.TLS_KEY_FILE or None,
+    }
+    if settings.TLS_CLIENT_CA_FILE:
+        options["ssl_ca_certs"] = settings.TLS_CLIENT_CA_FILE
+        options["ssl_cert_reqs"] = ssl.CERT_REQUIRED
+    return options
@@ -1,6 +1,7 @@
 import asyncio
 import os
 from typing import Dict, Optional, Tuple, Any
+from urllib.parse import urlparse
 from playwright.async_api import async_playwright, Browser, BrowserType
 from config import settings
 import uuid
@@ -10,6 +11,40 @@ from screen_manager import ScreenManager
 logger = logging.getLogger(__name__)
 
 
+class UnsupportedBrowserError(ValueError):
+    """Raised when a session asks for a browser type Playwright can't launch"""
+
+
+class BrowserUnavailableError(RuntimeError):
+    """Raised when browsers can't be launched at all, e.g. before startup finishes"""
+
+
+class ProxyUnreachableError(ValueError):
+    """Raised when a session's upstream proxy doesn't accept connections from this server"""
+
+
+# Default port of each supported proxy scheme
+DEFAULT_PROXY_PORTS = {"http": 80, "https": 443, "socks5": 1080}
+
+
+async def check_proxy(server: str):
+    """Open and close a TCP connection to the proxy, so an unreachable proxy
+    fails the launch before a browser is started. The connection error is
+    only logged: it would tell hosts and ports on this server's network apart."""
+    parsed = urlparse(server)
+    port = parsed.port or DEFAULT_PROXY_PORTS.get(parsed.scheme)
+    try:
+        _, writer = await asyncio.wait_for(
+            asyncio.open_connection(parsed.hostname, port),
+            timeout=settings.PROXY_CHECK_TIMEOUT
+        )
+    except (OSError, ValueError, asyncio.TimeoutError) as e:
+        logger.warning(f"Proxy {parsed.hostname}:{port} is unreachable: {e!r}")
+        raise ProxyUnreachableError("proxy server is unreachable") from e
+    writer.close()
+    await writer.wait_closed()
+
+
 class BrowserManager:
     """Manages browser instances using Playwright"""
 
@@ -31,11 +66,14 @@ class BrowserManager:
         browser_type: str, 
         headless: bool = True, 
         viewport_size: Optional[Dict[str, int]] = None,
-        user_agent: Optional[str] = None
+        user_agent: Optional[str] = None,
+        proxy: Optional[Dict[str, str]] = None,
+        emulation: Optional[Dict[str, Any]] = None,
+        device_metrics: Optional[Dict[str, Any]] = None
     ) -> Tuple[Dict[str, Any], str]:
         """Create a new browser instance and return the browser object and CDP URL"""
         if not self.playwright:
-            raise RuntimeError("BrowserManager not initialized")
+            raise BrowserUnavailableError("BrowserManager not initialized")
             
         browser_types = {
             "chromium": self.playwright.chromium,
@@ -44,10 +82,14 @@ class BrowserManager:
         }
         
         if browser_type not in browser_types:
-            raise ValueError(f"Unsupported browser type: {browser_type}. "
+            raise UnsupportedBrowserError(f"Unsupported browser type: {browser_type}. "
                             f"Supported types are: {', '.join(browser_types.keys())}")
             
         browser_instance: BrowserType = browser_types[browser_type]
+
+        # Make sure the browser will be able to reach its proxy
+        if proxy:
+            await check_proxy(proxy["server"])
         
         # For headed browsers, get an available virtual display
         display_num = None
@@ -77,6 +119,10 @@ class BrowserManager:
             "headless": headless
         }
         
+        # Route all browser traffic through the upstream proxy if one was requested
+        if proxy:
+            launch_options["proxy"] = proxy
+
         # Set environment variables for the display if using a virtual display
         if display_num is not None:
             launch_options["env"] = self.screen_manager.get_display_env(display_num)
@@ -110,8 +156,11 @@ class BrowserManager:
             # This is implementation-specific and might need adjustment
             cdp_url = browser.wsEndpoint
             
-        # For non-headless mode, create a context and page to make it visible in VNC
-        if not headless:
+        # For non-headless mode, create a context and page to make it visible in VNC.
+        # Emulation and device overrides also need a page to attach to, so create one for them too.
+        overrides = bool(emulation or device_metrics)
+        context_data = None
+        if not headless or overrides:
             try:
                 # Create a browser context with the specified viewport size
                 context_options = {}
@@ -119,27 +168,49 @@ class BrowserManager:
                     context_options["viewport"] = viewport_size
                 if user_agent:
                     context_options["user_agent"] = user_agent
-                    
+                # Browsers without CDP get their overrides as context options
+                if emulation and browser_type != "chromium":
+                    context_options.update(self._emulation_context_options(emulation))
+                if device_metrics and browser_type != "chromium":
+                    context_options["device_scale_factor"] = device_metrics["device_scale_factor"]
+                    context_options["has_touch"] = device_metrics["has_touch"]
+                    # Firefox does not support is_mobile
+                    if browser_type != "firefox":
+                        context_options["is_mobile"] = device_metrics["is_mobile"]
+
                 context = await browser.new_context(**context_options)
                 
                 # Create a page in this context - this will be visible in VNC
                 page = await context.new_page()
-                
-                # Navigate to a blank page to initialize the window
-                await page.goto("about:blank")
-                
+
                 # Store the context and page for later use
                 context_data = {
                     "context": context,
-                    "page": page
+                    "page": page,
+                    "cdp": None
                 }
+
+                if overrides and browser_type == "chromium":
+                    context_data["cdp"] = await context.new_cdp_session(page)
+                    if device_metrics:
+                        await self._apply_cdp_device_metrics(context_data["cdp"], viewport_size, device_metrics)
+                    if emulation:
+                        await self._apply_cdp_emulation(context, context_data["cdp"], emulation)
+
+                # Navigate to a blank page to initialize the window
+                await page.goto("about:blank")
                 
-                print(f"Created visible browser window for display :{display_num}")
+                if not headless:
+                    print(f"Created visible browser window for display :{display_num}")
             except Exception as e:
+                if overrides:
+                    # The caller asked for overrides we could not apply; don't hand out the browser
+                    await browser.close()
+                    if display_num is not None:
+                        await self.screen_manager.release_screen(display_num)
+                    raise RuntimeError(f"Failed to apply browser overrides: {str(e)}")
                 logger.error(f"Failed to create visible browser window: {str(e)}")
                 context_data = None
-        else:
-            context_data = None
         
         # Generate a unique ID for this browser instance
         browser_id = str(uuid.uuid4())
@@ -154,6 +225,7 @@ class BrowserManager:
             "user_agent": user_agent,
             "display_num": display_num,
             "vnc_url": vnc_url,
+            "emulation": emulation,
             "context_data": context_data  # Store the context and page
         }
         
@@ -165,6 +237,95 @@ class BrowserManager:
         
         return browser_data, cdp_url
     
+    @staticmethod
+    def _emulation_context_options(emulation: Dict[str, Any]) -> Dict[str, Any]:
+        """Translate emulation overrides into Playwright context options"""
+        options: Dict[str, Any] = {}
+        if emulation.get("locale"):
+            options["locale"] = emulation["locale"]
+        if emulation.get("timezone"):
+            options["timezone_id"] = emulation["timezone"]
+        if emulation.get("geolocation"):
+            options["geolocation"] = emulation["geolocation"]
+            options["permissions"] = ["geolocation"]
+        if emulation.get("color_scheme"):
+            options["color_scheme"] = emulation["color_scheme"]
+        return options
+
+    @staticmethod
+    async def _apply_cdp_device_metrics(cdp, viewport_size: Optional[Dict[str, int]], device_metrics: Dict[str, Any]):
+        """Apply a device metrics and touch override over CDP"""
+        viewport = viewport_size or {"width": settings.DEFAULT_VIEW_WIDTH, "height": settings.DEFAULT_VIEW_HEIGHT}
+        await cdp.send("Emulation.setDeviceMetricsOverride", {
+            "width": viewport["width"],
+            "height": viewport["height"],
+            "deviceScaleFactor": device_metrics["device_scale_factor"],
+            "mobile": device_metrics["is_mobile"]
+        })
+        await cdp.send("Emulation.setTouchEmulationEnabled", {"enabled": device_metrics["has_touch"]})
+
+    @staticmethod
+    async def _apply_cdp_emulation(context, cdp, emulation: Dict[str, Any]):
+        """Apply emulation overrides over CDP. Unset fields clear any previous override.
+
+        CDP emulation is per target, so only the server-created page behind cdp is
+        affected; pages clients open over the CDP URL start without the overrides.
+        """
+        await cdp.send("Emulation.setLocaleOverride", {"locale": emulation.get("locale") or ""})
+        await cdp.send("Emulation.setTimezoneOverride", {"timezoneId": emulation.get("timezone") or ""})
+
+        geolocation = emulation.get("geolocation")
+        if geolocation:
+            await context.grant_permissions(["geolocation"])
+            await cdp.send("Emulation.setGeolocationOverride", {
+                "latitude": geolocation["latitude"],
+                "longitude": geolocation["longitude"],
+                "accuracy": geolocation.get("accuracy") or 0
+            })
+        else:
+            await cdp.send("Emulation.clearGeolocationOverride")
+
+        await cdp.send("Emulation.setEmulatedMedia", {
+            "features": [{"name": "prefers-color-scheme", "value": emulation.get("color_scheme") or ""}]
+        })
+
+    async def update_emulation(self, browser_id: str, emulation: Dict[str, Any]):
+        """Replace the emulation overrides of a running browser"""
+        async with self._lock:
+            browser_data = self.browsers.get(browser_id)
+
+        if not browser_data:
+            raise ValueError(f"Browser {browser_id} not found")
+
+        context_data = browser_data["context_data"]
+        if context_data is None:
+            # Headless sessions launched without overrides have no page yet
+            context = await browser_data["instance"].new_context(
+                viewport=browser_data["viewport_size"],
+                user_agent=browser_data["user_agent"]
+            )
+            page = await context.new_page()
+            context_data = {"context": context, "page": page, "cdp": None}
+            browser_data["context_data"] = context_data
+
+        if browser_data["type"] == "chromium":
+            if context_data["cdp"] is None:
+                context_data["cdp"] = await context_data["context"].new_cdp_session(context_data["page"])
+            await self._apply_cdp_emulation(context_data["context"], context_data["cdp"], emulation)
+        else:
+            # Without CDP only geolocation and color scheme can change after launch
+            current = browser_data["emulation"] or {}
+            for key in ("locale", "timezone"):
+                if emulation.get(key) != current.get(key):
+                    raise ValueError(f"{key} can only be changed on a running chromium session")
+            context = context_data["context"]
+            if emulation.get("geolocation"):
+                await context.grant_permissions(["geolocation"])
+            await context.set_geolocation(emulation.get("geolocation"))
+            await context_data["page"].emulate_media(color_scheme=emulation.get("color_scheme") or "no-preference")
+
+        browser_data["emulation"] = emulation
+
     async def close_browser(self, browser_id: str) -> bool:
         """Close a specific browser instance and release its virtual display if any"""
         browser_data = None
@@ -24,6 +24,14 @@ class Settings(BaseSettings):
     DEFAULT_HEADLESS: bool = os.getenv("DEFAULT_HEADLESS", "True").lower() in ('true', '1', 't')
     DEFAULT_VIEW_WIDTH: int = int(os.getenv("DEFAULT_VIEW_WIDTH", "1280"))
     DEFAULT_VIEW_HEIGHT: int = int(os.getenv("DEFAULT_VIEW_HEIGHT", "720"))
+    PROXY_CHECK_TIMEOUT: float = float(os.getenv("PROXY_CHECK_TIMEOUT", "3"))  # Seconds to wait for a session's proxy to accept a connection
+
+    # API server authentication
+    BROWSER_SERVER_SECRET: str = os.getenv("BROWSER_SERVER_SECRET", "")  # Shared with the API server; unset disables signature checks
+    SIGNATURE_MAX_AGE: int = int(os.getenv("SIGNATURE_MAX_AGE", "30"))  # Seconds a signed request stays valid
+    TLS_CERT_FILE: str = os.getenv("TLS_CERT_FILE", "")
+    TLS_KEY_FILE: str = os.getenv("TLS_KEY_FILE", "")
+    TLS_CLIENT_CA_FILE: str = os.getenv("TLS_CLIENT_CA_FILE", "")  # Requires client certificates signed by this CA
 
 
 # Create a global settings object
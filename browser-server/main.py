@@ -3,15 +3,18 @@ import uvicorn
 from fastapi import FastAPI, HTTPException
 from fastapi.responses import JSONResponse
 
-from browser_manager import BrowserManager
-from session_manager import SessionManager
+from browser_manager import BrowserManager, UnsupportedBrowserError, BrowserUnavailableError
+from session_manager import SessionManager, SessionLimitError
 from models import (
     SessionCreateRequest,
     SessionResponse,
     SessionListResponse,
-    ErrorResponse
+    HealthResponse,
+    ErrorResponse,
+    Emulation
 )
 from config import settings
+from auth import RequestSignatureMiddleware, tls_options
 
 app = FastAPI(
     title="Browser Session Service",
@@ -19,14 +22,53 @@ app = FastAPI(
     version="0.1.0"
 )
 
+if settings.BROWSER_SERVER_SECRET:
+    app.add_middleware(RequestSignatureMiddleware,
+                       secret=settings.BROWSER_SERVER_SECRET,
+                       max_age=settings.SIGNATURE_MAX_AGE)
+else:
+    print("Warning: BROWSER_SERVER_SECRET is not set, requests are not authenticated")
+
 # Initialize managers
 browser_manager = BrowserManager()
 session_manager = SessionManager(browser_manager)
 
 
+class APIError(HTTPException):
+    """HTTP error with a machine-readable code the API server maps to its own errors"""
+
+    def __init__(self, status_code: int, code: str, detail: str, headers: dict = None):
+        super().__init__(status_code=status_code, detail=detail, headers=headers)
+        self.code = code
+
+
+@app.exception_handler(APIError)
+async def api_error_handler(request, exc: APIError):
+    return JSONResponse(
+        status_code=exc.status_code,
+        content={"detail": exc.detail, "code": exc.code},
+        headers=exc.headers
+    )
+
+
+def session_not_found(session_id: str) -> APIError:
+    return APIError(404, "session_not_found", f"Session {session_id} not found")
+
+
+@app.get("/health", response_model=HealthResponse)
+async def health():
+    """Report the server's capacity so the API server can place new sessions"""
+    return {
+        "status": "ok",
+        "active_sessions": await session_manager.count_sessions(),
+        "max_sessions": settings.MAX_SESSIONS
+    }
+
+
 @app.post("/sessions", 
           response_model=SessionResponse, 
-          responses={400: {"model": ErrorResponse}, 500: {"model": ErrorResponse}})
+          responses={400: {"model": ErrorResponse}, 429: {"model": ErrorResponse},
+                     500: {"model": ErrorResponse}, 503: {"model": ErrorResponse}})
 async def create_session(request: SessionCreateRequest):
     """Create a new browser session and return its details with CDP URL"""
     try:
@@ -35,9 +77,22 @@ async def create_session(request: SessionCreateRequest):
             headless=request.headless,
             viewport_size=request.viewport_size,
             user_agent=request.user_agent,
-            timeout=request.timeout
+            timeout=request.timeout,
+            proxy=request.proxy,
+            emulation=request.emulation,
+            device_metrics=request.device_metrics
         )
         return session
+    except SessionLimitError as e:
+        # Expired sessions are cleaned up every CLEANUP_INTERVAL seconds
+        raise APIError(429, "capacity_exhausted", str(e),
+                       headers={"Retry-After": str(settings.CLEANUP_INTERVAL)})
+    except UnsupportedBrowserError as e:
+        raise APIError(400, "invalid_browser_type", str(e))
+    except ValueError as e:
+        raise APIError(400, "invalid_request", str(e))
+    except BrowserUnavailableError as e:
+        raise APIError(503, "unavailable", str(e))
     except Exception as e:
         raise HTTPException(status_code=500, detail=str(e))
 
@@ -56,7 +111,23 @@ async def get_session(session_id: str):
     """Get details of a specific browser session"""
     session = await session_manager.get_session(session_id)
     if not session:
-        raise HTTPException(status_code=404, detail=f"Session {session_id} not found")
+        raise session_not_found(session_id)
+    return session
+
+
+@app.put("/sessions/{session_id}/emulation",
+         response_model=SessionResponse,
+         responses={400: {"model": ErrorResponse}, 404: {"model": ErrorResponse}, 500: {"model": ErrorResponse}})
+async def update_emulation(session_id: str, emulation: Emulation):
+    """Replace the emulation overrides of a running browser session"""
+    try:
+        session = await session_manager.update_emulation(session_id, emulation)
+    except ValueError as e:
+        raise APIError(400, "invalid_request", str(e))
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+    if not session:
+        raise session_not_found(session_id)
     return session
 
 
@@ -67,7 +138,7 @@ async def delete_session(session_id: str):
     """Terminate and remove a specific browser session"""
     success = await session_manager.delete_session(session_id)
     if not success:
-        raise HTTPException(status_code=404, detail=f"Session {session_id} not found")
+        raise session_not_found(session_id)
     return {"status": "success", "message": f"Session {session_id} terminated"}
 
 
@@ -92,4 +163,4 @@ async def shutdown():
 
 
 if __name__ == "__main__":
-    uvicorn.run("main:app", host=settings.HOST, port=settings.PORT, reload=settings.DEBUG)
\ No newline at end of file
+    uvicorn.run("main:app", host=settings.HOST, port=settings.PORT, reload=settings.DEBUG, **tls_options())
\ No newline at end of file
@@ -1,4 +1,4 @@
-from typing import Dict, List, Optional
+from typing import Dict, List, Literal, Optional
 from pydantic import BaseModel, Field
 from datetime import datetime
 from config import settings
@@ -7,12 +7,37 @@ class ViewportSize(BaseModel):
     width: int = Field(settings.DEFAULT_VIEW_WIDTH, description="Viewport width in pixels")
     height: int = Field(settings.DEFAULT_VIEW_HEIGHT, description="Viewport height in pixels")
 
+class ProxySettings(BaseModel):
+    server: str = Field(..., description="Proxy server URL (http://, https:// or socks5://host:port)")
+    bypass: Optional[str] = Field(None, description="Comma-separated hosts that bypass the proxy")
+    username: Optional[str] = Field(None, description="Proxy username")
+    password: Optional[str] = Field(None, description="Proxy password")
+
+class Geolocation(BaseModel):
+    latitude: float = Field(..., ge=-90, le=90, description="Latitude in degrees")
+    longitude: float = Field(..., ge=-180, le=180, description="Longitude in degrees")
+    accuracy: Optional[float] = Field(None, ge=0, description="Accuracy in meters")
+
+class Emulation(BaseModel):
+    locale: Optional[str] = Field(None, description="BCP 47 locale, e.g. de-DE")
+    timezone: Optional[str] = Field(None, description="IANA timezone, e.g. Europe/Berlin")
+    geolocation: Optional[Geolocation] = None
+    color_scheme: Optional[Literal["light", "dark", "no-preference"]] = Field(None, description="prefers-color-scheme value")
+
+class DeviceMetrics(BaseModel):
+    device_scale_factor: float = Field(1, gt=0, description="Device pixel ratio")
+    is_mobile: bool = Field(False, description="Emulate a mobile device (meta viewport, overlay scrollbars)")
+    has_touch: bool = Field(False, description="Enable touch events")
+
 class SessionCreateRequest(BaseModel):
     browser_type: str = Field(settings.DEFAULT_BROWSER, description="Browser type (chromium, firefox, webkit)")
     headless: bool = Field(settings.DEFAULT_HEADLESS, description="Run browser in headless mode")
     viewport_size: Optional[ViewportSize] = None
     user_agent: Optional[str] = None
     timeout: Optional[int] = Field(settings.DEFAULT_SESSION_TIMEOUT, description="Session timeout in seconds")
+    proxy: Optional[ProxySettings] = Field(None, description="Upstream proxy for all browser traffic")
+    emulation: Optional[Emulation] = Field(None, description="Locale, timezone, geolocation and color-scheme overrides")
+    device_metrics: Optional[DeviceMetrics] = Field(None, description="Device metrics override applied at launch")
 
 class SessionResponse(BaseModel):
     id: str = Field(..., description="Unique session identifier")
@@ -23,9 +48,16 @@ class SessionResponse(BaseModel):
     cdp_url: str = Field(..., description="Chrome DevTools Protocol URL for this session")
     viewport_size: ViewportSize = Field(..., description="Browser viewport size")
     user_agent: Optional[str] = Field(None, description="User agent string if custom one is set")
+    emulation: Optional[Emulation] = Field(None, description="Emulation overrides currently applied")
 
 class SessionListResponse(BaseModel):
     sessions: List[SessionResponse] = Field(..., description="List of active sessions")
 
+class HealthResponse(BaseModel):
+    status: str = Field(..., description="Always \"ok\" while the server is accepting requests")
+    active_sessions: int = Field(..., description="Number of running sessions")
+    max_sessions: int = Field(..., description="Maximum number of concurrent sessions")
+
 class ErrorResponse(BaseModel):
-    detail: str = Field(..., description="Error details")
\ No newline at end of file
+    detail: str = Field(..., description="Error details")
+    code: Optional[str] = Field(None, description="Machine-readable error code, e.g. session_not_found or capacity_exhausted")
\ No newline at end of file
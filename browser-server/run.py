@@ -4,6 +4,7 @@ Entry point script to start the browser session service
 """
 import uvicorn
 from config import settings
+from auth import tls_options
 
 if __name__ == "__main__":
     print(f"Starting Browser Session Service on {settings.HOST}:{settings.PORT}")
@@ -14,5 +15,6 @@ if __name__ == "__main__":
         "main:app", 
         host=settings.HOST, 
         port=settings.PORT, 
-        reload=settings.DEBUG
+        reload=settings.DEBUG,
+        **tls_options()
     )
\ No newline at end of file
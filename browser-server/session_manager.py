@@ -3,11 +3,15 @@ import uuid
 from typing import Dict, List, Optional, Any
 from datetime import datetime, timedelta
 
-from models import SessionResponse, ViewportSize
+from models import SessionResponse, ViewportSize, ProxySettings, Emulation, DeviceMetrics
 from browser_manager import BrowserManager
 from config import settings
 
 
+class SessionLimitError(Exception):
+    """Raised when MAX_SESSIONS sessions are already running"""
+
+
 class SessionManager:
     """Manages browser sessions including creation, tracking, and cleanup"""
     
@@ -48,13 +52,16 @@ class SessionManager:
         headless: bool = settings.DEFAULT_HEADLESS,
         viewport_size: Optional[ViewportSize] = None,
         user_agent: Optional[str] = None,
-        timeout: int = settings.DEFAULT_SESSION_TIMEOUT
+        timeout: int = settings.DEFAULT_SESSION_TIMEOUT,
+        proxy: Optional[ProxySettings] = None,
+        emulation: Optional[Emulation] = None,
+        device_metrics: Optional[DeviceMetrics] = None
     ) -> SessionResponse:
         """Create a new browser session and return its details"""
         # Check if we've reached the maximum number of sessions
         async with self._lock:
             if len(self.sessions) >= settings.MAX_SESSIONS:
-                raise RuntimeError(f"Maximum number of sessions reached ({settings.MAX_SESSIONS})")
+                raise SessionLimitError(f"Maximum number of sessions reached ({settings.MAX_SESSIONS})")
         
         # Create viewport size if not provided
         if viewport_size is None:
@@ -68,7 +75,10 @@ class SessionManager:
             browser_type=browser_type,
             headless=headless,
             viewport_size={"width": viewport_size.width, "height": viewport_size.height},
-            user_agent=user_agent
+            user_agent=user_agent,
+            proxy=proxy.model_dump(exclude_none=True) if proxy else None,
+            emulation=emulation.model_dump(exclude_none=True) if emulation else None,
+            device_metrics=device_metrics.model_dump() if device_metrics else None
         )
         
         # Generate unique session ID
@@ -88,7 +98,8 @@ class SessionManager:
             "expires_at": expires_at,
             "cdp_url": cdp_url,
             "viewport_size": viewport_size,
-            "user_agent": user_agent
+            "user_agent": user_agent,
+            "emulation": emulation
         }
         
         # Store session
@@ -117,6 +128,28 @@ class SessionManager:
                 
         return session_list
     
+    async def count_sessions(self) -> int:
+        """Return the number of active sessions"""
+        async with self._lock:
+            return len(self.sessions)
+    
+    async def update_emulation(self, session_id: str, emulation: Emulation) -> Optional[SessionResponse]:
+        """Replace the emulation overrides of a running session"""
+        async with self._lock:
+            session = self.sessions.get(session_id)
+
+        if not session:
+            return None
+
+        await self.browser_manager.update_emulation(
+            session["browser_id"],
+            emulation.model_dump(exclude_none=True)
+        )
+
+        async with self._lock:
+            session["emulation"] = emulation
+        return SessionResponse(**session)
+
     async def delete_session(self, session_id: str) -> bool:
         """Terminate and remove a session"""
         # Get session info